@@ -0,0 +1,479 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/AeonDave/garble/internal/literals"
+)
+
+// commandAudit implements "garble audit".
+func commandAudit(args []string) error {
+	flags, args := splitFlagsFromArgs(args)
+	if hasHelpFlag(flags) || len(args) == 0 {
+		_, _ = fmt.Fprint(os.Stderr, `
+usage: garble [garble flags] audit [-json] [-min-length=n] [build flags] binary [packages]
+
+Audit scans a binary built by garble for names and strings which obfuscation
+should have removed. For example, after building a program as follows:
+
+	garble -literals build -o myapp ./cmd/myapp
+
+One can check the binary in CI as follows:
+
+	garble -literals audit ./myapp ./cmd/myapp
+
+The garble flags and build flags should match those of the build.
+The original import paths, module paths, source file paths, and top-level
+identifiers of the packages outside the standard library which are obfuscated
+are searched for in every section of the binary. With -literals, string
+literals which should have been encrypted are searched for as well.
+
+Each finding is printed with its section and file offset, and the command
+fails if there are any. Values shorter than -min-length bytes, 5 by default,
+are ignored to avoid false positives. The -json flag prints a JSON array instead.
+`[1:])
+		return errJustExit(2)
+	}
+
+	flags, opts, err := cutAuditFlags(flags)
+	if err != nil {
+		return err
+	}
+
+	// We don't actually run a main Go command with all flags,
+	// so if the user gave a non-build flag,
+	// we need this check to not silently ignore it.
+	if _, firstUnknown := filterForwardBuildFlags(flags); firstUnknown != "" {
+		// A bit of a hack to get a normal flag.Parse error.
+		return flag.NewFlagSet("", flag.ContinueOnError).Parse([]string{firstUnknown})
+	}
+
+	binary, pkgs := args[0], args[1:]
+	sections, err := readBinarySections(binary)
+	if err != nil {
+		return err
+	}
+
+	// Like "garble reverse", we only use toolexecCmd
+	// to ensure that sharedCache.ListedPackages is filled.
+	_, err = toolexecCmd("list", append(flags, pkgs...))
+	defer func() {
+		_ = os.RemoveAll(os.Getenv("GARBLE_SHARED"))
+	}()
+	if err != nil {
+		return err
+	}
+
+	secrets, err := auditSecrets(opts.minLength)
+	if err != nil {
+		return err
+	}
+	findings := scanSections(sections, secrets)
+
+	if opts.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if findings == nil {
+			findings = []auditFinding{} // print [] rather than null
+		}
+		if err := enc.Encode(findings); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Printf("%s+%#x: %s %q from %s", f.Section, f.Offset, f.Kind, f.Value, f.Package)
+			if f.Count > 1 {
+				fmt.Printf(" (%d times)", f.Count)
+			}
+			fmt.Println()
+		}
+	}
+	if len(findings) > 0 {
+		leaked := make(map[string]bool)
+		for _, f := range findings {
+			leaked[f.Value] = true
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "%s: %d of %d checked values leaked\n", binary, len(leaked), len(secrets))
+		return errJustExit(1)
+	}
+	return nil
+}
+
+type auditOptions struct {
+	json      bool
+	minLength int
+}
+
+// cutAuditFlags removes the flags specific to "garble audit" from flags,
+// leaving only the build flags which are forwarded to "go list".
+func cutAuditFlags(flags []string) (rest []string, opts auditOptions, _ error) {
+	opts.minLength = 5
+	for i := 0; i < len(flags); i++ {
+		arg := flags[i]
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		switch name {
+		case "json":
+			opts.json = !hasValue || value == "true"
+		case "min-length":
+			if !hasValue {
+				if i++; i >= len(flags) {
+					return nil, opts, fmt.Errorf("flag needs an argument: -%s", name)
+				}
+				value = flags[i]
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, opts, fmt.Errorf("invalid value %q for flag -min-length", value)
+			}
+			opts.minLength = n
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, opts, nil
+}
+
+// auditSecret is a value which must not appear in an obfuscated binary.
+type auditSecret struct {
+	Kind    string // such as "identifier" or "literal"
+	Value   string
+	Package string // the import path of the package it comes from
+
+	// word is set for identifiers, which only count as found
+	// when they aren't part of a longer identifier.
+	word bool
+}
+
+// auditSecrets collects the values which should be obfuscated in the packages
+// recorded in sharedCache.ListedPackages, ignoring values shorter than minLength.
+//
+// Like reverseReplacer, we parse and typecheck each obfuscated package.
+// Names declared in the packages which aren't obfuscated are ignored,
+// as they can legitimately appear in the binary.
+func auditSecrets(minLength int) ([]auditSecret, error) {
+	var secrets []auditSecret
+	seen := make(map[string]bool)
+	add := func(s auditSecret) {
+		if len(s.Value) < minLength || seen[s.Value] {
+			return
+		}
+		seen[s.Value] = true
+		secrets = append(secrets, s)
+	}
+
+	// The names in the reflect code we inject into main packages are our own,
+	// and aren't worth reporting.
+	kept := make(map[string]bool)
+	abiFile, err := parser.ParseFile(token.NewFileSet(), "reflect_abi_code.go", reflectAbiCode, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range auditIdentifiers([]*ast.File{abiFile}) {
+		kept[name] = true
+	}
+	keptPkgs := make(map[*types.Package]bool)
+	var addKept func(pkg *types.Package)
+	addKept = func(pkg *types.Package) {
+		lpkg := sharedCache.ListedPackages[pkg.Path()]
+		if lpkg != nil && lpkg.ToObfuscate && !lpkg.Standard {
+			return
+		}
+		if keptPkgs[pkg] {
+			return
+		}
+		keptPkgs[pkg] = true
+		for _, name := range pkg.Scope().Names() {
+			kept[name] = true
+		}
+		for _, imp := range pkg.Imports() {
+			addKept(imp)
+		}
+	}
+
+	type pkgIdents struct {
+		lpkg   *listedPackage
+		idents []string
+	}
+	var allIdents []pkgIdents
+	for _, path := range slices.Sorted(maps.Keys(sharedCache.ListedPackages)) {
+		lpkg := sharedCache.ListedPackages[path]
+		if !lpkg.ToObfuscate || lpkg.Standard {
+			continue
+		}
+		add(auditSecret{Kind: "import path", Value: lpkg.ImportPath, Package: path})
+		if lpkg.Module != nil {
+			add(auditSecret{Kind: "module path", Value: lpkg.Module.Path, Package: path})
+		}
+		add(auditSecret{Kind: "source path", Value: lpkg.Dir, Package: path})
+		for _, name := range lpkg.CompiledGoFiles {
+			if filepath.IsAbs(name) {
+				continue // cgo files in the build cache
+			}
+			add(auditSecret{Kind: "source path", Value: lpkg.ImportPath + "/" + filepath.ToSlash(name), Package: path})
+		}
+
+		// parseFiles patches the first main package it sees with reflect code,
+		// which we don't want to leak between packages.
+		reflectPatchFile = ""
+		files, err := parseFiles(lpkg, lpkg.Dir, lpkg.CompiledGoFiles)
+		reflectPatchFile = ""
+		if err != nil {
+			return nil, err
+		}
+		pkg, info, err := typecheck(lpkg.ImportPath, files, importerForPkg(lpkg))
+		if err != nil {
+			return nil, err
+		}
+		for _, imp := range pkg.Imports() {
+			addKept(imp)
+		}
+		// Names kept via //garble:keep or garble.toml are expected to remain.
+		for key := range keptNames(lpkg, pkg, files, info) {
+			kept[key[strings.LastIndexByte(key, '.')+1:]] = true
+		}
+		allIdents = append(allIdents, pkgIdents{lpkg, auditIdentifiers(files)})
+
+		on, optIn := literalsSettingFor(lpkg, files)
+		if !on && !optIn {
+			continue
+		}
+		cfg := literalsBuilderConfigFor(lpkg, on)
+		for _, file := range files {
+			for _, lit := range auditLiterals(file, cfg) {
+				add(auditSecret{Kind: "literal", Value: lit, Package: path})
+			}
+		}
+	}
+	// Only now do we know all the names which aren't obfuscated.
+	for _, pi := range allIdents {
+		for _, name := range pi.idents {
+			if !kept[name] {
+				add(auditSecret{Kind: "identifier", Value: name, Package: pi.lpkg.ImportPath, word: true})
+			}
+		}
+	}
+	return secrets, nil
+}
+
+// auditIdentifiers returns the top-level names which are obfuscated in files.
+// Like reverseReplacer, it leaves out exported method names unless -force-rename is used.
+func auditIdentifiers(files []*ast.File) []string {
+	var names []string
+	add := func(name string) {
+		switch name {
+		case "_", "main", "init":
+		default:
+			names = append(names, name)
+		}
+	}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil || !token.IsExported(decl.Name.Name) || flagForceRename {
+					add(decl.Name.Name)
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						add(spec.Name.Name)
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							add(name.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// auditLiterals returns the string literals in file which -literals encrypts.
+// Constant declarations, import paths, struct tags, and the functions or files
+// whose literals are left alone per literals.Enabled are skipped.
+func auditLiterals(file *ast.File, cfg literals.BuilderConfig) []string {
+	var lits []string
+	tags := make(map[*ast.BasicLit]bool)
+	inspect := func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.GenDecl:
+			return node.Tok != token.CONST && node.Tok != token.IMPORT
+		case *ast.Field:
+			if node.Tag != nil {
+				tags[node.Tag] = true
+			}
+		case *ast.BasicLit:
+			if node.Kind == token.STRING && !tags[node] {
+				if s, err := strconv.Unquote(node.Value); err == nil {
+					lits = append(lits, s)
+				}
+			}
+		}
+		return true
+	}
+	topLevel := literals.Enabled(file, nil, cfg)
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			if literals.Enabled(file, fn, cfg) {
+				ast.Inspect(fn, inspect)
+			}
+		} else if topLevel {
+			ast.Inspect(decl, inspect)
+		}
+	}
+	return lits
+}
+
+// binarySection is the contents of a section in an executable file.
+type binarySection struct {
+	Name   string
+	Offset uint64 // in the file
+	Data   []byte
+}
+
+// readBinarySections reads the sections with contents from an ELF, PE, or Mach-O file.
+func readBinarySections(path string) ([]binarySection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sections []binarySection
+	if ef, err := elf.NewFile(f); err == nil {
+		for _, s := range ef.Sections {
+			if s.Type == elf.SHT_NOBITS || s.Size == 0 {
+				continue
+			}
+			data, err := s.Data()
+			if err != nil {
+				return nil, fmt.Errorf("%s: section %s: %v", path, s.Name, err)
+			}
+			sections = append(sections, binarySection{s.Name, s.Offset, data})
+		}
+		return sections, nil
+	}
+	if pf, err := pe.NewFile(f); err == nil {
+		for _, s := range pf.Sections {
+			if s.Size == 0 {
+				continue
+			}
+			data, err := s.Data()
+			if err != nil {
+				return nil, fmt.Errorf("%s: section %s: %v", path, s.Name, err)
+			}
+			sections = append(sections, binarySection{s.Name, uint64(s.Offset), data})
+		}
+		return sections, nil
+	}
+	if mf, err := macho.NewFile(f); err == nil {
+		const sectionTypeMask, zeroFill = 0xff, 0x1
+		for _, s := range mf.Sections {
+			if s.Size == 0 || s.Flags&sectionTypeMask == zeroFill {
+				continue
+			}
+			data, err := s.Data()
+			if err != nil {
+				return nil, fmt.Errorf("%s: section %s: %v", path, s.Name, err)
+			}
+			sections = append(sections, binarySection{s.Seg + "," + s.Name, uint64(s.Offset), data})
+		}
+		return sections, nil
+	}
+	return nil, fmt.Errorf("%s: not an ELF, PE, or Mach-O file", path)
+}
+
+// auditFinding is a secret found in a binary section.
+type auditFinding struct {
+	Section string
+	Offset  uint64 // of the first occurrence, in the file
+	Count   int
+
+	Kind    string
+	Value   string
+	Package string
+}
+
+// scanSections searches every section for every secret.
+// Findings are sorted by section and offset.
+func scanSections(sections []binarySection, secrets []auditSecret) []auditFinding {
+	var findings []auditFinding
+	for _, sec := range sections {
+		for _, secret := range secrets {
+			first, count := findSecret(sec.Data, []byte(secret.Value), secret.word)
+			if count == 0 {
+				continue
+			}
+			findings = append(findings, auditFinding{
+				Section: sec.Name,
+				Offset:  sec.Offset + uint64(first),
+				Count:   count,
+				Kind:    secret.Kind,
+				Value:   secret.Value,
+				Package: secret.Package,
+			})
+		}
+	}
+	slices.SortStableFunc(findings, func(a, b auditFinding) int {
+		return cmp.Or(
+			strings.Compare(a.Section, b.Section),
+			cmp.Compare(a.Offset, b.Offset),
+			strings.Compare(a.Value, b.Value),
+		)
+	})
+	return findings
+}
+
+// findSecret returns the index of the first occurrence of value in data,
+// and the number of occurrences. If word is true, occurrences which are
+// directly preceded or followed by an identifier character are ignored.
+func findSecret(data, value []byte, word bool) (first, count int) {
+	first = -1
+	for offset := 0; ; {
+		i := bytes.Index(data[offset:], value)
+		if i < 0 {
+			break
+		}
+		i += offset
+		offset = i + 1
+		if word {
+			if i > 0 && isIdentByte(data[i-1]) {
+				continue
+			}
+			if end := i + len(value); end < len(data) && isIdentByte(data[end]) {
+				continue
+			}
+		}
+		if first < 0 {
+			first = i
+		}
+		count++
+	}
+	return first, count
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b >= 0x80
+}
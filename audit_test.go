@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"slices"
+	"testing"
+)
+
+func TestFindSecret(t *testing.T) {
+	tests := []struct {
+		data, value string
+		word        bool
+		first       int
+		count       int
+	}{
+		{"main.secretFunc\x00", "secretFunc", true, 5, 1},
+		{"secretFuncs secretFunc_2 xsecretFunc", "secretFunc", true, -1, 0},
+		{"xsecretFunc secretFunc", "secretFunc", false, 1, 2},
+		{"", "secretFunc", false, -1, 0},
+		{"aaaa", "aa", false, 0, 3},
+	}
+	for _, test := range tests {
+		first, count := findSecret([]byte(test.data), []byte(test.value), test.word)
+		if first != test.first || count != test.count {
+			t.Errorf("findSecret(%q, %q, %v) = %d, %d; want %d, %d",
+				test.data, test.value, test.word, first, count, test.first, test.count)
+		}
+	}
+}
+
+func TestScanSections(t *testing.T) {
+	sections := []binarySection{
+		{Name: ".text", Offset: 100, Data: []byte("xx secretFunc")},
+		{Name: ".bss", Offset: 0, Data: []byte("secretVar secretFunc")},
+		{Name: ".data", Offset: 50, Data: []byte("secretVar")},
+	}
+	secrets := []auditSecret{
+		{Kind: "identifier", Value: "secretVar", word: true},
+		{Kind: "identifier", Value: "secretFunc", word: true},
+	}
+	var got []string
+	for _, finding := range scanSections(sections, secrets) {
+		got = append(got, fmt.Sprintf("%s+%d:%s", finding.Section, finding.Offset, finding.Value))
+	}
+	want := []string{".bss+0:secretVar", ".bss+10:secretFunc", ".data+50:secretVar", ".text+103:secretFunc"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("scanSections = %q; want %q", got, want)
+	}
+}
+
+func TestAuditIdentifiers(t *testing.T) {
+	src := `package p
+
+type secretType struct{ field int }
+
+var secretVar, _ = 1, 2
+
+func secretFunc() {}
+
+func (secretType) ExportedMethod()   {}
+func (secretType) unexportedMethod() {}
+
+func init() {}
+`
+	file, err := parser.ParseFile(fset, "test.go", src, 0)
+	if err != nil {
+		t.Fatalf("parse file: %v", err)
+	}
+	got := auditIdentifiers([]*ast.File{file})
+	want := []string{"secretType", "secretVar", "secretFunc", "unexportedMethod"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("auditIdentifiers = %q; want %q", got, want)
+	}
+}
+
+func TestCutAuditFlags(t *testing.T) {
+	rest, opts, err := cutAuditFlags([]string{"-tags=foo", "-json", "-min-length", "8", "-trimpath"})
+	if err != nil {
+		t.Fatalf("cutAuditFlags: %v", err)
+	}
+	if !opts.json || opts.minLength != 8 {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+	if want := []string{"-tags=foo", "-trimpath"}; !slices.Equal(rest, want) {
+		t.Fatalf("rest = %q; want %q", rest, want)
+	}
+	if _, _, err := cutAuditFlags([]string{"-min-length=zero"}); err == nil {
+		t.Fatalf("expected an error for an invalid -min-length")
+	}
+}
@@ -0,0 +1,433 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	cacheenc "github.com/AeonDave/garble/internal/cache"
+	"github.com/rogpeppe/go-internal/cache"
+)
+
+const cacheUsage = `
+usage: garble cache info
+       garble cache clean [-older-than=duration] [-max-size=size]
+       garble cache verify -seed=s
+
+Cache inspects and maintains the garble cache in GARBLE_CACHE,
+which defaults to a "garble" directory in the user's cache directory.
+
+Info prints the size of the cache, how many of its entries are encrypted,
+and which patched linker binaries it holds.
+
+Clean removes the entire cache by default. With -older-than, it only removes
+files which have not been used for the given duration, such as 720h.
+With -max-size, it removes the least recently used files of the build cache
+until it fits in the given size, such as 500M or 2G.
+
+Verify attempts to decrypt and authenticate every encrypted entry
+with the key derived from the build seed, and reports the entries which fail.
+Such entries were either tampered with or encrypted with a different seed.
+It exits with status 1 if any entry fails.
+
+Entries are only reused by builds with the same seed, since both their
+contents and the keys they are stored under depend on it. After changing the
+seed, the old entries are left unused until they are trimmed; use clean to
+remove them right away.
+`
+
+// commandCache implements "garble cache".
+func commandCache(args []string) error {
+	if len(args) == 0 || hasHelpFlag(args[:1]) {
+		_, _ = fmt.Fprint(os.Stderr, cacheUsage[1:])
+		return errJustExit(2)
+	}
+	sub, args := args[0], args[1:]
+	flags := flag.NewFlagSet("garble cache "+sub, flag.ContinueOnError)
+	flags.Usage = func() { _, _ = fmt.Fprint(os.Stderr, cacheUsage[1:]) }
+	var (
+		olderThan time.Duration
+		maxSize   sizeFlag
+		seed      seedFlag
+	)
+	switch sub {
+	case "info":
+	case "clean":
+		flags.DurationVar(&olderThan, "older-than", 0, "")
+		flags.Var(&maxSize, "max-size", "")
+	case "verify":
+		flags.Var(&seed, "seed", "")
+	default:
+		return fmt.Errorf("unknown cache command %q; see \"garble cache -h\"", sub)
+	}
+	if err := flags.Parse(args); err != nil {
+		return errJustExit(2)
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("garble cache %s takes no arguments", sub)
+	}
+	if seed.random {
+		return fmt.Errorf("garble cache %s needs the seed used by the builds, not a random one", sub)
+	}
+
+	dir, err := garbleCacheDir()
+	if err != nil {
+		return err
+	}
+	switch sub {
+	case "info":
+		return cacheInfo(os.Stdout, dir)
+	case "clean":
+		return cacheClean(os.Stdout, dir, olderThan, int64(maxSize))
+	case "verify":
+		if !seed.present() {
+			return fmt.Errorf("garble cache verify needs the seed used by the builds; use -seed")
+		}
+		failed, err := cacheVerify(os.Stdout, dir, seed.bytes)
+		if err != nil {
+			return err
+		}
+		if failed > 0 {
+			return errJustExit(1)
+		}
+		return nil
+	}
+	panic("unreachable")
+}
+
+// garbleCacheDir returns the absolute path to the GARBLE_CACHE directory,
+// which defaults to e.g. "~/.cache/garble".
+func garbleCacheDir() (string, error) {
+	if dir := os.Getenv("GARBLE_CACHE"); dir != "" {
+		return filepath.Abs(dir)
+	}
+	parentDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parentDir, "garble"), nil
+}
+
+// sizeFlag is a size in bytes, with an optional K, M, or G suffix
+// for powers of 1024.
+type sizeFlag int64
+
+func (f sizeFlag) String() string { return strconv.FormatInt(int64(f), 10) }
+
+func (f *sizeFlag) Set(s string) error {
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+	shift := 0
+	if n := len(num); n > 0 {
+		if i := strings.IndexByte("KMG", num[n-1]); i >= 0 {
+			shift = 10 * (i + 1)
+			num = num[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)>>shift {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*f = sizeFlag(n << shift)
+	return nil
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// cacheEntryKind classifies an entry in the build cache.
+type cacheEntryKind int
+
+const (
+	cacheEntryMissing   cacheEntryKind = iota // the index entry or its output file is unreadable
+	cacheEntryCorrupt                         // the output file does not match its checksum
+	cacheEntryPlaintext                       // a gob-encoded pkgCache
+	cacheEntryEncrypted                       // anything else, presumably encrypted with cacheenc
+)
+
+// buildCacheEntry is an action ID in the build cache and its output.
+type buildCacheEntry struct {
+	id         cache.ActionID
+	outputFile string
+	data       []byte
+	kind       cacheEntryKind
+}
+
+// readBuildCache reads all entries in the build cache under dir.
+// Unlike cache.Cache.Get, it does not update the modification times
+// which "garble cache clean -older-than" relies on.
+func readBuildCache(dir string) ([]*buildCacheEntry, error) {
+	buildDir := filepath.Join(dir, "build")
+	var entries []*buildCacheEntry
+	err := filepath.WalkDir(buildDir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == buildDir {
+			return filepath.SkipDir // an empty cache
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, ok := strings.CutSuffix(d.Name(), "-a")
+		if !ok {
+			return nil
+		}
+		entry := &buildCacheEntry{}
+		if n, err := hex.Decode(entry.id[:], []byte(name)); err != nil || n != len(entry.id) {
+			return nil // not a cache entry
+		}
+		entries = append(entries, entry)
+
+		// See the entry format in cache.Cache.Get: "v1 <action> <output> <size> <time>\n".
+		index, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		fields := strings.Fields(string(index))
+		if len(fields) != 5 || fields[0] != "v1" {
+			return nil
+		}
+		var outputID cache.OutputID
+		if n, err := hex.Decode(outputID[:], []byte(fields[2])); err != nil || n != len(outputID) {
+			return nil
+		}
+		entry.outputFile = filepath.Join(buildDir, fields[2][:2], fields[2]+"-d")
+		data, err := os.ReadFile(entry.outputFile)
+		if err != nil {
+			return nil
+		}
+		entry.data = data
+		switch {
+		case sha256.Sum256(data) != outputID:
+			entry.kind = cacheEntryCorrupt
+		case gob.NewDecoder(bytes.NewReader(data)).Decode(new(pkgCache)) == nil:
+			entry.kind = cacheEntryPlaintext
+		default:
+			entry.kind = cacheEntryEncrypted
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// dirSize returns the total size of the regular files under dir.
+func dirSize(dir string) (total int64, files int, _ error) {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == dir {
+			return filepath.SkipDir
+		}
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		files++
+		return nil
+	})
+	return total, files, err
+}
+
+// cacheInfo implements "garble cache info".
+func cacheInfo(w io.Writer, dir string) error {
+	total, _, err := dirSize(dir)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(w, "GARBLE_CACHE: %s\n", dir)
+	_, _ = fmt.Fprintf(w, "total size:   %s\n", formatSize(total))
+
+	buildSize, buildFiles, err := dirSize(filepath.Join(dir, "build"))
+	if err != nil {
+		return err
+	}
+	entries, err := readBuildCache(dir)
+	if err != nil {
+		return err
+	}
+	var counts [cacheEntryEncrypted + 1]int
+	for _, entry := range entries {
+		counts[entry.kind]++
+	}
+	_, _ = fmt.Fprintf(w, "build cache:  %s in %d files\n", formatSize(buildSize), buildFiles)
+	_, _ = fmt.Fprintf(w, "  entries:    %d\n", len(entries))
+	_, _ = fmt.Fprintf(w, "  encrypted:  %d\n", counts[cacheEntryEncrypted])
+	_, _ = fmt.Fprintf(w, "  plaintext:  %d\n", counts[cacheEntryPlaintext])
+	if n := counts[cacheEntryMissing] + counts[cacheEntryCorrupt]; n > 0 {
+		_, _ = fmt.Fprintf(w, "  unreadable: %d\n", n)
+	}
+
+	// See internal/linker.PatchLinker; the version file records
+	// the Go version and the linker patches the binary was built with.
+	linkers, err := filepath.Glob(filepath.Join(dir, "tool", "link*.version"))
+	if err != nil {
+		return err
+	}
+	for _, versionFile := range linkers {
+		binary := strings.TrimSuffix(versionFile, ".version")
+		info, err := os.Stat(binary)
+		if err != nil {
+			continue
+		}
+		version, _ := os.ReadFile(versionFile)
+		goVersion, patches, _ := strings.Cut(strings.TrimSpace(string(version)), " ")
+		_, _ = fmt.Fprintf(w, "linker:       %s with patches %.12s, %s\n", goVersion, patches, formatSize(info.Size()))
+	}
+	return nil
+}
+
+// cacheClean implements "garble cache clean".
+func cacheClean(w io.Writer, dir string, olderThan time.Duration, maxSize int64) error {
+	if olderThan <= 0 && maxSize <= 0 {
+		total, files, err := dirSize(dir)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "removed %d files, %s\n", files, formatSize(total))
+		return nil
+	}
+
+	type cacheFile struct {
+		paths   []string // removed together
+		build   bool     // part of the build cache
+		size    int64
+		modTime time.Time
+	}
+	var files []cacheFile
+	stat := func(build bool, paths ...string) {
+		info, err := os.Stat(paths[0])
+		if err != nil {
+			return
+		}
+		files = append(files, cacheFile{paths, build, info.Size(), info.ModTime()})
+	}
+	buildDir := filepath.Join(dir, "build")
+	err := filepath.WalkDir(buildDir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == buildDir {
+			return filepath.SkipDir
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		// Like cache.Cache.Trim, only consider index entries and outputs,
+		// leaving files like README and trim.txt alone.
+		if name := d.Name(); strings.HasSuffix(name, "-a") || strings.HasSuffix(name, "-d") {
+			stat(true, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var removeFiles []cacheFile
+	if olderThan > 0 {
+		// The patched linker is only worth removing if it has gone unused as well.
+		linkers, err := filepath.Glob(filepath.Join(dir, "tool", "link*.version"))
+		if err != nil {
+			return err
+		}
+		for _, versionFile := range linkers {
+			stat(false, strings.TrimSuffix(versionFile, ".version"), versionFile)
+		}
+		cutoff := time.Now().Add(-olderThan)
+		files = slices.DeleteFunc(files, func(f cacheFile) bool {
+			if f.modTime.Before(cutoff) {
+				removeFiles = append(removeFiles, f)
+				return true
+			}
+			return false
+		})
+	}
+	if maxSize > 0 {
+		var size int64
+		for _, f := range files {
+			if f.build {
+				size += f.size
+			}
+		}
+		// Remove the least recently used files first.
+		slices.SortFunc(files, func(a, b cacheFile) int { return a.modTime.Compare(b.modTime) })
+		for _, f := range files {
+			if size <= maxSize {
+				break
+			}
+			if !f.build {
+				continue
+			}
+			removeFiles = append(removeFiles, f)
+			size -= f.size
+		}
+	}
+
+	var removed int
+	var removedSize int64
+	for _, f := range removeFiles {
+		for _, path := range f.paths {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			removed++
+		}
+		removedSize += f.size
+	}
+	_, _ = fmt.Fprintf(w, "removed %d files, %s\n", removed, formatSize(removedSize))
+	return nil
+}
+
+// cacheVerify implements "garble cache verify",
+// returning the number of entries which failed to verify.
+func cacheVerify(w io.Writer, dir string, seed []byte) (failed int, _ error) {
+	entries, err := readBuildCache(dir)
+	if err != nil {
+		return 0, err
+	}
+	var verified, plaintext int
+	for _, entry := range entries {
+		switch entry.kind {
+		case cacheEntryMissing:
+			// Not an error; garble recomputes missing entries.
+			continue
+		case cacheEntryCorrupt:
+			_, _ = fmt.Fprintf(w, "%x: checksum mismatch\n", entry.id)
+			failed++
+		case cacheEntryPlaintext:
+			plaintext++
+		case cacheEntryEncrypted:
+			if err := cacheenc.Decrypt(entry.data, seed, new(pkgCache)); err != nil {
+				_, _ = fmt.Fprintf(w, "%x: %v\n", entry.id, err)
+				failed++
+				continue
+			}
+			verified++
+		}
+	}
+	_, _ = fmt.Fprintf(w, "verified %d encrypted entries; %d failed, %d not encrypted\n", verified, failed, plaintext)
+	return failed, nil
+}
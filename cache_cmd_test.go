@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cacheenc "github.com/AeonDave/garble/internal/cache"
+	"github.com/rogpeppe/go-internal/cache"
+)
+
+func TestCacheCommands(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "build"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	fsCache, err := cache.Open(filepath.Join(dir, "build"))
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+	oldSeed, newSeed := []byte("old seed"), []byte("new seed")
+	entry := pkgCache{ReflectObjectNames: map[objectString]string{"foo": "bar"}}
+	put := func(name string, data []byte) {
+		if _, _, err := fsCache.Put(cache.Subkey(cache.ActionID{}, name), bytes.NewReader(data)); err != nil {
+			t.Fatalf("put %s: %v", name, err)
+		}
+	}
+	var plain bytes.Buffer
+	if err := gob.NewEncoder(&plain).Encode(entry); err != nil {
+		t.Fatal(err)
+	}
+	put("plaintext", plain.Bytes())
+	for _, name := range []string{"encrypted-1", "encrypted-2"} {
+		data, err := cacheenc.Encrypt(entry, oldSeed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		put(name, data)
+	}
+
+	var out strings.Builder
+	if err := cacheInfo(&out, dir); err != nil {
+		t.Fatalf("cacheInfo: %v", err)
+	}
+	for _, want := range []string{"entries:    3\n", "encrypted:  2\n", "plaintext:  1\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("cacheInfo output lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	verify := func(seed []byte, wantFailed int) {
+		t.Helper()
+		out.Reset()
+		failed, err := cacheVerify(&out, dir, seed)
+		if err != nil {
+			t.Fatalf("cacheVerify: %v", err)
+		}
+		if failed != wantFailed {
+			t.Fatalf("cacheVerify failed %d entries, want %d:\n%s", failed, wantFailed, out.String())
+		}
+	}
+	verify(oldSeed, 0)
+	verify(newSeed, 2)
+
+	// Tampering with an output is reported.
+	entries, err := readBuildCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.kind == cacheEntryEncrypted {
+			entry.data[len(entry.data)-1] ^= 1
+			if err := os.WriteFile(entry.outputFile, entry.data, 0o666); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+	verify(oldSeed, 1)
+
+	// Everything was just used, so nothing is old enough to be removed.
+	out.Reset()
+	if err := cacheClean(&out, dir, time.Hour, 0); err != nil {
+		t.Fatalf("cacheClean: %v", err)
+	}
+	if want := "removed 0 files"; !strings.HasPrefix(out.String(), want) {
+		t.Fatalf("cacheClean output %q does not start with %q", out.String(), want)
+	}
+	out.Reset()
+	if err := cacheClean(&out, dir, 0, 1); err != nil {
+		t.Fatalf("cacheClean: %v", err)
+	}
+	if entries, err := readBuildCache(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("cacheClean -max-size left %d entries: %v", len(entries), err)
+	}
+	if err := cacheClean(&out, dir, 0, 0); err != nil {
+		t.Fatalf("cacheClean: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("cacheClean did not remove the cache: %v", err)
+	}
+}
+
+func TestSizeFlag(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"1024", 1024},
+		{"2K", 2 << 10},
+		{"500M", 500 << 20},
+		{"500MiB", 500 << 20},
+		{"3gb", 3 << 30},
+	}
+	for _, test := range tests {
+		var f sizeFlag
+		if err := f.Set(test.in); err != nil || int64(f) != test.want {
+			t.Errorf("Set(%q) = %d, %v; want %d", test.in, f, err, test.want)
+		}
+	}
+	for _, in := range []string{"", "M", "-1", "10T", "1.5G"} {
+		var f sizeFlag
+		if err := f.Set(in); err == nil {
+			t.Errorf("Set(%q) did not fail", in)
+		}
+	}
+}
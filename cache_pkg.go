@@ -52,11 +52,27 @@ type pkgCache struct {
 	// ReflectObjectNames maps obfuscated names which are reflected to their original
 	// non-obfuscated names.
 	ReflectObjectNames map[objectString]string
+
+	// ResaltedNames records the names which had to be re-salted to avoid
+	// hash collisions, so that dependent packages use the same names.
+	// See resaltNames.
+	ResaltedNames map[string]string
+
+	// KeptNames records the names which must not be obfuscated
+	// because of //garble:keep directives or garble.toml keep patterns,
+	// keyed as per keepKey.
+	KeptNames map[string]bool
+
+	// ConvertedConsts is only set in the entry where analyzeConsts stores
+	// its result for a whole program; see convertedConstsKey.
+	ConvertedConsts map[string]bool
 }
 
 func (c *pkgCache) CopyFrom(c2 pkgCache) {
 	maps.Copy(c.ReflectAPIs, c2.ReflectAPIs)
 	maps.Copy(c.ReflectObjectNames, c2.ReflectObjectNames)
+	maps.Copy(c.ResaltedNames, c2.ResaltedNames)
+	maps.Copy(c.KeptNames, c2.KeptNames)
 }
 
 func cacheEncryptionSeed() ([]byte, bool) {
@@ -154,6 +170,11 @@ func parseFiles(lpkg *listedPackage, dir string, paths []string) (files []*ast.F
 			if err != nil {
 				return nil, err
 			}
+		} else if lpkg.ImportPath == "reflect" && base == "type.go" && flagEncryptTags {
+			src, err = reflectTagPatch(path)
+			if err != nil {
+				return nil, err
+			}
 		} else if mainPackage && hasReflectTemplate && base == "reflect_abi_code.go" && reflectPatchFile == "" {
 			content, err := os.ReadFile(path)
 			if err != nil {
@@ -190,31 +211,16 @@ func parseFiles(lpkg *listedPackage, dir string, paths []string) (files []*ast.F
 
 func loadPkgCache(lpkg *listedPackage, pkg *types.Package, files []*ast.File, info *types.Info, ssaPkg *ssa.Package) (pkgCache, error) {
 	key := lpkg.GarbleActionID
-	pkgCacheMu.Lock()
-	if cached, ok := pkgCacheMem[key]; ok {
-		pkgCacheMu.Unlock()
-		return cached, nil
-	}
-	pkgCacheMu.Unlock()
-
 	fsCache, err := openCache()
 	if err != nil {
 		return pkgCache{}, err
 	}
-	filename, _, err := fsCache.GetFile(lpkg.GarbleActionID)
 	// Already in the cache; load it directly.
-	if err == nil {
-		if data, readErr := os.ReadFile(filename); readErr == nil {
-			if decoded, decodeErr := decodePkgCacheBytes(data); decodeErr == nil {
-				pkgCacheMu.Lock()
-				pkgCacheMem[key] = decoded
-				pkgCacheMu.Unlock()
-				return decoded, nil
-			}
-		}
-		// Cache load failed - treat as cache miss and recompute
-		// (This handles corrupted cache, incompatible format, etc.)
+	if cached, ok := cachedPkgCache(fsCache, lpkg); ok {
+		return cached, nil
 	}
+	// Cache load failed - treat as cache miss and recompute
+	// (This handles corrupted cache, incompatible format, etc.)
 	computed, err := computePkgCache(fsCache, lpkg, pkg, files, info, ssaPkg)
 	if err != nil {
 		return pkgCache{}, err
@@ -225,6 +231,35 @@ func loadPkgCache(lpkg *listedPackage, pkg *types.Package, files []*ast.File, in
 	return computed, nil
 }
 
+// cachedPkgCache returns a package's cache entry if it was already computed,
+// such as by an earlier compilation of the package.
+func cachedPkgCache(fsCache *cache.Cache, lpkg *listedPackage) (pkgCache, bool) {
+	key := lpkg.GarbleActionID
+	pkgCacheMu.Lock()
+	if cached, ok := pkgCacheMem[key]; ok {
+		pkgCacheMu.Unlock()
+		return cached, true
+	}
+	pkgCacheMu.Unlock()
+
+	filename, _, err := fsCache.GetFile(key)
+	if err != nil {
+		return pkgCache{}, false
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return pkgCache{}, false
+	}
+	decoded, err := decodePkgCacheBytes(data)
+	if err != nil {
+		return pkgCache{}, false
+	}
+	pkgCacheMu.Lock()
+	pkgCacheMem[key] = decoded
+	pkgCacheMu.Unlock()
+	return decoded, true
+}
+
 func computePkgCache(fsCache *cache.Cache, lpkg *listedPackage, pkg *types.Package, files []*ast.File, info *types.Info, ssaPkg *ssa.Package) (pkgCache, error) {
 	// Not yet in the cache. Load the cache entries for all direct dependencies,
 	// build our cache entry, and write it to disk.
@@ -237,6 +272,8 @@ func computePkgCache(fsCache *cache.Cache, lpkg *listedPackage, pkg *types.Packa
 			"reflect.ValueOf": {0: true},
 		},
 		ReflectObjectNames: map[objectString]string{},
+		ResaltedNames:      map[string]string{},
+		KeptNames:          map[string]bool{},
 	}
 	for _, imp := range lpkg.Imports {
 		if imp == "C" {
@@ -286,42 +323,54 @@ func computePkgCache(fsCache *cache.Cache, lpkg *listedPackage, pkg *types.Packa
 		}
 	}
 
+	if lpkg.ToObfuscate {
+		resalted, err := resaltNamesFromSource(lpkg)
+		if err != nil {
+			return pkgCache{}, err
+		}
+		maps.Copy(computed.ResaltedNames, resalted)
+		maps.Copy(computed.KeptNames, keptNames(lpkg, pkg, files, info))
+	}
+
 	// Fill the reflect info from SSA, which builds on top of the syntax tree and type info.
+	lookups, lookupOnly := reflectLookups(pkg, files, info)
 	inspector := reflectInspector{
 		lpkg:            lpkg,
 		pkg:             pkg,
 		checkedAPIs:     make(map[string]bool),
 		propagatedInstr: map[ssa.Instruction]bool{},
+		lookupOnly:      lookupOnly,
 		result:          computed, // append the results
 	}
 	if ssaPkg == nil {
 		ssaPkg = ssaBuildPkg(pkg, files, info)
 	}
+	inspector.recordLookups(lookups)
 	inspector.recordReflection(ssaPkg)
 
+	if err := putPkgCache(fsCache, lpkg.GarbleActionID, computed); err != nil {
+		return pkgCache{}, err
+	}
+	return computed, nil
+}
+
+// putPkgCache writes a package's cache entry to disk.
+func putPkgCache(fsCache *cache.Cache, key [sha256.Size]byte, computed pkgCache) error {
 	// Encrypt cache if flag enabled and seed present
 	// Use sharedCache.OriginalSeed (shared across toolexec processes)
 	if seed, _ := cacheEncryptionSeed(); len(seed) > 0 {
 		encrypted, err := cacheenc.Encrypt(computed, seed)
 		if err != nil {
-			return pkgCache{}, fmt.Errorf("cache encryption failed: %v", err)
-		}
-
-		if err := fsCache.PutBytes(lpkg.GarbleActionID, encrypted); err != nil {
-			return pkgCache{}, err
-		}
-	} else {
-		// Fallback: unencrypted gob encoding
-		var buf bytes.Buffer
-		if err := gob.NewEncoder(&buf).Encode(computed); err != nil {
-			return pkgCache{}, err
-		}
-		if err := fsCache.PutBytes(lpkg.GarbleActionID, buf.Bytes()); err != nil {
-			return pkgCache{}, err
+			return fmt.Errorf("cache encryption failed: %v", err)
 		}
+		return fsCache.PutBytes(key, encrypted)
 	}
-
-	return computed, nil
+	// Fallback: unencrypted gob encoding
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(computed); err != nil {
+		return err
+	}
+	return fsCache.PutBytes(key, buf.Bytes())
 }
 
 type importerWithMap struct {
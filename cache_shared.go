@@ -19,6 +19,8 @@ import (
 	"time"
 
 	"golang.org/x/mod/module"
+
+	"github.com/AeonDave/garble/internal/config"
 )
 
 //go:generate go run scripts/gen_go_std_tables.go
@@ -58,6 +60,20 @@ type sharedCacheType struct {
 
 	GOGARBLE string
 
+	// Config holds the settings from garble.toml, if the main module has one.
+	Config *config.Config
+
+	// RenamedMethods holds the exported methods which -force-rename=auto
+	// found safe to rename, keyed as per methodKey.
+	RenamedMethods map[string]bool
+	// RenamedExports holds the exported top-level names which -force-rename=auto
+	// found to only be used in their own package, keyed as per resaltKey.
+	RenamedExports map[string]bool
+	// ConvertedConsts holds the exported string constants which -literals
+	// may rewrite into variables, as found by analyzeConsts and keyed as per
+	// resaltKey. It is nil if no analysis was done.
+	ConvertedConsts map[string]bool
+
 	// GoCmd is [GoEnv.GOROOT]/bin/go, so that we run exactly the same version
 	// of the Go tool that the original "go build" invocation did.
 	GoCmd string
@@ -163,6 +179,7 @@ type listedPackage struct {
 	BuildID    string
 	ImportMap  map[string]string
 	Standard   bool
+	DepOnly    bool
 
 	Dir             string
 	CompiledGoFiles []string // all .go files to build
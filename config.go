@@ -0,0 +1,179 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ah "github.com/AeonDave/garble/internal/asthelper"
+	"github.com/AeonDave/garble/internal/config"
+	"github.com/AeonDave/garble/internal/ctrlflow"
+	"github.com/AeonDave/garble/internal/literals"
+)
+
+// loadProjectConfig loads the garble.toml file next to the main module's go.mod,
+// if there is one, and applies its settings to sharedCache and the global flags.
+//
+// Flags given on the command line and environment variables which are set
+// take precedence over the file, so a developer can still override it.
+// When reproducing a build manifest, its recorded settings are used instead,
+// even if garble.toml has changed or is missing.
+// It must be called after fetchGoEnv and before generateBuildNonce.
+func loadProjectConfig() error {
+	var cfg *config.Config
+	source := "the build manifest"
+	if appliedManifest != nil {
+		cfg = appliedManifest.Config
+	} else {
+		gomod := sharedCache.GoEnv.GOMOD
+		if gomod == "" || gomod == os.DevNull {
+			return nil // not in a module
+		}
+		var err error
+		if cfg, err = config.Load(filepath.Dir(gomod)); err != nil {
+			return err
+		}
+		source = filepath.Join(filepath.Dir(gomod), config.FileName)
+	}
+	if cfg == nil {
+		return nil
+	}
+
+	setFlags := make(map[string]bool)
+	flagSet.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	if cfg.Literals != nil && !setFlags["literals"] {
+		flagLiterals = *cfg.Literals
+	}
+	if cfg.Tiny != nil && !setFlags["tiny"] {
+		flagTiny = *cfg.Tiny
+	}
+	if cfg.ForceRename != "" && !setFlags["force-rename"] {
+		if err := forceRenameFlagValue.Set(cfg.ForceRename); err != nil {
+			return err // already validated by config.Parse
+		}
+	}
+	if cfg.ControlFlow != "" && !controlFlowFlagValue.set && os.Getenv("GARBLE_CONTROLFLOW") == "" {
+		mode, err := ctrlflow.ParseMode(cfg.ControlFlow)
+		if err != nil {
+			return err // already validated by config.Parse
+		}
+		flagControlFlowMode = mode
+		controlFlowFlagValue.mode = mode
+	}
+
+	// The toolexec sub-processes inherit these.
+	if cfg.GOGARBLE != "" && os.Getenv("GOGARBLE") == "" {
+		sharedCache.GOGARBLE = cfg.GOGARBLE
+		_ = os.Setenv("GOGARBLE", cfg.GOGARBLE)
+	}
+	if cfg.BuildNonce != "" && os.Getenv("GARBLE_BUILD_NONCE") == "" {
+		_ = os.Setenv("GARBLE_BUILD_NONCE", cfg.BuildNonce)
+	}
+	if len(cfg.ControlFlowSkipPackages) > 0 && os.Getenv("GARBLE_CONTROLFLOW_SKIP_PKGS") == "" {
+		_ = os.Setenv("GARBLE_CONTROLFLOW_SKIP_PKGS", strings.Join(cfg.ControlFlowSkipPackages, ","))
+	}
+
+	log.Printf("loaded %s settings from %s", config.FileName, source)
+	sharedCache.Config = cfg
+	return nil
+}
+
+// literalsEnabled reports whether literals should be obfuscated in the current package,
+// taking garble.toml's package rules into account.
+func (tf *transformer) literalsEnabled() bool {
+	return literalsEnabledFor(tf.curPkg)
+}
+
+func literalsEnabledFor(lpkg *listedPackage) bool {
+	return lpkg.ToObfuscate && sharedCache.Config.LiteralsFor(lpkg.ImportPath, flagLiterals)
+}
+
+// literalsBuilderConfig applies garble.toml's function rules to literal obfuscation.
+func (tf *transformer) literalsBuilderConfig() literals.BuilderConfig {
+	cfg := literalsBuilderConfigFor(tf.curPkg, tf.literalsOn)
+	cfg.Cache = tf.literalsCache
+	cfg.HashCompare = tf.literalsHash
+	cfg.Numbers = tf.literalsNumbers
+	return cfg
+}
+
+// literalsBuilderConfigFor is like literalsBuilderConfig for any package,
+// where on is whether its literals are obfuscated by default.
+func literalsBuilderConfigFor(lpkg *listedPackage, on bool) literals.BuilderConfig {
+	cfg := literals.BuilderConfig{Disabled: !on}
+	if sharedCache.Config.HasFuncLiterals() {
+		cfg.SkipFunc = func(decl *ast.FuncDecl) bool {
+			return !sharedCache.Config.FuncLiteralsFor(lpkg.ImportPath, ah.FuncDeclName(decl), true)
+		}
+	}
+	return cfg
+}
+
+// literalsSettingFor returns whether a package's literals are obfuscated by
+// default, taking a directive on its package clause into account,
+// and whether any of its functions or files opt in with a directive.
+func literalsSettingFor(lpkg *listedPackage, files []*ast.File) (on, optIn bool) {
+	if !lpkg.ToObfuscate {
+		return false, false
+	}
+	on = literalsEnabledFor(lpkg)
+	if dirOn, ok := literals.PackageDirective(files); ok {
+		on = dirOn
+	}
+	return on, literals.HasOptIn(files)
+}
+
+// literalsCacheFor returns whether a package's string literals are decrypted
+// at most once by default, taking a directive on its package clause into account.
+func literalsCacheFor(files []*ast.File) bool {
+	if cache, ok := literals.PackageCacheDirective(files); ok {
+		return cache
+	}
+	return flagLiteralsCache
+}
+
+// literalsHashFor is like literalsCacheFor, for comparing keyed hashes
+// as per -literals-hash.
+func literalsHashFor(files []*ast.File) bool {
+	if hash, ok := literals.PackageHashDirective(files); ok {
+		return hash
+	}
+	return flagLiteralsHash
+}
+
+// literalsSkipped returns the functions and files of a package whose literals
+// are not obfuscated even though the rest of the package's are, as per literals.Skipped.
+func literalsSkipped(lpkg *listedPackage, files []*ast.File, on bool) map[string]string {
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = filepath.Base(fset.Position(file.Package).Filename)
+	}
+	return literals.Skipped(files, names, literalsBuilderConfigFor(lpkg, on))
+}
+
+// controlFlowOverride applies garble.toml's rules to control-flow obfuscation,
+// returning nil if there is no garble.toml.
+func (tf *transformer) controlFlowOverride() func(funcName string) ctrlflow.Override {
+	if sharedCache.Config == nil {
+		return nil
+	}
+	return func(funcName string) ctrlflow.Override {
+		return sharedCache.Config.FuncOverride(tf.curPkg.ImportPath, funcName)
+	}
+}
+
+// projectConfigHashInput is added to buildFlagHashInput,
+// as garble.toml's package and function rules affect the obfuscated output.
+func projectConfigHashInput() string {
+	if sharedCache.Config == nil {
+		return ""
+	}
+	return fmt.Sprintf(" %s=%x", config.FileName, sharedCache.Config.Hash())
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"go/constant"
+	"go/types"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/AeonDave/garble/internal/consts"
+)
+
+// analyzeConsts fills sharedCache.ConvertedConsts with the exported string
+// constants which -literals may rewrite into variables, as no package in the
+// build requires them to be constants; see consts.ComputeTransforms.
+//
+// Like analyzeProgram, this needs to see every package which may use a name,
+// so only executable builds are analyzed, and test binaries are left alone.
+// We only type-check the packages whose constants may be converted,
+// and those which import any of them, and the result is stored in the cache
+// under convertedConstsKey so that rebuilds of the same program skip that. Constants stay constants if their
+// package is imported by a package which is not obfuscated, as we do not
+// type-check those, or if it has assembly, which may use them via go_asm.h.
+func analyzeConsts(command string, flags []string) error {
+	candidatePkgs := make(map[string]bool)
+	for path, lpkg := range sharedCache.ListedPackages {
+		if literalsEnabledFor(lpkg) && len(lpkg.SFiles) == 0 {
+			candidatePkgs[path] = true
+		}
+	}
+	if len(candidatePkgs) == 0 {
+		return nil
+	}
+	if command == "test" || !buildsExecutable(command, flags) {
+		log.Printf("-literals: not building an executable; exported constants stay constants")
+		return nil
+	}
+	startTime := time.Now()
+	fsCache, err := openCache()
+	if err != nil {
+		return err
+	}
+	key := convertedConstsKey()
+	if filename, _, err := fsCache.GetFile(key); err == nil {
+		if data, err := os.ReadFile(filename); err == nil {
+			if cached, err := decodePkgCacheBytes(data); err == nil {
+				setConvertedConsts(cached.ConvertedConsts)
+				log.Printf("-literals: %d exported string constants may become variables, as cached",
+					len(sharedCache.ConvertedConsts))
+				return nil
+			}
+		}
+	}
+
+	for _, lpkg := range sharedCache.ListedPackages {
+		if !lpkg.ToObfuscate && len(lpkg.CompiledGoFiles) > 0 {
+			for _, imp := range lpkg.Imports {
+				delete(candidatePkgs, imp)
+			}
+		}
+	}
+
+	var candidates []string
+	required := make(map[string]bool)
+	for _, path := range slices.Sorted(maps.Keys(sharedCache.ListedPackages)) {
+		lpkg := sharedCache.ListedPackages[path]
+		if !lpkg.ToObfuscate || len(lpkg.CompiledGoFiles) == 0 {
+			continue
+		}
+		if !candidatePkgs[path] && !slices.ContainsFunc(lpkg.Imports, func(imp string) bool { return candidatePkgs[imp] }) {
+			continue
+		}
+
+		// parseFiles patches the first main package it sees with reflect code,
+		// which we don't want to leak between packages.
+		reflectPatchFile = ""
+		files, err := parseFiles(lpkg, lpkg.Dir, lpkg.CompiledGoFiles)
+		reflectPatchFile = ""
+		if err != nil {
+			return err
+		}
+		pkg, info, err := typecheck(lpkg.ImportPath, files, importerForPkg(lpkg))
+		if err != nil {
+			return fmt.Errorf("-literals: %v", err)
+		}
+		for _, obj := range consts.RequiredImports(files, info, pkg) {
+			required[resaltKey(obj.Pkg().Path(), obj.Name())] = true
+		}
+		if !candidatePkgs[path] {
+			continue
+		}
+		scope := pkg.Scope()
+		for _, name := range scope.Names() {
+			obj, ok := scope.Lookup(name).(*types.Const)
+			if ok && obj.Exported() && obj.Val().Kind() == constant.String {
+				candidates = append(candidates, resaltKey(path, name))
+			}
+		}
+	}
+
+	converted := make(map[string]bool)
+	for _, key := range candidates {
+		if !required[key] {
+			converted[key] = true
+		}
+	}
+	log.Printf("-literals: %d of %d exported string constants may become variables in %s",
+		len(converted), len(candidates), debugSince(startTime))
+	if err := putPkgCache(fsCache, key, pkgCache{ConvertedConsts: converted}); err != nil {
+		return err
+	}
+	setConvertedConsts(converted)
+	return nil
+}
+
+// setConvertedConsts sets sharedCache.ConvertedConsts to the result of analyzeConsts.
+func setConvertedConsts(converted map[string]bool) {
+	if converted == nil {
+		converted = make(map[string]bool) // gob drops empty maps
+	}
+	sharedCache.ConvertedConsts = converted
+
+	// Which constants are converted in a package depends on the whole program,
+	// so the result must be part of every package's action ID.
+	resetGarbleActionIDs()
+}
+
+// convertedConstsKey returns the cache key for the result of analyzeConsts.
+// Each package's action ID covers its source and that of its dependencies,
+// as well as garble's flags, and the result also depends on which packages
+// are obfuscated and have their literals obfuscated.
+// It must be called before setConvertedConsts, which changes the action IDs.
+func convertedConstsKey() [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte("garble converted-consts\n"))
+	for _, path := range slices.Sorted(maps.Keys(sharedCache.ListedPackages)) {
+		lpkg := sharedCache.ListedPackages[path]
+		fmt.Fprintf(h, "%s %x %t %t\n", path, lpkg.GarbleActionID, lpkg.ToObfuscate, literalsEnabledFor(lpkg))
+	}
+	return [sha256.Size]byte(h.Sum(nil))
+}
+
+// convertedConstsHashInput is added to buildFlagHashInput,
+// as the constants found by analyzeConsts affect the obfuscated output.
+func convertedConstsHashInput() string {
+	if sharedCache.ConvertedConsts == nil {
+		return ""
+	}
+	h := sha256.New()
+	for _, key := range slices.Sorted(maps.Keys(sharedCache.ConvertedConsts)) {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf(" converted-consts=%x", h.Sum(nil))
+}
+
+// exportedConstConverted reports whether an exported constant in the current
+// package may be rewritten into a variable, as per analyzeConsts.
+func (tf *transformer) exportedConstConverted(obj *types.Const) bool {
+	return sharedCache.ConvertedConsts[resaltKey(tf.curPkg.ImportPath, obj.Name())]
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"go/ast"
+	"go/constant"
 	"go/parser"
+	"go/printer"
 	"go/token"
 	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
 	"testing"
 
 	consts "github.com/AeonDave/garble/internal/consts"
@@ -63,9 +70,9 @@ var _ = needsConst(sink)
 `
 
 	file, pkg, info := parseConstFixture(t, src)
-	transforms := consts.ComputeTransforms([]*ast.File{file}, info, pkg)
+	transforms := consts.ComputeTransforms([]*ast.File{file}, info, pkg, nil)
 
-	qt.Assert(t, qt.HasLen(transforms, 1))
+	qt.Assert(t, qt.HasLen(transforms, 2))
 
 	runtimeObj, _ := pkg.Scope().Lookup("runtimeConst").(*types.Const)
 	qt.Assert(t, qt.IsNotNil(runtimeObj))
@@ -75,7 +82,7 @@ var _ = needsConst(sink)
 	qt.Assert(t, qt.IsFalse(hasArray))
 
 	_, hasAlias := transforms[pkg.Scope().Lookup("aliasConst").(*types.Const)]
-	qt.Assert(t, qt.IsFalse(hasAlias))
+	qt.Assert(t, qt.IsTrue(hasAlias))
 
 	_, hasExported := transforms[pkg.Scope().Lookup("ExportedConst").(*types.Const)]
 	qt.Assert(t, qt.IsFalse(hasExported))
@@ -111,7 +118,7 @@ var _ = wantsConst(sink)
 `
 
 	file, pkg, info := parseConstFixture(t, src)
-	transforms := consts.ComputeTransforms([]*ast.File{file}, info, pkg)
+	transforms := consts.ComputeTransforms([]*ast.File{file}, info, pkg, nil)
 
 	runtimeObj := pkg.Scope().Lookup("runtimeSecret").(*types.Const)
 	caseObj := pkg.Scope().Lookup("caseLabel").(*types.Const)
@@ -204,3 +211,221 @@ func findDefIdent(t *testing.T, info *types.Info, name string) *ast.Ident {
 	t.Fatalf("definition for %q not found", name)
 	return nil
 }
+
+func TestRewriteConstDeclsFoldsAndKeepsTypes(t *testing.T) {
+	t.Parallel()
+
+	const src = `package sample
+
+type Endpoint string
+
+const prefix = "https://"
+
+const (
+	full           = prefix + "example.com"
+	login Endpoint = prefix + "login"
+	Exported       = "public"
+	Kept           = "kept"
+	untypedNamed   = "named"
+)
+
+var (
+	sink                = full + string(login) + Exported + Kept
+	endpoint Endpoint   = untypedNamed
+	_        = endpoint == login
+)
+`
+	file, pkg, info := parseConstFixture(t, src)
+	transforms := consts.ComputeTransforms([]*ast.File{file}, info, pkg, func(obj *types.Const) bool {
+		return obj.Name() == "Exported"
+	})
+
+	var got []string
+	for obj := range transforms {
+		got = append(got, obj.Name())
+	}
+	slices.Sort(got)
+	// prefix is used in constant expressions, Kept is not allowed by the
+	// callback, and untypedNamed is implicitly converted to Endpoint.
+	qt.Assert(t, qt.DeepEquals(got, []string{"Exported", "full", "login"}))
+
+	consts.RewriteDecls(file, info, transforms)
+
+	var buf bytes.Buffer
+	qt.Assert(t, qt.IsNil(printer.Fprint(&buf, token.NewFileSet(), file)))
+	out := buf.String()
+	qt.Assert(t, qt.StringContains(out, `var full = "https://example.com"`))
+	qt.Assert(t, qt.StringContains(out, `var login = Endpoint("https://login")`))
+	qt.Assert(t, qt.StringContains(out, `var Exported = "public"`))
+
+	// The folded literals are recorded as strings, so they can be obfuscated.
+	loginObj := pkg.Scope().Lookup("login").(*types.Const)
+	qt.Assert(t, qt.Equals(transforms[loginObj].VarObj.Type(), loginObj.Type()))
+	var lits []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok {
+			if tv := info.Types[lit]; tv.Type == types.Typ[types.String] && tv.Value != nil {
+				lits = append(lits, constant.StringVal(tv.Value))
+			}
+		}
+		return true
+	})
+	qt.Assert(t, qt.IsTrue(slices.Contains(lits, "https://login")))
+
+	// The result must still type-check.
+	fset := token.NewFileSet()
+	reparsed, err := parser.ParseFile(fset, "fixture.go", out, 0)
+	qt.Assert(t, qt.IsNil(err))
+	_, err = new(types.Config).Check("test/consts", fset, []*ast.File{reparsed}, nil)
+	qt.Assert(t, qt.IsNil(err))
+}
+
+func TestRequiredImportsFindsConstContexts(t *testing.T) {
+	t.Parallel()
+
+	fset := token.NewFileSet()
+	depFile, err := parser.ParseFile(fset, "dep.go", `package dep
+
+type Endpoint string
+
+const (
+	Runtime  = "runtime"
+	Case     = "case"
+	Length   = "length"
+	Untyped  = "untyped"
+	Typed    Endpoint = "typed"
+)
+`, 0)
+	qt.Assert(t, qt.IsNil(err))
+	dep, err := new(types.Config).Check("test/dep", fset, []*ast.File{depFile}, nil)
+	qt.Assert(t, qt.IsNil(err))
+
+	file, err := parser.ParseFile(fset, "main.go", `package main
+
+import "test/dep"
+
+const local = "local"
+
+var (
+	sink = dep.Runtime + string(dep.Typed) + local
+	arr  [len(dep.Length)]byte
+	e    dep.Endpoint = dep.Untyped
+)
+
+func main() {
+	switch sink {
+	case dep.Case, local:
+	}
+	_ = dep.Typed
+}
+`, 0)
+	qt.Assert(t, qt.IsNil(err))
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{Importer: importerFunc(func(string) (*types.Package, error) { return dep, nil })}
+	pkg, err := conf.Check("test/main", fset, []*ast.File{file}, info)
+	qt.Assert(t, qt.IsNil(err))
+
+	var got []string
+	for _, obj := range consts.RequiredImports([]*ast.File{file}, info, pkg) {
+		got = append(got, obj.Name())
+	}
+	slices.Sort(got)
+	qt.Assert(t, qt.DeepEquals(got, []string{"Case", "Length", "Untyped"}))
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+func TestLowerStringSwitches(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("builds a binary")
+	}
+
+	const src = `package main
+
+type verb string
+
+const (
+	activate      = "activate-license"
+	revoke   verb = "revoke-license"
+)
+
+var calls int
+
+func next(s string) string {
+	calls++
+	return s
+}
+
+func classify(s string) string {
+	tag := "outer"
+	switch x := next(s); x {
+	case "b", activate:
+		return "activate " + tag
+	default:
+		return "default " + x
+	case "c":
+		fallthrough
+	case "d":
+		return "c or d"
+	}
+}
+
+func named(v verb) string {
+loop:
+	for i := 0; ; i++ {
+		switch v {
+		case revoke:
+			if i == 0 {
+				continue
+			}
+			break loop
+		case "status", "":
+			break
+		}
+		return "named " + string(v)
+	}
+	return "revoked"
+}
+
+func main() {
+	for _, s := range []string{"b", "activate-license", "c", "d", "other"} {
+		println(classify(s))
+	}
+	println(named("revoke-license"), named("status"), named(""), calls)
+}
+`
+	file, pkg, info := parseConstFixture(t, src)
+	var lowered int
+	for _, decl := range file.Decls {
+		lowered += consts.LowerStringSwitches(decl, info, pkg)
+	}
+	qt.Assert(t, qt.Equals(lowered, 2))
+
+	// The constant used only in a case is no longer required to be one.
+	transforms := consts.ComputeTransforms([]*ast.File{file}, info, pkg, nil)
+	qt.Assert(t, qt.IsNotNil(transforms[pkg.Scope().Lookup("activate").(*types.Const)]))
+
+	var buf bytes.Buffer
+	qt.Assert(t, qt.IsNil(printer.Fprint(&buf, token.NewFileSet(), file)))
+	code := buf.String()
+	// The name of the variable holding the tag must not shadow another.
+	qt.Assert(t, qt.StringContains(code, `tag1 == activate`))
+	qt.Assert(t, qt.StringContains(code, `tag == "revoke-license"`))
+	qt.Assert(t, qt.Not(qt.StringContains(code, "case revoke")))
+
+	dir := t.TempDir()
+	run := func(src string) string {
+		path := filepath.Join(dir, "main.go")
+		qt.Assert(t, qt.IsNil(os.WriteFile(path, []byte(src), 0o666)))
+		out, err := exec.Command("go", "run", path).CombinedOutput()
+		qt.Assert(t, qt.IsNil(err), qt.Commentf("%s\n%s", out, src))
+		return string(out)
+	}
+	qt.Assert(t, qt.Equals(run(code), run(src)))
+}
@@ -0,0 +1,466 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/AeonDave/garble/internal/literals"
+)
+
+//go:embed embed_fs_code.go
+var embedFSCode string
+
+// embedFileName is the name of the file added to packages whose embedded files
+// are encrypted, holding the code from embed_fs_code.go.
+const embedFileName = "_embed_fs.go"
+
+// embedConfig is the file which the go command passes to the compiler via
+// -embedcfg. Patterns maps each //go:embed pattern to the names of the files it
+// matches, and Files maps each of those names to the file's path on disk.
+type embedConfig struct {
+	Patterns map[string][]string
+	Files    map[string]string
+}
+
+type embedKind int
+
+const (
+	embedString embedKind = iota
+	embedBytes
+	embedFS
+)
+
+// embedVar is a package-level variable with //go:embed directives.
+type embedVar struct {
+	file *ast.File
+	spec *ast.ValueSpec
+	obj  *types.Var
+	kind embedKind
+
+	directives []*ast.Comment
+	patterns   []string
+}
+
+// embedKey returns the key used to encrypt a package's embedded files.
+// It changes with every build, unless -seed is used.
+func embedKey(lpkg *listedPackage) (k0, k1 uint64) {
+	h := sha256.New()
+	h.Write([]byte("garble embed"))
+	h.Write(seedHashInput())
+	h.Write([]byte(lpkg.ImportPath))
+	sum := h.Sum(nil)
+	return binary.LittleEndian.Uint64(sum[:8]), binary.LittleEndian.Uint64(sum[8:16])
+}
+
+// findEmbedVars returns the variables with //go:embed directives in files,
+// in the order they are declared.
+func findEmbedVars(files []*ast.File, info *types.Info) ([]*embedVar, error) {
+	var vars []*embedVar
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.ValueSpec)
+				doc := spec.Doc
+				if doc == nil && !decl.Lparen.IsValid() {
+					doc = decl.Doc
+				}
+				v := &embedVar{file: file, spec: spec}
+				if doc != nil {
+					for _, comment := range doc.List {
+						args, ok := strings.CutPrefix(comment.Text, "//go:embed")
+						if !ok || (args != "" && args[0] != ' ' && args[0] != '\t') {
+							continue
+						}
+						patterns, err := parseEmbedPatterns(args)
+						if err != nil {
+							return nil, fmt.Errorf("%s: %v", fset.Position(comment.Pos()), err)
+						}
+						v.directives = append(v.directives, comment)
+						v.patterns = append(v.patterns, patterns...)
+					}
+				}
+				if len(v.directives) == 0 || len(spec.Names) != 1 || len(spec.Values) > 0 {
+					continue // not an embed, or one which the compiler will reject
+				}
+				obj, _ := info.Defs[spec.Names[0]].(*types.Var)
+				if obj == nil {
+					continue
+				}
+				switch typ := types.Unalias(obj.Type()); {
+				case isNamedType(typ, "embed", "FS"):
+					v.kind = embedFS
+				case isBasicKind(typ.Underlying(), types.String):
+					v.kind = embedString
+				case isByteSlice(typ.Underlying()):
+					v.kind = embedBytes
+				default:
+					continue
+				}
+				v.obj = obj
+				vars = append(vars, v)
+			}
+		}
+	}
+	return vars, nil
+}
+
+func isNamedType(typ types.Type, pkgPath, name string) bool {
+	named, ok := typ.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == pkgPath && obj.Name() == name
+}
+
+func isBasicKind(typ types.Type, kind types.BasicKind) bool {
+	basic, ok := typ.(*types.Basic)
+	return ok && basic.Kind() == kind
+}
+
+func isByteSlice(typ types.Type) bool {
+	slice, ok := typ.(*types.Slice)
+	return ok && isBasicKind(slice.Elem().Underlying(), types.Byte)
+}
+
+// parseEmbedPatterns splits the arguments of a //go:embed directive into
+// patterns, which may be quoted, like the go command does.
+func parseEmbedPatterns(args string) ([]string, error) {
+	var patterns []string
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		var pattern string
+		switch args[0] {
+		case '`':
+			end := strings.IndexByte(args[1:], '`')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid quoted string in //go:embed: %s", args)
+			}
+			pattern, args = args[1:1+end], args[2+end:]
+		case '"':
+			end := 1
+			for ; end < len(args); end++ {
+				if args[end] == '\\' {
+					end++
+				} else if args[end] == '"' {
+					break
+				}
+			}
+			if end >= len(args) {
+				return nil, fmt.Errorf("invalid quoted string in //go:embed: %s", args)
+			}
+			var err error
+			if pattern, err = strconv.Unquote(args[:end+1]); err != nil {
+				return nil, fmt.Errorf("invalid quoted string in //go:embed: %s", args[:end+1])
+			}
+			args = args[end+1:]
+		default:
+			end := strings.IndexAny(args, " \t")
+			if end < 0 {
+				end = len(args)
+			}
+			pattern, args = args[:end], args[end:]
+		}
+		if args != "" && args[0] != ' ' && args[0] != '\t' {
+			return nil, fmt.Errorf("invalid quoted string in //go:embed: %s", pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// embedFSSkipReason returns why an embed.FS variable cannot be replaced by the
+// decrypting file system in embed_fs_code.go, or the empty string if it can.
+// That is the case when it is unexported and only used to call its methods,
+// or as an interface value, such as an argument to fs.WalkDir or http.FS.
+func embedFSSkipReason(files []*ast.File, info *types.Info, v *embedVar) string {
+	if v.obj.Exported() {
+		return "exported embed.FS"
+	}
+	reason := ""
+	for _, file := range files {
+		ast.PreorderStack(file, nil, func(node ast.Node, stack []ast.Node) bool {
+			if reason != "" {
+				return false
+			}
+			ident, ok := node.(*ast.Ident)
+			if !ok || info.Uses[ident] != v.obj {
+				return true
+			}
+			if !embedFSUseOK(info, ident, stack[len(stack)-1]) {
+				reason = fmt.Sprintf("used as embed.FS at %s", fset.Position(ident.Pos()))
+			}
+			return true
+		})
+	}
+	return reason
+}
+
+func embedFSUseOK(info *types.Info, ident *ast.Ident, parent ast.Node) bool {
+	isInterface := func(typ types.Type) bool { return typ != nil && types.IsInterface(typ) }
+	switch parent := parent.(type) {
+	case *ast.SelectorExpr:
+		switch parent.Sel.Name {
+		case "Open", "ReadFile", "ReadDir":
+			return true
+		}
+	case *ast.CallExpr:
+		tv := info.Types[parent.Fun]
+		if tv.Type == nil {
+			return false
+		}
+		if tv.IsType() {
+			return isInterface(tv.Type) // a conversion like fs.FS(x)
+		}
+		sig, ok := types.Unalias(tv.Type).Underlying().(*types.Signature)
+		if !ok {
+			return false
+		}
+		params := sig.Params()
+		for i, arg := range parent.Args {
+			if arg != ident {
+				continue
+			}
+			switch {
+			case sig.Variadic() && i >= params.Len()-1:
+				if parent.Ellipsis.IsValid() {
+					return false
+				}
+				return isInterface(params.At(params.Len() - 1).Type().(*types.Slice).Elem())
+			case i < params.Len():
+				return isInterface(params.At(i).Type())
+			}
+		}
+	case *ast.AssignStmt:
+		for i, rhs := range parent.Rhs {
+			if rhs == ident && len(parent.Lhs) == len(parent.Rhs) && parent.Tok == token.ASSIGN {
+				return isInterface(info.TypeOf(parent.Lhs[i]))
+			}
+		}
+	case *ast.ValueSpec:
+		return parent.Type != nil && isInterface(info.TypeOf(parent.Type))
+	}
+	return false
+}
+
+// encrypt writes the encrypted contents of the files embedded by a variable
+// into dir, and adds them to newCfg under a single new pattern,
+// which is returned along with the number of files.
+// cfg is the configuration passed to the compiler by the go command.
+func (v *embedVar) encrypt(cfg, newCfg *embedConfig, salt, k0, k1 uint64, dir string) (pattern string, count int, _ error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, p := range v.patterns {
+		for _, name := range cfg.Patterns[p] {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	pattern = fmt.Sprintf("%016x", salt)
+	for _, name := range names {
+		data, err := os.ReadFile(cfg.Files[name])
+		if err != nil {
+			return "", 0, err
+		}
+		encName := pattern
+		switch v.kind {
+		case embedFS:
+			fk0 := k0 ^ salt
+			encName = _epath(name, fk0, k1)
+			_exor(data, 0, _ehash(name, fk0, k1), fk0, k1)
+		default:
+			_exor(data, 0, salt, k0, k1)
+		}
+		f, err := os.CreateTemp(dir, "embed")
+		if err != nil {
+			return "", 0, err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return "", 0, err
+		}
+		if err := f.Close(); err != nil {
+			return "", 0, err
+		}
+		newCfg.Patterns[pattern] = append(newCfg.Patterns[pattern], encName)
+		newCfg.Files[encName] = f.Name()
+	}
+	return pattern, len(names), nil
+}
+
+// rewrite moves the //go:embed directives of a variable, now using pattern,
+// to a new variable called hidden, which holds the encrypted data.
+// The original variable becomes initialized from the hidden one,
+// via the decrypting code in embed_fs_code.go.
+func (v *embedVar) rewrite(pattern, hidden string, salt uint64) {
+	for i, comment := range v.directives {
+		if i == 0 {
+			comment.Text = "//go:embed " + pattern
+		} else {
+			comment.Text = "//"
+		}
+	}
+	orig := v.spec.Names[0]
+	v.spec.Names[0] = &ast.Ident{Name: hidden, NamePos: orig.NamePos}
+
+	saltLit := &ast.BasicLit{Kind: token.INT, Value: fmt.Sprintf("%#x", salt)}
+	var value ast.Expr
+	switch v.kind {
+	case embedFS:
+		value = &ast.CompositeLit{
+			Type: ast.NewIdent("_eFS"),
+			Elts: []ast.Expr{
+				&ast.KeyValueExpr{Key: ast.NewIdent("_efsys"), Value: ast.NewIdent(hidden)},
+				&ast.KeyValueExpr{Key: ast.NewIdent("_esalt"), Value: saltLit},
+			},
+		}
+	default:
+		decrypt := "_estring"
+		if v.kind == embedBytes {
+			decrypt = "_ebytes"
+		}
+		// The original type may be a named string or byte slice type.
+		value = &ast.CallExpr{
+			Fun:  v.spec.Type,
+			Args: []ast.Expr{&ast.CallExpr{Fun: ast.NewIdent(decrypt), Args: []ast.Expr{ast.NewIdent(hidden), saltLit}}},
+		}
+		v.spec.Type = &ast.Ident{Name: "string", NamePos: v.spec.Type.Pos()}
+	}
+	v.file.Decls = append(v.file.Decls, &ast.GenDecl{
+		Tok: token.VAR,
+		Specs: []ast.Spec{&ast.ValueSpec{
+			Names:  []*ast.Ident{ast.NewIdent(orig.Name)},
+			Values: []ast.Expr{value},
+		}},
+	})
+}
+
+// embedFSSource returns the source of the file added to a package
+// whose embedded files are encrypted with the given key.
+func embedFSSource(pkgName string, k0, k1 uint64) string {
+	_, code, _ := strings.Cut(embedFSCode, "// Injected code below this line.")
+	code = strings.Replace(code, "var _ek0, _ek1 uint64", fmt.Sprintf("const _ek0, _ek1 uint64 = %#x, %#x", k0, k1), 1)
+	return "package " + pkgName + "\n" + code
+}
+
+// encryptEmbeds encrypts the files embedded by the package being compiled,
+// for the variables declared where literals are obfuscated.
+// The compiler is given a new -embedcfg with the encrypted files,
+// and the package gets a new file with the code to decrypt them.
+func (tf *transformer) encryptEmbeds(ctx *compileContext) error {
+	cfgPath := flagValue(ctx.flags, "-embedcfg")
+	if cfgPath == "" || !tf.curPkg.ToObfuscate {
+		return nil
+	}
+	on, _ := literalsSettingFor(tf.curPkg, ctx.files)
+	litCfg := literalsBuilderConfigFor(tf.curPkg, on)
+
+	vars, err := findEmbedVars(ctx.files, tf.info)
+	if err != nil {
+		return err
+	}
+	var toEncrypt []*embedVar
+	for _, v := range vars {
+		if !literals.TopLevelEnabled(v.file, litCfg) {
+			continue
+		}
+		if v.kind == embedFS {
+			if reason := embedFSSkipReason(ctx.files, tf.info, v); reason != "" {
+				log.Printf("garble: embedded files in %s.%s left in plaintext: %s", tf.curPkg.ImportPath, v.obj.Name(), reason)
+				if tf.report != nil {
+					if tf.report.EmbedsSkipped == nil {
+						tf.report.EmbedsSkipped = make(map[string]string)
+					}
+					tf.report.EmbedsSkipped[v.obj.Name()] = reason
+				}
+				continue
+			}
+		}
+		toEncrypt = append(toEncrypt, v)
+	}
+	if len(toEncrypt) == 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(cfgPath)
+	if err != nil {
+		return err
+	}
+	var cfg embedConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("cannot parse -embedcfg: %v", err)
+	}
+	// Keep the original patterns, for the variables we leave alone.
+	newCfg := embedConfig{
+		Patterns: make(map[string][]string, len(cfg.Patterns)),
+		Files:    make(map[string]string, len(cfg.Files)),
+	}
+	for pattern, names := range cfg.Patterns {
+		newCfg.Patterns[pattern] = names
+	}
+	for name, path := range cfg.Files {
+		newCfg.Files[name] = path
+	}
+
+	k0, k1 := embedKey(tf.curPkg)
+	total := 0
+	for _, v := range toEncrypt {
+		salt := tf.obfRand.Uint64()
+		pattern, count, err := v.encrypt(&cfg, &newCfg, salt, k0, k1, sharedTempDir)
+		if err != nil {
+			return err
+		}
+		v.rewrite(pattern, randomName(tf.obfRand, v.obj.Name()), salt)
+		total += count
+	}
+	log.Printf("garble: encrypted %d embedded files in %s", total, tf.curPkg.ImportPath)
+	if tf.report != nil {
+		tf.report.EmbeddedFiles = total
+	}
+
+	newCfgFile, err := os.CreateTemp(sharedTempDir, "embedcfg")
+	if err != nil {
+		return err
+	}
+	defer newCfgFile.Close()
+	if err := json.NewEncoder(newCfgFile).Encode(newCfg); err != nil {
+		return err
+	}
+	ctx.flags = flagSetValue(ctx.flags, "-embedcfg", newCfgFile.Name())
+
+	src := embedFSSource(ctx.files[0].Name.Name, k0, k1)
+	file, err := parser.ParseFile(fset, embedFileName, src, parser.SkipObjectResolution)
+	if err != nil {
+		return err
+	}
+	ctx.files = append(ctx.files, file)
+	ctx.paths = append(ctx.paths, embedFileName)
+	ctx.requiredPkgs = append(ctx.requiredPkgs, "io", "io/fs")
+
+	if err := tf.typecheckParsedFiles(ctx.files); err != nil {
+		return fmt.Errorf("typecheck after encrypting embedded files: %v", err)
+	}
+	if ctx.ssaPkg != nil {
+		ctx.ssaPkg = ssaBuildPkg(tf.pkg, ctx.files, tf.info)
+	}
+	return nil
+}
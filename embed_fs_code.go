@@ -0,0 +1,327 @@
+package main
+
+// The code below is added as a new file to packages whose //go:embed variables
+// are encrypted with -literals; see embed.go.
+//
+// The embedded files are stored encrypted, and string and []byte variables
+// are decrypted when the package is initialized. An embed.FS variable is
+// replaced by an _eFS, which wraps an embed.FS whose file and directory names
+// are encrypted one path element at a time, so that the hierarchy is kept.
+// Each variable has its own salt, mixed into the key for its names and data.
+//
+// The same functions encrypt the files and names at build time,
+// so that we can test this code normally.
+
+// Injected code below this line.
+
+import (
+	_eio "io"
+	_efs "io/fs"
+)
+
+var _ek0, _ek1 uint64
+
+// _emix is the finalizer of splitmix64.
+func _emix(z uint64) uint64 {
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
+
+// _ehash is a keyed hash of s, used to derive nonces.
+func _ehash(s string, k0, k1 uint64) uint64 {
+	h := k0 ^ 0xcbf29ce484222325
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 0x100000001b3
+	}
+	return _emix(h ^ k1)
+}
+
+// _exor XORs b, which starts at offset off of some data, with the keystream
+// for the key and nonce. Any range of the data can be decrypted on its own.
+func _exor(b []byte, off int64, nonce, k0, k1 uint64) {
+	seed := _emix(k0 ^ nonce)
+	var z uint64
+	for i := range b {
+		pos := uint64(off) + uint64(i)
+		if i == 0 || pos%8 == 0 {
+			z = _emix(seed+(pos/8+1)*0x9e3779b97f4a7c15) ^ k1
+		}
+		b[i] ^= byte(z >> (pos % 8 * 8))
+	}
+}
+
+const _ehex = "0123456789abcdef"
+
+// _ename encrypts a single element of a path, such as a file name.
+// The result is the nonce and ciphertext in lowercase hexadecimal,
+// which is a valid path element that does not contain a slash.
+func _ename(elem string, k0, k1 uint64) string {
+	nonce := uint32(_ehash(elem, k0, k1))
+	b := []byte{byte(nonce), byte(nonce >> 8), byte(nonce >> 16), byte(nonce >> 24)}
+	b = append(b, elem...)
+	_exor(b[4:], 0, uint64(nonce), k0, k1)
+	out := make([]byte, 0, len(b)*2)
+	for _, c := range b {
+		out = append(out, _ehex[c>>4], _ehex[c&0xf])
+	}
+	return string(out)
+}
+
+// _eplain decrypts a path element encrypted by _ename.
+// Elements which were not encrypted with the same key are returned as-is.
+func _eplain(elem string, k0, k1 uint64) string {
+	if len(elem) < 8 || len(elem)%2 != 0 {
+		return elem
+	}
+	b := make([]byte, len(elem)/2)
+	for i := range b {
+		hi, lo := _eunhex(elem[2*i]), _eunhex(elem[2*i+1])
+		if hi < 0 || lo < 0 {
+			return elem
+		}
+		b[i] = byte(hi<<4 | lo)
+	}
+	nonce := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+	_exor(b[4:], 0, uint64(nonce), k0, k1)
+	plain := string(b[4:])
+	if uint32(_ehash(plain, k0, k1)) != nonce {
+		return elem
+	}
+	return plain
+}
+
+func _eunhex(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c - 'a' + 10)
+	}
+	return -1
+}
+
+// _epath encrypts each element of a valid slash-separated path.
+func _epath(name string, k0, k1 uint64) string {
+	if name == "." {
+		return name
+	}
+	out := ""
+	start := 0
+	for i := 0; i <= len(name); i++ {
+		if i == len(name) || name[i] == '/' {
+			if start > 0 {
+				out += "/"
+			}
+			out += _ename(name[start:i], k0, k1)
+			start = i + 1
+		}
+	}
+	return out
+}
+
+// _ebase returns the last element of a valid slash-separated path.
+func _ebase(name string) string {
+	for i := len(name) - 1; i >= 0; i-- {
+		if name[i] == '/' {
+			return name[i+1:]
+		}
+	}
+	return name
+}
+
+// _estring decrypts an embedded string.
+func _estring(s string, salt uint64) string {
+	return string(_ebytes(s, salt))
+}
+
+// _ebytes decrypts an embedded []byte.
+func _ebytes(s string, salt uint64) []byte {
+	b := []byte(s)
+	_exor(b, 0, salt, _ek0, _ek1)
+	return b
+}
+
+// _eFS replaces an embed.FS variable. It implements the same methods,
+// so it can be used wherever the variable was used as an fs.FS.
+type _eFS struct {
+	_efsys _efs.FS
+	_esalt uint64
+}
+
+func (f _eFS) _ekeys() (k0, k1 uint64) { return _ek0 ^ f._esalt, _ek1 }
+
+// _eerror returns err, which comes from the encrypted file system,
+// as an error for name which does not reveal the encrypted name.
+func _eerror(op, name string, err error) error {
+	if pe, ok := err.(*_efs.PathError); ok {
+		op, err = pe.Op, pe.Err
+	}
+	return &_efs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (f _eFS) Open(name string) (_efs.File, error) {
+	if !_efs.ValidPath(name) {
+		return nil, &_efs.PathError{Op: "open", Path: name, Err: _efs.ErrNotExist}
+	}
+	k0, k1 := f._ekeys()
+	file, err := f._efsys.Open(_epath(name, k0, k1))
+	if err != nil {
+		return nil, _eerror("open", name, err)
+	}
+	return &_efile{_einner: file, _epath: name, _enonce: _ehash(name, k0, k1), _ek0: k0, _ek1: k1}, nil
+}
+
+func (f _eFS) ReadFile(name string) ([]byte, error) {
+	if !_efs.ValidPath(name) {
+		return nil, &_efs.PathError{Op: "open", Path: name, Err: _efs.ErrNotExist}
+	}
+	k0, k1 := f._ekeys()
+	data, err := _efs.ReadFile(f._efsys, _epath(name, k0, k1))
+	if err != nil {
+		return nil, _eerror("open", name, err)
+	}
+	_exor(data, 0, _ehash(name, k0, k1), k0, k1)
+	return data, nil
+}
+
+func (f _eFS) ReadDir(name string) ([]_efs.DirEntry, error) {
+	if !_efs.ValidPath(name) {
+		return nil, &_efs.PathError{Op: "open", Path: name, Err: _efs.ErrNotExist}
+	}
+	k0, k1 := f._ekeys()
+	list, err := _efs.ReadDir(f._efsys, _epath(name, k0, k1))
+	if err != nil {
+		return nil, _eerror("open", name, err)
+	}
+	return _eentries(list, k0, k1), nil
+}
+
+// _eentries decrypts the names of directory entries,
+// and sorts them by their decrypted names.
+func _eentries(list []_efs.DirEntry, k0, k1 uint64) []_efs.DirEntry {
+	out := make([]_efs.DirEntry, len(list))
+	for i, entry := range list {
+		e := _eentry{_einner: entry, _ename: _eplain(entry.Name(), k0, k1)}
+		j := i
+		for ; j > 0 && out[j-1].Name() > e._ename; j-- {
+			out[j] = out[j-1]
+		}
+		out[j] = e
+	}
+	return out
+}
+
+type _eentry struct {
+	_einner _efs.DirEntry
+	_ename  string
+}
+
+func (e _eentry) Name() string        { return e._ename }
+func (e _eentry) IsDir() bool         { return e._einner.IsDir() }
+func (e _eentry) Type() _efs.FileMode { return e._einner.Type() }
+func (e _eentry) String() string      { return _efs.FormatDirEntry(e) }
+func (e _eentry) Info() (_efs.FileInfo, error) {
+	info, err := e._einner.Info()
+	if err != nil {
+		return nil, err
+	}
+	return _einfo{info, e._ename}, nil
+}
+
+// _einfo is a FileInfo with the decrypted name.
+type _einfo struct {
+	_efs.FileInfo
+	_ename string
+}
+
+func (i _einfo) Name() string   { return i._ename }
+func (i _einfo) String() string { return _efs.FormatFileInfo(i) }
+
+// _efile is an open file or directory, which decrypts what is read from it.
+type _efile struct {
+	_einner  _efs.File
+	_epath   string
+	_enonce  uint64
+	_ek0     uint64
+	_ek1     uint64
+	_eoffset int64
+	_elist   []_efs.DirEntry // sorted entries not yet read by ReadDir
+	_elisted bool
+}
+
+func (f *_efile) Close() error { return f._einner.Close() }
+
+func (f *_efile) Stat() (_efs.FileInfo, error) {
+	info, err := f._einner.Stat()
+	if err != nil {
+		return nil, _eerror("stat", f._epath, err)
+	}
+	return _einfo{info, _ebase(f._epath)}, nil
+}
+
+func (f *_efile) Read(b []byte) (int, error) {
+	n, err := f._einner.Read(b)
+	_exor(b[:n], f._eoffset, f._enonce, f._ek0, f._ek1)
+	f._eoffset += int64(n)
+	if err != nil && err != _eio.EOF {
+		err = _eerror("read", f._epath, err)
+	}
+	return n, err
+}
+
+func (f *_efile) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := f._einner.(_eio.Seeker)
+	if !ok {
+		return 0, &_efs.PathError{Op: "seek", Path: f._epath, Err: _efs.ErrInvalid}
+	}
+	offset, err := seeker.Seek(offset, whence)
+	if err != nil {
+		return 0, _eerror("seek", f._epath, err)
+	}
+	f._eoffset = offset
+	return offset, nil
+}
+
+func (f *_efile) ReadAt(b []byte, offset int64) (int, error) {
+	readerAt, ok := f._einner.(_eio.ReaderAt)
+	if !ok {
+		return 0, &_efs.PathError{Op: "read", Path: f._epath, Err: _efs.ErrInvalid}
+	}
+	n, err := readerAt.ReadAt(b, offset)
+	_exor(b[:n], offset, f._enonce, f._ek0, f._ek1)
+	if err != nil && err != _eio.EOF {
+		err = _eerror("read", f._epath, err)
+	}
+	return n, err
+}
+
+func (f *_efile) ReadDir(count int) ([]_efs.DirEntry, error) {
+	dir, ok := f._einner.(_efs.ReadDirFile)
+	if !ok {
+		return nil, &_efs.PathError{Op: "read", Path: f._epath, Err: _efs.ErrInvalid}
+	}
+	if !f._elisted {
+		list, err := dir.ReadDir(-1)
+		if err != nil {
+			return nil, _eerror("read", f._epath, err)
+		}
+		f._elist = _eentries(list, f._ek0, f._ek1)
+		f._elisted = true
+	}
+	if count <= 0 {
+		list := f._elist
+		f._elist = nil
+		return list, nil
+	}
+	if len(f._elist) == 0 {
+		return nil, _eio.EOF
+	}
+	if count > len(f._elist) {
+		count = len(f._elist)
+	}
+	list := f._elist[:count:count]
+	f._elist = f._elist[count:]
+	return list, nil
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/printer"
+	"go/types"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseEmbedPatterns(t *testing.T) {
+	tests := []struct {
+		args string
+		want []string
+	}{
+		{" a.txt", []string{"a.txt"}},
+		{" static/* \ttemplates", []string{"static/*", "templates"}},
+		{` "with space.txt" ` + "`raw name`", []string{"with space.txt", "raw name"}},
+		{` "esc\"aped" all:dir`, []string{`esc"aped`, "all:dir"}},
+	}
+	for _, test := range tests {
+		got, err := parseEmbedPatterns(test.args)
+		if err != nil {
+			t.Errorf("parseEmbedPatterns(%q): %v", test.args, err)
+			continue
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("parseEmbedPatterns(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+	for _, args := range []string{` "unterminated`, " `unterminated", ` "a"b`} {
+		if _, err := parseEmbedPatterns(args); err == nil {
+			t.Errorf("parseEmbedPatterns(%q) did not fail", args)
+		}
+	}
+}
+
+func TestEmbedFS(t *testing.T) {
+	origK0, origK1 := _ek0, _ek1
+	defer func() { _ek0, _ek1 = origK0, origK1 }()
+	_ek0, _ek1 = 0x0123456789abcdef, 0xfedcba9876543210
+	const salt = 0x5a17
+
+	files := map[string]string{
+		"index.html":          "<h1>secret index</h1>",
+		"static/app.js":       strings.Repeat("console.log('secret app');\n", 50),
+		"static/css/site.css": "body { color: secret; }",
+		"static/empty.txt":    "",
+	}
+	k0, k1 := _ek0^salt, _ek1
+	encrypted := make(fstest.MapFS)
+	for name, content := range files {
+		data := []byte(content)
+		_exor(data, 0, _ehash(name, k0, k1), k0, k1)
+		encName := _epath(name, k0, k1)
+		if strings.Contains(encName, "secret") || strings.Contains(encName, "static") || strings.Contains(encName, "index") {
+			t.Fatalf("encrypted name %q contains plaintext", encName)
+		}
+		encrypted[encName] = &fstest.MapFile{Data: data}
+	}
+	fsys := _eFS{_efsys: encrypted, _esalt: salt}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	if err := fstest.TestFS(fsys, names...); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		got, err := fsys.ReadFile(name)
+		if err != nil || string(got) != content {
+			t.Errorf("ReadFile(%q) = %q, %v; want %q", name, got, err, content)
+		}
+	}
+	if _, err := fsys.Open("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open of a missing file: %v", err)
+	} else if want := "open missing.txt: file does not exist"; err.Error() != want {
+		t.Errorf("Open of a missing file: got %q, want %q", err, want)
+	}
+
+	var walked []string
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		walked = append(walked, path)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".", "index.html", "static", "static/app.js", "static/css", "static/css/site.css", "static/empty.txt"}
+	if !slices.Equal(walked, want) {
+		t.Errorf("WalkDir visited %q, want %q", walked, want)
+	}
+
+	// http.FileServer seeks to find the content type and length.
+	server := httptest.NewServer(http.FileServer(http.FS(fsys)))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/static/app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != files["static/app.js"] {
+		t.Errorf("http.FS served %q", body)
+	}
+}
+
+func TestEncryptEmbeds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a binary")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":             "module test/main\n\ngo 1.23\n",
+		"secret.txt":         "secret string\n",
+		"key.bin":            "secret bytes",
+		"assets/a.txt":       "secret file a\n",
+		"assets/sub/b.txt":   "secret file b\n",
+		"exported/plain.txt": "plaintext file\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src := `package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+)
+
+type blob []byte
+
+//go:embed secret.txt
+var text string
+
+var (
+	//go:embed key.bin
+	key blob
+
+	//go:embed assets
+	assets embed.FS
+)
+
+//go:embed exported
+var Exported embed.FS
+
+func main() {
+	fmt.Printf("%q %q\n", text, key)
+	fs.WalkDir(assets, ".", func(path string, d fs.DirEntry, err error) error {
+		if !d.IsDir() {
+			data, _ := assets.ReadFile(path)
+			fmt.Printf("%s: %q\n", path, data)
+		}
+		return err
+	})
+	data, _ := Exported.ReadFile("exported/plain.txt")
+	fmt.Printf("%q\n", data)
+}
+`
+	want := `"secret string\n" "secret bytes"
+assets/a.txt: "secret file a\n"
+assets/sub/b.txt: "secret file b\n"
+"plaintext file\n"
+`
+	file, err := parser.ParseFile(fset, filepath.Join(dir, "main.go"), src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	if _, err := (&types.Config{Importer: importer.Default()}).Check("test/main", fset, []*ast.File{file}, info); err != nil {
+		t.Fatal(err)
+	}
+	vars, err := findEmbedVars([]*ast.File{file}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []embedKind
+	for _, v := range vars {
+		kinds = append(kinds, v.kind)
+	}
+	if want := []embedKind{embedString, embedBytes, embedFS, embedFS}; !slices.Equal(kinds, want) {
+		t.Fatalf("found embeds of kinds %v, want %v", kinds, want)
+	}
+	if reason := embedFSSkipReason([]*ast.File{file}, info, vars[2]); reason != "" {
+		t.Fatalf("assets was skipped: %s", reason)
+	}
+	if reason := embedFSSkipReason([]*ast.File{file}, info, vars[3]); reason != "exported embed.FS" {
+		t.Fatalf("Exported was skipped for %q", reason)
+	}
+
+	// Mimic the -embedcfg which the go command would give the compiler.
+	cfg := embedConfig{
+		Patterns: map[string][]string{
+			"secret.txt": {"secret.txt"},
+			"key.bin":    {"key.bin"},
+			"assets":     {"assets/a.txt", "assets/sub/b.txt"},
+		},
+		Files: make(map[string]string),
+	}
+	for name := range files {
+		cfg.Files[name] = filepath.Join(dir, name)
+	}
+	newCfg := embedConfig{Patterns: make(map[string][]string), Files: make(map[string]string)}
+	const k0, k1 = 0x1111, 0x2222
+	for i, v := range vars[:3] {
+		salt := uint64(i + 1)
+		pattern, _, err := v.encrypt(&cfg, &newCfg, salt, k0, k1, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.rewrite(pattern, "hidden"+v.obj.Name(), salt)
+
+		// The go command cannot be given an -embedcfg, so name the
+		// encrypted files directly, placing them where it will find them.
+		var names []string
+		for _, name := range newCfg.Patterns[pattern] {
+			data, err := os.ReadFile(newCfg.Files[name])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(data, []byte("secret")) {
+				t.Fatalf("%s is not encrypted: %q", name, data)
+			}
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, data, 0o666); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, name)
+		}
+		v.directives[0].Text = "//go:embed " + strings.Join(names, " ")
+	}
+	for _, name := range []string{"secret.txt", "key.bin", "assets"} {
+		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, file); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), buf.Bytes(), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, embedFileName[1:]), []byte(embedFSSource("main", k0, k1)), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "build", "-o", "main.exe")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s\n%s", err, output, buf.Bytes())
+	}
+	binary, err := os.ReadFile(filepath.Join(dir, "main.exe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plain := range []string{"secret string", "secret bytes", "secret file", "sub/b.txt"} {
+		if bytes.Contains(binary, []byte(plain)) {
+			t.Errorf("binary contains %q", plain)
+		}
+	}
+	output, err := exec.Command(filepath.Join(dir, "main.exe")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	if string(output) != want {
+		t.Fatalf("got output:\n%s\nwant:\n%s", output, want)
+	}
+}
@@ -100,6 +100,9 @@ func buildFlagHashInput() []byte {
 	if len(sharedCache.BuildFlagHashInput) == 0 {
 		var buf bytes.Buffer
 		_, _ = fmt.Fprintf(&buf, " GOGARBLE=%s", sharedCache.GOGARBLE)
+		_, _ = io.WriteString(&buf, projectConfigHashInput())
+		_, _ = io.WriteString(&buf, forceRenameAutoHashInput())
+		_, _ = io.WriteString(&buf, convertedConstsHashInput())
 		appendFlags(&buf, true)
 		sharedCache.BuildFlagHashInput = buf.Bytes()
 	}
@@ -168,6 +171,12 @@ func appendFlags(w io.Writer, forBuildHash bool) {
 	if flagLiterals {
 		_, _ = io.WriteString(w, " -literals")
 	}
+	if flagLiteralsCache {
+		_, _ = io.WriteString(w, " -literals-cache")
+	}
+	if flagLiteralsHash {
+		_, _ = io.WriteString(w, " -literals-hash")
+	}
 	if flagTiny {
 		_, _ = io.WriteString(w, " -tiny")
 	}
@@ -176,7 +185,11 @@ func appendFlags(w io.Writer, forBuildHash bool) {
 		// so don't give it separate entries in the build cache.
 		// If the user really wants to see debug info for already built deps,
 		// they can use "go clean cache" or the "-a" build flag to rebuild.
-		_, _ = io.WriteString(w, " -debug")
+		if flagDebugJSON {
+			_, _ = io.WriteString(w, " -debug=json")
+		} else {
+			_, _ = io.WriteString(w, " -debug")
+		}
 	}
 	if flagDebugDir != "" && !forBuildHash {
 		// -debugdir is a bit special.
@@ -194,6 +207,13 @@ func appendFlags(w io.Writer, forBuildHash bool) {
 		_, _ = io.WriteString(w, " -debugdir=")
 		_, _ = io.WriteString(w, flagDebugDir)
 	}
+	if flagReport != "" && !forBuildHash {
+		// Like -debugdir, the report doesn't affect obfuscation.
+		// The toolexec sub-processes only need to know that it's enabled,
+		// as the top-level garble process writes the file.
+		_, _ = io.WriteString(w, " -report=")
+		_, _ = io.WriteString(w, flagReport)
+	}
 	if flagSeed.present() {
 		_, _ = io.WriteString(w, " -seed=")
 		_, _ = io.WriteString(w, flagSeed.String())
@@ -205,9 +225,21 @@ func appendFlags(w io.Writer, forBuildHash bool) {
 		_, _ = io.WriteString(w, " -controlflow=")
 		_, _ = io.WriteString(w, flagControlFlowMode.String())
 	}
-	if flagForceRename {
+	if flagForceRenameAuto {
+		_, _ = io.WriteString(w, " -force-rename=auto")
+	} else if flagForceRename {
 		_, _ = io.WriteString(w, " -force-rename")
 	}
+	if flagWireTags {
+		_, _ = io.WriteString(w, " -wire-tags")
+	}
+	if flagEncryptTags {
+		_, _ = io.WriteString(w, " -encrypt-tags")
+	}
+	if flagNames != namesHash {
+		_, _ = io.WriteString(w, " -names=")
+		_, _ = io.WriteString(w, flagNames)
+	}
 	if literals.TestObfuscator != "" && forBuildHash {
 		_, _ = io.WriteString(w, literals.TestObfuscator)
 	}
@@ -246,17 +278,33 @@ func isUpper(b byte) bool { return 'A' <= b && b <= 'Z' }
 func toLower(b byte) byte { return b + ('a' - 'A') }
 func toUpper(b byte) byte { return b - ('a' - 'A') }
 
+// hashWithPackage hashes a name declared in a package, such as a top-level
+// identifier, unless resaltNames found it to collide with another name.
+// Exported names which -force-rename=auto found to only be used in their
+// own package are turned into unexported names.
 func hashWithPackage(pkg *listedPackage, name string) string {
+	key := resaltKey(pkg.ImportPath, name)
+	newName, ok := resaltedNames[key]
+	if !ok {
+		newName = hashWithCustomSalt(packageSalt(pkg), name)
+	}
+	if sharedCache != nil && sharedCache.RenamedExports[key] {
+		newName = unexportName(newName)
+	}
+	return newName
+}
+
+// packageSalt returns the salt used by hashWithPackage.
+func packageSalt(pkg *listedPackage) []byte {
 	if !flagSeed.present() {
-		return hashWithCustomSalt(pkg.GarbleActionID[:], name)
+		return pkg.GarbleActionID[:]
 	}
 
 	h := sha256.New()
 	h.Write([]byte(pkg.ImportPath))
 	h.Write([]byte("|"))
 	h.Write(seedHashInput())
-	salt := h.Sum(nil)
-	return hashWithCustomSalt(salt, name)
+	return h.Sum(nil)
 }
 
 // hashWithStruct is separate from hashWithPackage since Go
@@ -284,6 +332,9 @@ func hashWithStruct(strct *types.Struct, field *types.Var) string {
 		withGarbleHash := addGarbleToHash(salt)
 		salt = withGarbleHash[:]
 	}
+	if newName, ok := hashStructFields(strct, salt)[field.Name()]; ok {
+		return newName
+	}
 	return hashWithCustomSalt(salt, field.Name())
 }
 
@@ -291,6 +342,12 @@ func hashWithStruct(strct *types.Struct, field *types.Var) string {
 // This ensures the same method name always produces the same obfuscated name
 // across all packages, which is required for -force-rename to preserve
 // interface satisfaction across package boundaries.
+//
+// Unlike hashWithPackage and hashWithStruct, its names are never re-salted.
+// Doing so consistently would require every package to know all the method
+// names in the program, yet packages are compiled separately. A collision only
+// breaks a build when it is between the methods and fields of a single type,
+// which is far less likely than one between the many names of a package.
 func hashMethodGlobal(name string) string {
 	h := sha256.New()
 	h.Write([]byte("garble:method:"))
@@ -336,6 +393,8 @@ func hashMethodGlobal(name string) string {
 // with lengths evenly distributed between 6 and 12. Naively, this results in an
 // average length of 9, which has a chance well below 1 in a million even when a
 // package has thousands of obfuscated names.
+// Collisions which happen regardless are detected and re-salted;
+// see resaltNames and hashStructFields, but not hashMethodGlobal.
 //
 // These numbers are also chosen to keep obfuscated binary sizes reasonable.
 // For example, increasing the average length of 9 by 1 results in roughly a 1%
@@ -365,6 +424,8 @@ func randomName(rand *mathrand.Rand, baseName string) string {
 // The result is always four bytes long. If the input was a valid identifier,
 // the output remains equally exported or unexported. Note that this process is
 // reproducible, but one-way.
+//
+// With -names=words, the same hash is encoded as dictionary words by wordsName.
 func hashWithCustomSalt(salt []byte, name string) string {
 	if len(salt) == 0 {
 		panic("hashWithCustomSalt: empty salt")
@@ -379,6 +440,10 @@ func hashWithCustomSalt(salt []byte, name string) string {
 	_, _ = io.WriteString(hasher, name)
 	sum := hasher.Sum(sumBuffer[:0])
 
+	if flagNames == namesWords {
+		return wordsName(sum, name)
+	}
+
 	// The byte after neededSumBytes is never used as part of the name,
 	// but it is still deterministic and hard to predict,
 	// so it provides us with useful randomness between 0 and 255.
@@ -0,0 +1,140 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"log"
+	"slices"
+	"strconv"
+)
+
+// resaltedNames holds the names which had to be re-salted to avoid a collision,
+// as recorded by resaltNames, for the package being built and its dependencies.
+// It is keyed by resaltKey, and consulted by hashWithPackage.
+//
+// The compiler loads it from pkgCache.ResaltedNames; the other tools and
+// commands either load it from the cache as well, or recompute it.
+var resaltedNames map[string]string
+
+func resaltKey(importPath, name string) string { return importPath + "." + name }
+
+// resaltNames detects which identifiers in a package's files hash to the same
+// obfuscated name, and deterministically re-derives the names of all but the
+// first one in sorted order with an extra salt.
+//
+// Even though minHashLength makes collisions very unlikely, huge packages such
+// as generated code can have tens of thousands of names, and a collision results
+// in a confusing compile error. We consider every identifier in the syntax,
+// so we may re-salt names which never end up clashing, but that is harmless.
+//
+// Methods hashed by hashMethodGlobal under -force-rename are out of scope,
+// as they must be hashed the same way in every package.
+//
+// The result is keyed by resaltKey and is empty in the common case.
+func resaltNames(lpkg *listedPackage, files []*ast.File) map[string]string {
+	var names []string
+	for _, file := range files {
+		for node := range ast.Preorder(file) {
+			if ident, ok := node.(*ast.Ident); ok && ident.Name != "_" {
+				names = append(names, ident.Name)
+			}
+		}
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	salt := packageSalt(lpkg)
+	resalted := make(map[string]string)
+	for name, newName := range resaltCollisions(salt, names, hashWithCustomSalt) {
+		log.Printf("hash collision in %s: %q re-salted to %q", lpkg.ImportPath, name, newName)
+		resalted[resaltKey(lpkg.ImportPath, name)] = newName
+	}
+	return resalted
+}
+
+// resaltNamesFromSource is like resaltNames, but parses the package's
+// CompiledGoFiles afresh, like loadAsmNames and "garble reverse" do.
+// The compiler uses it as its own syntax trees may have gained identifiers,
+// such as from control-flow obfuscation or encrypted embeds,
+// which would otherwise make the tools disagree on the re-salted names.
+func resaltNamesFromSource(lpkg *listedPackage) (map[string]string, error) {
+	// parseFiles patches the first main package it sees with reflect code,
+	// so give it a clean slate and restore the state of the current tool.
+	patchFile := reflectPatchFile
+	reflectPatchFile = ""
+	files, err := parseFiles(lpkg, lpkg.Dir, lpkg.CompiledGoFiles)
+	reflectPatchFile = patchFile
+	if err != nil {
+		return nil, err
+	}
+	return resaltNames(lpkg, files), nil
+}
+
+// resaltCollisions hashes sorted unique names with salt, and returns the new
+// names for those which collided with an earlier name, re-hashed with extra
+// salt until they no longer collide with any other name.
+// hash is hashWithCustomSalt, except in tests.
+func resaltCollisions(salt []byte, names []string, hash func(salt []byte, name string) string) map[string]string {
+	taken := make(map[string]bool, len(names))
+	var colliding []string
+	for _, name := range names {
+		hashed := hash(salt, name)
+		if taken[hashed] {
+			colliding = append(colliding, name)
+			continue
+		}
+		taken[hashed] = true
+	}
+	if len(colliding) == 0 {
+		return nil
+	}
+	resalted := make(map[string]string, len(colliding))
+	for _, name := range colliding {
+		for n := 1; ; n++ {
+			extra := strconv.AppendInt(append(slices.Clip(salt), "resalt"...), int64(n), 10)
+			hashed := hash(extra, name)
+			if !taken[hashed] {
+				taken[hashed] = true
+				resalted[name] = hashed
+				break
+			}
+		}
+	}
+	return resalted
+}
+
+// structFieldNames memoizes the obfuscated field names per struct type,
+// as computed by hashWithStruct.
+var structFieldNames = make(map[*types.Struct]map[string]string)
+
+// hashStructFields computes the obfuscated names of all fields in a struct,
+// re-salting any collisions in the same way that resaltNames does.
+// Since the salt is the identity of the struct type, the result is the same
+// in every package, so it does not need to be recorded in the cache.
+func hashStructFields(strct *types.Struct, salt []byte) map[string]string {
+	if hashed := structFieldNames[strct]; hashed != nil {
+		return hashed
+	}
+	var names []string
+	for field := range strct.Fields() {
+		if field.Name() != "_" {
+			names = append(names, field.Name())
+		}
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	hashed := make(map[string]string, len(names))
+	for _, name := range names {
+		hashed[name] = hashWithCustomSalt(salt, name)
+	}
+	for name, newName := range resaltCollisions(salt, names, hashWithCustomSalt) {
+		log.Printf("hash collision in struct fields: %q re-salted to %q", name, newName)
+		hashed[name] = newName
+	}
+	structFieldNames[strct] = hashed
+	return hashed
+}
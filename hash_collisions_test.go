@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"maps"
+	"testing"
+)
+
+func TestResaltCollisions(t *testing.T) {
+	// A hash with only 16 possible results, so that collisions are common.
+	tinyHash := func(salt []byte, name string) string {
+		sum := sha256.Sum256(append(salt, name...))
+		return fmt.Sprintf("h%x", sum[0]%16)
+	}
+	var names []string
+	for i := range 12 {
+		names = append(names, fmt.Sprintf("name%02d", i))
+	}
+	salt := []byte("salt")
+	resalted := resaltCollisions(salt, names, tinyHash)
+	if len(resalted) == 0 {
+		t.Fatalf("expected some collisions among %d names", len(names))
+	}
+	if _, ok := resalted[names[0]]; ok {
+		t.Errorf("the first name %q should never be re-salted", names[0])
+	}
+	seen := make(map[string]string)
+	for _, name := range names {
+		hashed, ok := resalted[name]
+		if !ok {
+			hashed = tinyHash(salt, name)
+		}
+		if other, ok := seen[hashed]; ok {
+			t.Errorf("%q and %q both hash to %q", other, name, hashed)
+		}
+		seen[hashed] = name
+	}
+	if again := resaltCollisions(salt, names, tinyHash); !maps.Equal(again, resalted) {
+		t.Errorf("resaltCollisions is not deterministic: %v then %v", resalted, again)
+	}
+
+	if resalted := resaltCollisions(salt, names, hashWithCustomSalt); len(resalted) != 0 {
+		t.Errorf("unexpected collisions with real hashes: %v", resalted)
+	}
+}
+
+func TestHashMethodGlobalNotResalted(t *testing.T) {
+	defer func(seed seedFlag, shared *sharedCacheType, resalted map[string]string) {
+		flagSeed, sharedCache, resaltedNames = seed, shared, resalted
+	}(flagSeed, sharedCache, resaltedNames)
+	flagSeed = seedFlag{bytes: []byte("seed")}
+	sharedCache = nil
+
+	// Names re-salted in a package only apply to the names hashed with it,
+	// as methods hashed globally must be the same in every package.
+	want := hashMethodGlobal("Close")
+	resaltedNames = map[string]string{resaltKey("test/lib", "Close"): "resalted"}
+	if got := hashWithPackage(&listedPackage{ImportPath: "test/lib"}, "Close"); got != "resalted" {
+		t.Errorf("hashWithPackage ignored the re-salted name: %q", got)
+	}
+	if got := hashMethodGlobal("Close"); got != want {
+		t.Errorf("hashMethodGlobal changed with re-salted names: %q, want %q", got, want)
+	}
+}
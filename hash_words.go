@@ -0,0 +1,114 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"encoding/binary"
+	"go/token"
+	"strings"
+)
+
+// Valid values for the -names flag.
+const (
+	namesHash  = "hash"  // base64 hashes, like "Zq3kP_aQx"
+	namesWords = "words" // dictionary words, like "loadSlotState"
+)
+
+// With -names=words, each word encodes nameWordBits bits of the hash,
+// and names are built from minNameWords or one more words.
+// Like minHashLength, that gives us at least 36 bits against collisions.
+const (
+	nameWordBits = 9
+	minNameWords = 4
+)
+
+// wordsName is the -names=words counterpart to the base64 encoding
+// in hashWithCustomSalt, mapping the same hash sum onto dictionary words.
+//
+// Valid identifiers stay exported or unexported, joining the words in camel case.
+// Anything else, such as import paths, joins the words in lowercase like "pkgview".
+// Since nameWords is prefix-free, different sums never result in the same name.
+func wordsName(sum []byte, name string) string {
+	// As with hashLengthRandomness, this byte is never part of the name.
+	count := minNameWords + int(sum[neededSumBytes]%2)
+	bits := binary.BigEndian.Uint64(sum[:8])
+
+	isIdent := token.IsIdentifier(name)
+	exported := isIdent && token.IsExported(name)
+	var sb strings.Builder
+	for i := range count {
+		word := nameWords[bits>>(64-nameWordBits)]
+		bits <<= nameWordBits
+		if isIdent && (i > 0 || exported) {
+			sb.WriteByte(toUpper(word[0]))
+			sb.WriteString(word[1:])
+		} else {
+			sb.WriteString(word)
+		}
+	}
+	return sb.String()
+}
+
+// nameWords are short and common words in Go code,
+// all lowercase, and none of them a prefix of another.
+var nameWords = [1 << nameWordBits]string{
+	"able", "acid", "actor", "add", "admin", "agent", "alert", "alias",
+	"align", "alpha", "apply", "arg", "array", "asset", "atom", "audio",
+	"audit", "auth", "aux", "axis", "back", "band", "bank", "base", "batch",
+	"beam", "bell", "beta", "bind", "bird", "bit", "blank", "blob", "block",
+	"blue", "board", "body", "bold", "bolt", "bond", "boost", "boot", "bound",
+	"box", "buf", "build", "bulk", "burst", "bus", "byte", "cable", "cache",
+	"calc", "call", "cap", "card", "carry", "case", "cast", "cell", "chain",
+	"char", "check", "chip", "chunk", "city", "claim", "class", "clean",
+	"clear", "click", "clock", "clone", "close", "cloud", "cmd", "code",
+	"coin", "cold", "color", "conn", "copy", "core", "count", "cover", "crop",
+	"cross", "ctx", "cube", "curve", "cycle", "dash", "data", "date", "deal",
+	"debug", "deep", "delta", "demo", "dense", "depth", "desk", "dev", "dial",
+	"diff", "digit", "dir", "disk", "doc", "door", "dose", "dot", "draft",
+	"drag", "draw", "drive", "drop", "dual", "dump", "duty", "early", "echo",
+	"edge", "edit", "email", "embed", "empty", "end", "entry", "env", "epoch",
+	"equal", "err", "event", "evt", "exact", "exit", "exp", "extra", "face",
+	"fact", "fade", "fail", "fair", "false", "fast", "fault", "feed", "fetch",
+	"field", "file", "fill", "film", "final", "find", "fire", "firm", "first",
+	"fix", "flag", "flat", "flex", "flow", "flush", "fmt", "focus", "fold",
+	"font", "force", "form", "frame", "free", "fresh", "front", "fuel", "full",
+	"func", "fuse", "gain", "game", "gap", "gate", "gear", "gen", "get",
+	"gift", "given", "glow", "goal", "gold", "graph", "grid", "group", "grow",
+	"guard", "guide", "half", "hand", "hard", "hash", "hdr", "head", "heap",
+	"heat", "help", "hero", "high", "hint", "hold", "home", "hook", "host",
+	"hour", "hub", "human", "icon", "idle", "idx", "image", "img", "index",
+	"info", "input", "int", "item", "job", "join", "jump", "just", "keep",
+	"key", "kind", "king", "knob", "label", "lake", "lamp", "land", "lane",
+	"large", "last", "latch", "late", "layer", "lazy", "lead", "leaf", "lean",
+	"left", "len", "level", "lib", "lift", "light", "limit", "line", "link",
+	"list", "lit", "live", "load", "loan", "local", "lock", "log", "long",
+	"loop", "lost", "low", "macro", "mail", "main", "major", "maker", "map",
+	"mark", "mask", "match", "math", "max", "media", "memo", "menu", "merge",
+	"mesh", "meta", "micro", "mid", "min", "mix", "mode", "month", "mount",
+	"mouse", "move", "msg", "multi", "mute", "name", "near", "neat", "need",
+	"nest", "net", "new", "next", "nice", "node", "noise", "note", "null",
+	"num", "obj", "offer", "old", "omit", "open", "ops", "opt", "order", "out",
+	"own", "pack", "pad", "page", "pair", "pane", "paper", "param", "parse",
+	"part", "pass", "patch", "path", "peak", "peer", "pick", "piece", "pin",
+	"pipe", "pivot", "pixel", "pkg", "place", "plain", "plan", "play", "plot",
+	"plug", "point", "poll", "pool", "port", "pos", "power", "press", "price",
+	"prime", "print", "probe", "proof", "proxy", "ptr", "pub", "pull", "pump",
+	"push", "queue", "quota", "quote", "rail", "range", "rank", "rate", "raw",
+	"read", "real", "red", "ref", "relay", "reply", "req", "res", "ret", "rev",
+	"rich", "ring", "road", "role", "roll", "root", "round", "route", "row",
+	"rule", "run", "rush", "safe", "save", "scale", "scan", "scope", "score",
+	"seal", "seed", "send", "shape", "share", "shell", "shift", "show", "side",
+	"sig", "size", "skip", "slice", "slot", "small", "snap", "soft", "sort",
+	"space", "span", "spec", "speed", "spin", "split", "spot", "src", "stack",
+	"stage", "star", "state", "std", "step", "stock", "store", "str", "style",
+	"sub", "suite", "sum", "swap", "sync", "sys", "table", "tag", "tail",
+	"task", "team", "tech", "temp", "term", "test", "text", "tick", "tide",
+	"tile", "time", "tiny", "title", "tmp", "token", "tone", "tool", "top",
+	"total", "touch", "trace", "track", "tree", "trim", "trip", "true",
+	"trust", "tune", "turn", "twin", "type", "unit", "upper", "usage", "user",
+	"val", "var", "verb", "via", "view", "vote", "wait", "walk", "wall",
+	"ward", "warm", "wave", "weak", "web", "wide", "width", "wild", "win",
+	"wire", "word", "work", "wrap", "write", "yard", "year", "yield", "zero",
+	"zone", "zoom",
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"go/token"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNameWords(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, word := range nameWords {
+		if !regexp.MustCompile(`^[a-z]+$`).MatchString(word) {
+			t.Errorf("word %q is not all lowercase letters", word)
+		}
+		if seen[word] {
+			t.Errorf("word %q is duplicated", word)
+		}
+		seen[word] = true
+	}
+	// A prefix-free list means that names in lowercase, which join words
+	// without any separators, can still only come from one hash.
+	for _, word := range nameWords {
+		for _, other := range nameWords {
+			if word != other && strings.HasPrefix(other, word) {
+				t.Errorf("word %q is a prefix of %q", word, other)
+			}
+		}
+	}
+}
+
+func TestWordsName(t *testing.T) {
+	tests := []struct {
+		name string
+		want *regexp.Regexp
+	}{
+		{"ExportedFunc", regexp.MustCompile(`^([A-Z][a-z]+){4,5}$`)},
+		{"unexportedVar", regexp.MustCompile(`^[a-z]+([A-Z][a-z]+){3,4}$`)},
+		{"_", regexp.MustCompile(`^[a-z]+([A-Z][a-z]+){3,4}$`)},
+		{"test/main/lib", regexp.MustCompile(`^[a-z]+$`)},
+		{"lib.go:12", regexp.MustCompile(`^[a-z]+$`)},
+	}
+	for _, test := range tests {
+		sum := sha256.Sum256([]byte(test.name))
+		got := wordsName(sum[:], test.name)
+		if !test.want.MatchString(got) {
+			t.Errorf("wordsName(%q) = %q; want a match for %s", test.name, got, test.want)
+		}
+		if !token.IsIdentifier(got) {
+			t.Errorf("wordsName(%q) = %q is not a valid identifier", test.name, got)
+		}
+		if again := wordsName(sum[:], test.name); again != got {
+			t.Errorf("wordsName(%q) is not deterministic: %q then %q", test.name, got, again)
+		}
+	}
+
+	// Both word counts are used, and the same sum results in the same words.
+	counts := make(map[int]bool)
+	for i := range 64 {
+		sum := sha256.Sum256([]byte{byte(i)})
+		lower := wordsName(sum[:], "some/path")
+		camel := wordsName(sum[:], "someName")
+		if strings.ToLower(camel) != lower {
+			t.Fatalf("%q and %q should be the same words", camel, lower)
+		}
+		counts[len(regexp.MustCompile(`[A-Z]`).FindAllString(camel, -1))+1] = true
+	}
+	if !counts[minNameWords] || !counts[minNameWords+1] || len(counts) != 2 {
+		t.Fatalf("unexpected word counts: %v", counts)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// prepareInstallVersion supports the "garble install pkg@version" form.
+// Unlike "go install", "go list" cannot load packages at a version,
+// so we resolve them in a temporary module which requires them with "go get",
+// and continue from that directory with plain package paths.
+// As with "go install pkg@version", the current module and workspace are ignored.
+//
+// Since the build runs from the temporary module, paths given to Go build flags
+// like -overlay are made absolute, and flags like -modfile are rejected.
+//
+// The returned args are unchanged if no argument has a version suffix.
+// The returned cleanup func must be called once the build is done.
+func prepareInstallVersion(args []string) (_ []string, cleanup func(), _ error) {
+	flags, pkgs := splitFlagsFromArgs(args)
+	version := ""
+	for _, pkg := range pkgs {
+		_, v, ok := strings.Cut(pkg, "@")
+		if ok {
+			version = v
+			break
+		}
+	}
+	if version == "" {
+		return args, func() {}, nil
+	}
+	var paths []string
+	for _, pkg := range pkgs {
+		path, v, ok := strings.Cut(pkg, "@")
+		if !ok || v != version {
+			return nil, nil, fmt.Errorf("%s: all arguments must refer to packages at the same version (@%s)", pkg, version)
+		}
+		if strings.HasPrefix(path, ".") || filepath.IsAbs(path) {
+			return nil, nil, fmt.Errorf("%s: argument must be a package path, not a directory", pkg)
+		}
+		paths = append(paths, path)
+	}
+	flags, err := absInstallFlags(flags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Paths given to garble's own flags are relative to the original directory.
+	for _, p := range []*string{&flagDebugDir, &flagReport, &flagManifest, &flagManifestKey, &flagFromManifest} {
+		if *p == "" {
+			continue
+		}
+		if _, err := os.Stat(*p); err != nil && p == &flagManifestKey {
+			continue // a public key given directly
+		}
+		abs, err := filepath.Abs(*p)
+		if err != nil {
+			return nil, nil, err
+		}
+		*p = abs
+	}
+	if key := os.Getenv("GARBLE_MANIFEST_KEY"); key != "" {
+		abs, err := filepath.Abs(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		_ = os.Setenv("GARBLE_MANIFEST_KEY", abs)
+	}
+
+	origDir, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+	tempDir, err := os.MkdirTemp("", "garble-install-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup = func() {
+		_ = os.Chdir(origDir)
+		_ = os.RemoveAll(tempDir)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "go.mod"), []byte("module garble-install\n"), 0o666); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	_ = os.Setenv("GOWORK", "off")
+	cmd := exec.Command("go", append([]string{"get"}, pkgs...)...)
+	cmd.Dir = tempDir
+	cmd.Stderr = os.Stderr
+	log.Printf("resolving %s in %s", strings.Join(pkgs, " "), tempDir)
+	if err := cmd.Run(); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("cannot resolve %s: %v", strings.Join(pkgs, " "), err)
+	}
+	if err := os.Chdir(tempDir); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return append(flags, paths...), cleanup, nil
+}
+
+// installPathFlags are the Go build flags which take a path
+// relative to the current directory; see absInstallFlags.
+var installPathFlags = map[string]bool{
+	"-overlay": true,
+	"-pgo":     true,
+	"-pkgdir":  true,
+}
+
+// absInstallFlags makes the paths given to Go build flags absolute,
+// so that they keep working from the temporary module of prepareInstallVersion.
+// Flags which refer to the current module make no sense there,
+// so they result in an error, much like "go install pkg@version" does.
+func absInstallFlags(flags []string) ([]string, error) {
+	flags = slices.Clone(flags)
+	for i := 0; i < len(flags); i++ {
+		name, value, hasValue := strings.Cut(flags[i], "=")
+		name = "-" + strings.TrimLeft(name, "-") // "--name" to "-name"
+		switch {
+		case name == "-C" || name == "-modfile":
+			return nil, fmt.Errorf("%s cannot be used with the pkg@version form, as the current module is ignored", name)
+		case !installPathFlags[name]:
+			if !hasValue && !booleanFlags[name] {
+				i++ // "-name value", so skip the value
+			}
+			continue
+		}
+		if !hasValue {
+			// "-name value", so the next arg holds the path.
+			if i++; i >= len(flags) {
+				break
+			}
+			value = flags[i]
+		}
+		if value == "" || name == "-pgo" && (value == "auto" || value == "off") {
+			continue
+		}
+		abs, err := filepath.Abs(value)
+		if err != nil {
+			return nil, err
+		}
+		if hasValue {
+			flags[i] = name + "=" + abs
+		} else {
+			flags[i] = abs
+		}
+	}
+	return flags, nil
+}
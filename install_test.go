@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestAbsInstallFlags(t *testing.T) {
+	abs := func(path string) string {
+		p, err := filepath.Abs(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	tests := []struct {
+		flags   []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			flags: []string{"-tags=foo", "-overlay=overlay.json", "-race", "-pgo", "default.pgo"},
+			want:  []string{"-tags=foo", "-overlay=" + abs("overlay.json"), "-race", "-pgo", abs("default.pgo")},
+		},
+		{
+			flags: []string{"--pkgdir", "pkgs", "-ldflags", "-X=main.v=1", "-pgo=off"},
+			want:  []string{"--pkgdir", abs("pkgs"), "-ldflags", "-X=main.v=1", "-pgo=off"},
+		},
+		{
+			// The value of -gcflags is not a flag of its own.
+			flags: []string{"-gcflags", "-overlay=x", "-pgo=auto"},
+			want:  []string{"-gcflags", "-overlay=x", "-pgo=auto"},
+		},
+		{flags: []string{"-modfile=other.mod"}, wantErr: true},
+		{flags: []string{"-C", "dir"}, wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := absInstallFlags(test.flags)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("absInstallFlags(%q) did not fail", test.flags)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("absInstallFlags(%q): %v", test.flags, err)
+		} else if !slices.Equal(got, test.want) {
+			t.Errorf("absInstallFlags(%q) = %q; want %q", test.flags, got, test.want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"go/ast"
 	"go/constant"
 	"go/token"
+	"go/types"
 	"strconv"
 )
 
@@ -265,3 +266,12 @@ func ConstToAst(val constant.Value) ast.Expr {
 		panic("unreachable")
 	}
 }
+
+// FuncDeclName returns a readable name for a function declaration,
+// such as "Foo" or "(*T).Foo".
+func FuncDeclName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return decl.Name.Name
+	}
+	return "(" + types.ExprString(decl.Recv.List[0].Type) + ")." + decl.Name.Name
+}
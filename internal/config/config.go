@@ -0,0 +1,513 @@
+// Package config loads garble.toml, the module-level file which sets
+// garble's obfuscation policy for every build of a module.
+//
+// An example file, placed next to go.mod:
+//
+//	literals = true
+//	gogarble = "example.com/app"
+//	keep = ["example.com/plugins/*.Plugin", "example.com/app/log.Entry.Level"]
+//
+//	[controlflow]
+//	mode = "auto"
+//	skip-packages = ["example.com/app/internal/asm"]
+//	flatten_passes = 2
+//
+//	[[package]]
+//	path = "example.com/app/internal/hot"
+//	literals = false
+//	controlflow = "off"
+//
+//	[[function]]
+//	package = "example.com/app/server"
+//	name = '(\*Server).Handle*'  # a literal string, so the backslash is kept
+//	controlflow = true
+//	junk_jumps = 8
+//
+// The mode may also be given as a top-level "controlflow" string when no
+// [controlflow] table is needed. Package patterns use the same syntax as GOGARBLE,
+// so they also match the packages below them,
+// and function name patterns use path.Match against names like "Foo" or "(*T).Foo".
+// Keep patterns are like "pkg.Name" or "pkg.Type.Field", where each part
+// is matched separately with path.Match; see Config.KeepName.
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/AeonDave/garble/internal/ctrlflow"
+	"golang.org/x/mod/module"
+)
+
+// FileName is the name of the configuration file, found in the main module's root.
+const FileName = "garble.toml"
+
+// Config holds the settings from a garble.toml file.
+// Unset options are nil or empty.
+type Config struct {
+	Literals    *bool
+	Tiny        *bool
+	ForceRename string // "true", "false" or "auto", like the -force-rename flag
+	ControlFlow string // as per ctrlflow.ParseMode
+
+	GOGARBLE                string
+	BuildNonce              string // as per GARBLE_BUILD_NONCE
+	ControlFlowSkipPackages []string
+
+	// Keep lists patterns of names which must not be obfuscated,
+	// like the //garble:keep directive does in source code.
+	Keep []string
+
+	// ControlFlowParams are the default //garble:controlflow directive
+	// parameters for all functions.
+	ControlFlowParams map[string]string
+
+	Packages  []PackageRule
+	Functions []FunctionRule
+}
+
+// PackageRule overrides settings for the packages matching Path.
+type PackageRule struct {
+	Path              string
+	Literals          *bool
+	ControlFlow       string
+	ControlFlowParams map[string]string
+}
+
+// FunctionRule overrides settings for the functions matching Name,
+// optionally only within the packages matching Package.
+type FunctionRule struct {
+	Package           string
+	Name              string
+	Literals          *bool
+	ControlFlow       *bool
+	ControlFlowParams map[string]string
+}
+
+// Load reads and parses the garble.toml file in dir.
+// It returns a nil Config and no error if the file does not exist.
+func Load(dir string) (*Config, error) {
+	name := filepath.Join(dir, FileName)
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(name, data)
+}
+
+// Parse decodes the contents of a garble.toml file.
+// The name is only used in error messages.
+func Parse(name string, data []byte) (*Config, error) {
+	doc, err := parseTOML(name, data)
+	if err != nil {
+		return nil, err
+	}
+	d := decoder{name: name}
+	cfg := &Config{}
+	for _, key := range slices.Sorted(maps.Keys(doc)) {
+		val := doc[key]
+		switch key {
+		case "literals":
+			cfg.Literals = d.boolPtr(key, val)
+		case "tiny":
+			cfg.Tiny = d.boolPtr(key, val)
+		case "force-rename":
+			cfg.ForceRename = d.forceRename(key, val)
+		case "controlflow":
+			if table, ok := val.(map[string]any); ok {
+				d.controlFlowTable(cfg, table)
+			} else {
+				cfg.ControlFlow = d.mode(key, val)
+			}
+		case "gogarble":
+			cfg.GOGARBLE = d.str(key, val)
+		case "build-nonce":
+			cfg.BuildNonce = d.str(key, val)
+		case "keep":
+			for _, pattern := range d.strs(key, val) {
+				if _, _, err := splitKeepPattern(pattern); err != nil {
+					d.errorf("invalid keep pattern %q: %v", pattern, err)
+				}
+				cfg.Keep = append(cfg.Keep, pattern)
+			}
+		case "package":
+			for _, table := range d.tables(key, val) {
+				cfg.Packages = append(cfg.Packages, d.packageRule(table))
+			}
+		case "function":
+			for _, table := range d.tables(key, val) {
+				cfg.Functions = append(cfg.Functions, d.functionRule(table))
+			}
+		default:
+			d.errorf("unknown key %q", key)
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return cfg, nil
+}
+
+// controlFlowParams are the //garble:controlflow directive parameters
+// which may also be set in garble.toml.
+var controlFlowParams = map[string]bool{
+	"block_splits":      true,
+	"junk_jumps":        true,
+	"flatten_passes":    true,
+	"trash_blocks":      true,
+	"flatten_hardening": true,
+}
+
+// decoder checks the decoded TOML document against the expected schema.
+// It keeps the first error, so that callers can decode everything
+// and check for errors just once.
+type decoder struct {
+	name string
+	err  error
+}
+
+func (d *decoder) errorf(format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%s: %s", d.name, fmt.Sprintf(format, args...))
+	}
+}
+
+func (d *decoder) boolPtr(key string, val any) *bool {
+	b, ok := val.(bool)
+	if !ok {
+		d.errorf("%q must be a boolean", key)
+		return nil
+	}
+	return &b
+}
+
+// forceRename decodes a boolean or "auto" into the -force-rename flag's form.
+func (d *decoder) forceRename(key string, val any) string {
+	switch val := val.(type) {
+	case bool:
+		return strconv.FormatBool(val)
+	case string:
+		if val == "auto" {
+			return val
+		}
+	}
+	d.errorf("%q must be a boolean or \"auto\"", key)
+	return ""
+}
+
+func (d *decoder) str(key string, val any) string {
+	s, ok := val.(string)
+	if !ok {
+		d.errorf("%q must be a string", key)
+	}
+	return s
+}
+
+func (d *decoder) strs(key string, val any) []string {
+	list, ok := val.([]any)
+	if !ok {
+		d.errorf("%q must be an array of strings", key)
+		return nil
+	}
+	var strs []string
+	for _, elem := range list {
+		strs = append(strs, d.str(key, elem))
+	}
+	return strs
+}
+
+func (d *decoder) mode(key string, val any) string {
+	s := d.str(key, val)
+	if _, err := ctrlflow.ParseMode(s); err != nil {
+		d.errorf("%q: %v", key, err)
+	}
+	return s
+}
+
+func (d *decoder) tables(key string, val any) []map[string]any {
+	tables, ok := val.([]map[string]any)
+	if !ok {
+		d.errorf("%q must be an array of tables, like [[%s]]", key, key)
+	}
+	return tables
+}
+
+// param decodes a control-flow directive parameter into its directive form.
+func (d *decoder) param(params map[string]string, key string, val any) map[string]string {
+	if params == nil {
+		params = make(map[string]string)
+	}
+	switch val := val.(type) {
+	case int64:
+		if val < 0 {
+			d.errorf("%q must not be negative", key)
+		}
+		params[key] = strconv.FormatInt(val, 10)
+	case string:
+		params[key] = val
+	case []any:
+		// Like "flatten_hardening=xor,delegate_table" in a directive.
+		params[key] = strings.Join(d.strs(key, val), ",")
+	default:
+		d.errorf("%q must be an integer, a string, or an array of strings", key)
+	}
+	return params
+}
+
+func (d *decoder) controlFlowTable(cfg *Config, table map[string]any) {
+	for _, key := range slices.Sorted(maps.Keys(table)) {
+		val := table[key]
+		switch {
+		case key == "mode":
+			cfg.ControlFlow = d.mode(key, val)
+		case key == "skip-packages":
+			cfg.ControlFlowSkipPackages = d.strs(key, val)
+		case controlFlowParams[key]:
+			cfg.ControlFlowParams = d.param(cfg.ControlFlowParams, key, val)
+		default:
+			d.errorf("unknown key %q in [controlflow]", key)
+		}
+	}
+}
+
+func (d *decoder) packageRule(table map[string]any) PackageRule {
+	var rule PackageRule
+	for _, key := range slices.Sorted(maps.Keys(table)) {
+		val := table[key]
+		switch {
+		case key == "path":
+			rule.Path = d.str(key, val)
+		case key == "literals":
+			rule.Literals = d.boolPtr(key, val)
+		case key == "controlflow":
+			rule.ControlFlow = d.mode(key, val)
+		case controlFlowParams[key]:
+			rule.ControlFlowParams = d.param(rule.ControlFlowParams, key, val)
+		default:
+			d.errorf("unknown key %q in [[package]]", key)
+		}
+	}
+	if rule.Path == "" {
+		d.errorf("[[package]] needs a path")
+	}
+	return rule
+}
+
+func (d *decoder) functionRule(table map[string]any) FunctionRule {
+	var rule FunctionRule
+	for _, key := range slices.Sorted(maps.Keys(table)) {
+		val := table[key]
+		switch {
+		case key == "package":
+			rule.Package = d.str(key, val)
+		case key == "name":
+			rule.Name = d.str(key, val)
+			if _, err := path.Match(rule.Name, ""); err != nil {
+				d.errorf("invalid function name pattern %q: %v", rule.Name, err)
+			}
+		case key == "literals":
+			rule.Literals = d.boolPtr(key, val)
+		case key == "controlflow":
+			rule.ControlFlow = d.boolPtr(key, val)
+		case controlFlowParams[key]:
+			rule.ControlFlowParams = d.param(rule.ControlFlowParams, key, val)
+		default:
+			d.errorf("unknown key %q in [[function]]", key)
+		}
+	}
+	if rule.Name == "" {
+		d.errorf("[[function]] needs a name")
+	}
+	return rule
+}
+
+func matchPackage(pattern, pkgPath string) bool {
+	return pattern == "" || module.MatchPrefixPatterns(pattern, pkgPath)
+}
+
+func (r FunctionRule) matches(pkgPath, funcName string) bool {
+	if !matchPackage(r.Package, pkgPath) {
+		return false
+	}
+	ok, _ := path.Match(r.Name, funcName)
+	return ok
+}
+
+// splitKeepPattern splits a pattern like "example.com/pkg.Type.Field" into its
+// package path and name parts. The name starts at the first dot after the
+// last slash, as package paths may contain dots, but identifiers cannot.
+func splitKeepPattern(pattern string) (pkgPath string, names []string, _ error) {
+	slash := strings.LastIndexByte(pattern, '/')
+	dot := strings.IndexByte(pattern[slash+1:], '.')
+	if dot < 0 {
+		return "", nil, fmt.Errorf("want a form like pkg.Name or pkg.Type.Field")
+	}
+	pkgPath, name := pattern[:slash+1+dot], pattern[slash+1+dot+1:]
+	names = strings.Split(name, ".")
+	if pkgPath == "" || len(names) > 2 || slices.Contains(names, "") {
+		return "", nil, fmt.Errorf("want a form like pkg.Name or pkg.Type.Field")
+	}
+	for _, part := range append([]string{pkgPath}, names...) {
+		if _, err := path.Match(part, ""); err != nil {
+			return "", nil, err
+		}
+	}
+	return pkgPath, names, nil
+}
+
+// KeepName reports whether a name in a package matches a keep pattern.
+// The name is either a top-level name like "Name",
+// or a field or method name qualified by its type, like "Type.Field".
+func (c *Config) KeepName(pkgPath, name string) bool {
+	if c == nil {
+		return false
+	}
+	names := strings.Split(name, ".")
+	for _, pattern := range c.Keep {
+		patternPath, patternNames, _ := splitKeepPattern(pattern) // validated by Parse
+		if len(patternNames) != len(names) {
+			continue
+		}
+		if ok, _ := path.Match(patternPath, pkgPath); !ok {
+			continue
+		}
+		matched := true
+		for i, pattern := range patternNames {
+			if ok, _ := path.Match(pattern, names[i]); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// LiteralsFor reports whether literals should be obfuscated in a package,
+// given the global setting def. The last matching package rule wins.
+func (c *Config) LiteralsFor(pkgPath string, def bool) bool {
+	if c == nil {
+		return def
+	}
+	for _, rule := range c.Packages {
+		if rule.Literals != nil && matchPackage(rule.Path, pkgPath) {
+			def = *rule.Literals
+		}
+	}
+	return def
+}
+
+// FuncLiteralsFor is like LiteralsFor, but for a single function in a package
+// whose literals are being obfuscated. The last matching function rule wins.
+func (c *Config) FuncLiteralsFor(pkgPath, funcName string, def bool) bool {
+	if c == nil {
+		return def
+	}
+	for _, rule := range c.Functions {
+		if rule.Literals != nil && rule.matches(pkgPath, funcName) {
+			def = *rule.Literals
+		}
+	}
+	return def
+}
+
+// HasFuncLiterals reports whether any function rule sets literals.
+func (c *Config) HasFuncLiterals() bool {
+	return c != nil && slices.ContainsFunc(c.Functions, func(r FunctionRule) bool { return r.Literals != nil })
+}
+
+// ControlFlowFor returns the control-flow mode for a package,
+// given the global mode def. The last matching package rule wins.
+func (c *Config) ControlFlowFor(pkgPath string, def ctrlflow.Mode) ctrlflow.Mode {
+	if c == nil {
+		return def
+	}
+	for _, rule := range c.Packages {
+		if rule.ControlFlow != "" && matchPackage(rule.Path, pkgPath) {
+			def, _ = ctrlflow.ParseMode(rule.ControlFlow) // validated by Parse
+		}
+	}
+	return def
+}
+
+// AnyControlFlow reports whether any package rule enables control-flow obfuscation.
+func (c *Config) AnyControlFlow() bool {
+	if c == nil {
+		return false
+	}
+	for _, rule := range c.Packages {
+		if rule.ControlFlow == "" {
+			continue
+		}
+		if mode, _ := ctrlflow.ParseMode(rule.ControlFlow); mode.Enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// FuncOverride returns the control-flow settings for a function in a package.
+// Parameters are merged from [controlflow], the matching package rules,
+// and then the matching function rules, with later ones taking precedence.
+func (c *Config) FuncOverride(pkgPath, funcName string) ctrlflow.Override {
+	var o ctrlflow.Override
+	if c == nil {
+		return o
+	}
+	merge := func(params map[string]string) {
+		if len(params) == 0 {
+			return
+		}
+		if o.Params == nil {
+			o.Params = make(map[string]string)
+		}
+		for k, v := range params {
+			o.Params[k] = v
+		}
+	}
+	merge(c.ControlFlowParams)
+	for _, rule := range c.Packages {
+		if matchPackage(rule.Path, pkgPath) {
+			merge(rule.ControlFlowParams)
+		}
+	}
+	for _, rule := range c.Functions {
+		if rule.matches(pkgPath, funcName) {
+			merge(rule.ControlFlowParams)
+			if rule.ControlFlow != nil {
+				o.Enable = rule.ControlFlow
+			}
+		}
+	}
+	return o
+}
+
+// Hash returns a digest of the whole configuration,
+// so that it can be part of the build cache keys.
+func (c *Config) Hash() []byte {
+	if c == nil {
+		return nil
+	}
+	// encoding/json sorts map keys, so the output is deterministic.
+	data, err := json.Marshal(c)
+	if err != nil {
+		panic(err) // shouldn't happen
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
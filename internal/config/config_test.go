@@ -0,0 +1,177 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/AeonDave/garble/internal/ctrlflow"
+)
+
+const sampleConfig = `
+# Module-wide policy.
+literals = true
+tiny = false
+gogarble = "test/main"
+keep = ["test/main/plugins/*.Plugin", "example.com/lib.Entry.*"]
+build-nonce = 'AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA'
+
+[controlflow]
+mode = "auto"
+skip-packages = [
+	"test/main/asm", # trailing comments and commas are fine
+]
+flatten_passes = 2
+flatten_hardening = ["xor", "delegate_table"]
+
+[[package]]
+path = "test/main/hot"
+literals = false
+controlflow = "off"
+
+[[package]]
+path = "test/main/secret"
+block_splits = "max"
+
+[[function]]
+package = "test/main/secret"
+name = '(\*Server).Handle*'
+controlflow = true
+junk_jumps = 8
+literals = false
+
+[[function]]
+name = "init"
+controlflow = false
+`
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse("garble.toml", []byte(sampleConfig))
+	qt.Assert(t, qt.IsNil(err))
+
+	qt.Assert(t, qt.DeepEquals(cfg.Literals, ptr(true)))
+	qt.Assert(t, qt.DeepEquals(cfg.Tiny, ptr(false)))
+	qt.Assert(t, qt.Equals(cfg.ForceRename, ""))
+	qt.Assert(t, qt.Equals(cfg.ControlFlow, "auto"))
+	qt.Assert(t, qt.Equals(cfg.GOGARBLE, "test/main"))
+	qt.Assert(t, qt.DeepEquals(cfg.ControlFlowSkipPackages, []string{"test/main/asm"}))
+	qt.Assert(t, qt.DeepEquals(cfg.ControlFlowParams, map[string]string{
+		"flatten_passes":    "2",
+		"flatten_hardening": "xor,delegate_table",
+	}))
+	qt.Assert(t, qt.DeepEquals(cfg.Keep, []string{"test/main/plugins/*.Plugin", "example.com/lib.Entry.*"}))
+	qt.Assert(t, qt.HasLen(cfg.Packages, 2))
+	qt.Assert(t, qt.HasLen(cfg.Functions, 2))
+
+	qt.Assert(t, qt.IsFalse(cfg.LiteralsFor("test/main", false)))
+	qt.Assert(t, qt.IsTrue(cfg.LiteralsFor("test/main", true)))
+	qt.Assert(t, qt.IsFalse(cfg.LiteralsFor("test/main/hot/loop", true)))
+	qt.Assert(t, qt.IsFalse(cfg.FuncLiteralsFor("test/main/secret", "(*Server).HandleLogin", true)))
+	qt.Assert(t, qt.IsTrue(cfg.FuncLiteralsFor("test/main/secret", "(*Server).Close", true)))
+	qt.Assert(t, qt.IsTrue(cfg.FuncLiteralsFor("test/main/other", "(*Server).HandleLogin", true)))
+	qt.Assert(t, qt.IsTrue(cfg.HasFuncLiterals()))
+
+	qt.Assert(t, qt.IsTrue(cfg.KeepName("test/main/plugins/foo", "Plugin")))
+	qt.Assert(t, qt.IsFalse(cfg.KeepName("test/main/plugins/foo/bar", "Plugin")))
+	qt.Assert(t, qt.IsFalse(cfg.KeepName("test/main/plugins/foo", "Plugin.Name")))
+	qt.Assert(t, qt.IsTrue(cfg.KeepName("example.com/lib", "Entry.Level")))
+	qt.Assert(t, qt.IsFalse(cfg.KeepName("example.com/lib", "Entry")))
+
+	qt.Assert(t, qt.Equals(cfg.ControlFlowFor("test/main/hot", ctrlflow.ModeAuto), ctrlflow.ModeOff))
+	qt.Assert(t, qt.Equals(cfg.ControlFlowFor("test/main", ctrlflow.ModeAuto), ctrlflow.ModeAuto))
+	qt.Assert(t, qt.IsFalse(cfg.AnyControlFlow()))
+
+	o := cfg.FuncOverride("test/main/secret", "(*Server).HandleLogin")
+	qt.Assert(t, qt.DeepEquals(o.Enable, ptr(true)))
+	qt.Assert(t, qt.DeepEquals(o.Params, map[string]string{
+		"flatten_passes":    "2",
+		"flatten_hardening": "xor,delegate_table",
+		"block_splits":      "max",
+		"junk_jumps":        "8",
+	}))
+	o = cfg.FuncOverride("test/main", "init")
+	qt.Assert(t, qt.DeepEquals(o.Enable, ptr(false)))
+
+	qt.Assert(t, qt.HasLen(cfg.Hash(), 32))
+	var nilCfg *Config
+	qt.Assert(t, qt.IsNil(nilCfg.Hash()))
+	qt.Assert(t, qt.IsTrue(nilCfg.LiteralsFor("x", true)))
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name, src, wantErr string
+	}{
+		{"UnknownKey", "literal = true", `garble.toml: unknown key "literal"`},
+		{"WrongType", "literals = 1", `garble.toml: "literals" must be a boolean`},
+		{"BadForceRename", `force-rename = "yes"`, `garble.toml: "force-rename" must be a boolean or "auto"`},
+		{"BadMode", `controlflow = "sometimes"`, `garble.toml: "controlflow": .*`},
+		{"DuplicateKey", "tiny = true\ntiny = false", `garble.toml:2: "tiny" is defined more than once`},
+		{"UnterminatedString", `gogarble = "foo`, `garble.toml:1: unterminated string`},
+		{"UnterminatedArray", "[controlflow]\nskip-packages = [\"a\",", `garble.toml:2: unterminated array`},
+		{"TrailingGarbage", "tiny = true false", `garble.toml:1: unexpected 'f' at end of line`},
+		{"PackageWithoutPath", "[[package]]\nliterals = false", `garble.toml: \[\[package\]\] needs a path`},
+		{"TableNotArray", "[package]\npath = \"x\"", `garble.toml: "package" must be an array of tables, .*`},
+		{"BadParam", "[controlflow]\njunk_jumps = true", `garble.toml: "junk_jumps" must be .*`},
+		{"BadPattern", "[[function]]\nname = \"[\"", `garble.toml: invalid function name pattern .*`},
+		{"KeepWithoutName", `keep = ["example.com/lib"]`, `garble.toml: invalid keep pattern "example.com/lib": want a form like .*`},
+		{"KeepTooDeep", `keep = ["lib.A.B.C"]`, `garble.toml: invalid keep pattern "lib.A.B.C": want a form like .*`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse("garble.toml", []byte(test.src))
+			qt.Assert(t, qt.ErrorMatches(err, test.wantErr))
+		})
+	}
+}
+
+func TestParseForceRename(t *testing.T) {
+	for src, want := range map[string]string{
+		"force-rename = true":     "true",
+		"force-rename = false":    "false",
+		`force-rename = "auto"`:   "auto",
+		`"force-rename" = 'auto'`: "auto",
+	} {
+		cfg, err := Parse("garble.toml", []byte(src))
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.Equals(cfg.ForceRename, want))
+	}
+}
+
+func TestParseStrings(t *testing.T) {
+	tests := []struct {
+		src, want, wantErr string
+	}{
+		{`'C:\dir\*.go'`, `C:\dir\*.go`, ""},
+		{`"tab\tnewline\nquote\"backslash\\"`, "tab\tnewline\nquote\"backslash\\", ""},
+		{`"\b\f\r"`, "\b\f\r", ""},
+		{`"\u00e9\U0001F600"`, "\u00e9\U0001F600", ""},
+		// Go escapes which TOML doesn't have.
+		{`"\a"`, "", `garble.toml:1: invalid escape sequence \\a`},
+		{`"\x41"`, "", `garble.toml:1: invalid escape sequence \\x`},
+		{`"\101"`, "", `garble.toml:1: invalid escape sequence \\1`},
+		{`"\'"`, "", `garble.toml:1: invalid escape sequence \\'`},
+		{`"\u00"`, "", `garble.toml:1: invalid escape sequence \\u00`},
+		{`"\uD800"`, "", `garble.toml:1: invalid escape sequence \\uD800`},
+		{`"\U00110000"`, "", `garble.toml:1: invalid escape sequence \\U00110000`},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			cfg, err := Parse("garble.toml", []byte("gogarble = "+test.src))
+			if test.wantErr != "" {
+				qt.Assert(t, qt.ErrorMatches(err, test.wantErr))
+				return
+			}
+			qt.Assert(t, qt.IsNil(err))
+			qt.Assert(t, qt.Equals(cfg.GOGARBLE, test.want))
+		})
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	cfg, err := Load(t.TempDir())
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(cfg))
+}
+
+func ptr[T any](v T) *T { return &v }
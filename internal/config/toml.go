@@ -0,0 +1,303 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML decodes the subset of TOML which garble.toml needs:
+// comments, bare or quoted keys, strings, booleans, integers, arrays,
+// [tables], and [[arrays of tables]]. Dotted keys, floats, dates,
+// inline tables, and multi-line strings are not supported.
+// Basic strings only accept TOML's escape sequences; see unescape.
+//
+// Tables are decoded as map[string]any, arrays of tables as []map[string]any,
+// arrays as []any, and integers as int64.
+func parseTOML(name string, src []byte) (map[string]any, error) {
+	p := &tomlParser{name: name, src: src, line: 1}
+	root := make(map[string]any)
+	cur := root
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return root, nil
+		}
+		if p.peek() == '[' {
+			array := strings.HasPrefix(string(p.src[p.pos:]), "[[")
+			if array {
+				p.pos += 2
+			} else {
+				p.pos++
+			}
+			p.skipBlank(false)
+			key, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			p.skipBlank(false)
+			closing := "]"
+			if array {
+				closing = "]]"
+			}
+			if !strings.HasPrefix(string(p.src[p.pos:]), closing) {
+				return nil, p.errorf("expected %q after table name", closing)
+			}
+			p.pos += len(closing)
+			if err := p.endOfLine(); err != nil {
+				return nil, err
+			}
+			table := make(map[string]any)
+			switch existing := root[key].(type) {
+			case nil:
+				if array {
+					root[key] = []map[string]any{table}
+				} else {
+					root[key] = table
+				}
+			case []map[string]any:
+				if !array {
+					return nil, p.errorf("%q is an array of tables", key)
+				}
+				root[key] = append(existing, table)
+			default:
+				return nil, p.errorf("%q is defined more than once", key)
+			}
+			cur = table
+			continue
+		}
+
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if p.eof() || p.peek() != '=' {
+			return nil, p.errorf("expected '=' after key %q", key)
+		}
+		p.pos++
+		p.skipBlank(false)
+		val, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := cur[key]; ok {
+			return nil, p.errorf("%q is defined more than once", key)
+		}
+		cur[key] = val
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type tomlParser struct {
+	name string
+	src  []byte
+	pos  int
+	line int
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", p.name, p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) eof() bool  { return p.pos >= len(p.src) }
+func (p *tomlParser) peek() byte { return p.src[p.pos] }
+
+// skipBlank skips spaces, tabs, and comments.
+// If newlines is true, it also skips any number of line breaks.
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) endOfLine() error {
+	p.skipBlank(false)
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return p.errorf("unexpected %q at end of line", p.peek())
+	}
+	return nil
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) key() (string, error) {
+	if p.eof() {
+		return "", p.errorf("expected a key")
+	}
+	if c := p.peek(); c == '"' || c == '\'' {
+		return p.str()
+	}
+	start := p.pos
+	for !p.eof() && isBareKeyChar(p.peek()) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("invalid key character %q", p.peek())
+	}
+	return string(p.src[start:p.pos]), nil
+}
+
+func (p *tomlParser) str() (string, error) {
+	quote := p.peek()
+	start := p.pos
+	p.pos++
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		p.pos++
+		if c == '\\' && quote == '"' && !p.eof() {
+			p.pos++ // skip the escaped character
+			continue
+		}
+		if c == quote {
+			break
+		}
+	}
+	raw := string(p.src[start:p.pos])
+	if quote == '\'' {
+		return raw[1 : len(raw)-1], nil
+	}
+	return p.unescape(raw[1 : len(raw)-1])
+}
+
+// tomlEscapes holds TOML's single-character escape sequences.
+// Unlike Go, TOML has no \a, \v, \', octal, or \x escapes.
+var tomlEscapes = map[byte]byte{
+	'b':  '\b',
+	't':  '\t',
+	'n':  '\n',
+	'f':  '\f',
+	'r':  '\r',
+	'"':  '"',
+	'\\': '\\',
+}
+
+// unescape decodes the escape sequences in the body of a basic string,
+// which are the ones in tomlEscapes plus \uXXXX and \UXXXXXXXX.
+func (p *tomlParser) unescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		c := s[i] // str ensures that a backslash is never last
+		if r, ok := tomlEscapes[c]; ok {
+			b.WriteByte(r)
+			continue
+		}
+		size := 0
+		switch c {
+		case 'u':
+			size = 4
+		case 'U':
+			size = 8
+		default:
+			return "", p.errorf("invalid escape sequence \\%c", c)
+		}
+		hex := s[i+1 : min(i+1+size, len(s))]
+		code, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || len(hex) != size || !utf8.ValidRune(rune(code)) {
+			return "", p.errorf("invalid escape sequence \\%c%s", c, hex)
+		}
+		b.WriteRune(rune(code))
+		i += size
+	}
+	return b.String(), nil
+}
+
+func (p *tomlParser) value() (any, error) {
+	if p.eof() {
+		return nil, p.errorf("expected a value")
+	}
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '[':
+		return p.array()
+	case c == '+' || c == '-' || c >= '0' && c <= '9':
+		start := p.pos
+		for !p.eof() && (isBareKeyChar(p.peek()) || p.peek() == '+') {
+			p.pos++
+		}
+		raw := string(p.src[start:p.pos])
+		n, err := strconv.ParseInt(strings.ReplaceAll(raw, "_", ""), 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid integer %q", raw)
+		}
+		return n, nil
+	default:
+		start := p.pos
+		for !p.eof() && isBareKeyChar(p.peek()) {
+			p.pos++
+		}
+		switch word := string(p.src[start:p.pos]); word {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "":
+			return nil, p.errorf("unexpected %q", c)
+		default:
+			return nil, p.errorf("unsupported value %q", word)
+		}
+	}
+}
+
+func (p *tomlParser) array() ([]any, error) {
+	p.pos++ // '['
+	list := []any{}
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return list, nil
+		}
+		val, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, val)
+		p.skipBlank(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected ',' or ']' in array")
+		}
+	}
+}
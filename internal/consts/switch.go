@@ -0,0 +1,175 @@
+package consts
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strconv"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// LowerStringSwitches rewrites the switch statements in node whose tag is a
+// string and whose case expressions are all constants into switches without
+// a tag, comparing a variable holding the tag against each case expression:
+//
+//	switch init; tag {        {
+//	case "a", "b":                init
+//		...               =>      switch v := tag; {
+//	}                             case v == "a", v == "b":
+//	                                  ...
+//	                              }
+//	                          }
+//
+// The case expressions are then no longer a constant context, so their
+// literals and constants can be obfuscated. A tag with a named string type is
+// converted to string, and its case expressions are folded into string
+// literals. The tag is still evaluated once, before the case expressions,
+// which are still evaluated in order until one matches, so the first of any
+// duplicate values wins; fallthrough, break and default work as before.
+//
+// The types of the new expressions are recorded in info.
+// It returns the number of switch statements which were rewritten.
+func LowerStringSwitches(node ast.Node, info *types.Info, pkg *types.Package) int {
+	lowered := 0
+	post := func(cursor *astutil.Cursor) bool {
+		sw, ok := cursor.Node().(*ast.SwitchStmt)
+		if !ok || !lowerable(sw, info, pkg) {
+			return true
+		}
+		if _, labeled := cursor.Parent().(*ast.LabeledStmt); labeled && sw.Init != nil {
+			// Moving the init statement into a block would move the label
+			// into it too, and a goto from outside cannot jump into a block.
+			return true
+		}
+		cursor.Replace(lowerSwitch(sw, info, pkg))
+		lowered++
+		return true
+	}
+	astutil.Apply(node, nil, post)
+	return lowered
+}
+
+// lowerable reports whether a switch statement can be rewritten by
+// LowerStringSwitches.
+func lowerable(sw *ast.SwitchStmt, info *types.Info, pkg *types.Package) bool {
+	if sw.Tag == nil {
+		return false
+	}
+	tv := info.Types[sw.Tag]
+	if !tv.IsValue() || tv.Value != nil {
+		return false
+	}
+	basic, ok := tv.Type.Underlying().(*types.Basic)
+	if !ok || basic.Kind() != types.String {
+		return false
+	}
+	if !types.Identical(tv.Type, types.Typ[types.String]) {
+		// We need a conversion to string, so the name must not be shadowed.
+		scope := pkg.Scope().Innermost(sw.Tag.Pos())
+		if scope == nil {
+			return false
+		}
+		if _, obj := scope.LookupParent("string", sw.Tag.Pos()); obj != types.Universe.Lookup("string") {
+			return false
+		}
+	}
+	cases := 0
+	for _, stmt := range sw.Body.List {
+		clause := stmt.(*ast.CaseClause)
+		for _, expr := range clause.List {
+			if info.Types[expr].Value == nil {
+				return false
+			}
+			cases++
+		}
+	}
+	return cases > 0
+}
+
+// lowerSwitch rewrites a switch statement as documented in LowerStringSwitches.
+func lowerSwitch(sw *ast.SwitchStmt, info *types.Info, pkg *types.Package) ast.Stmt {
+	tagTV := info.Types[sw.Tag]
+	named := !types.Identical(tagTV.Type, types.Typ[types.String])
+	name := unusedName(sw, "tag")
+	obj := types.NewVar(sw.Tag.Pos(), pkg, name, types.Typ[types.String])
+
+	value := sw.Tag
+	if named {
+		conv := &ast.CallExpr{
+			Fun:    &ast.Ident{NamePos: sw.Tag.Pos(), Name: "string"},
+			Lparen: sw.Tag.Pos(),
+			Args:   []ast.Expr{sw.Tag},
+			Rparen: sw.Tag.End(),
+		}
+		info.Uses[conv.Fun.(*ast.Ident)] = types.Universe.Lookup("string")
+		tv := tagTV
+		tv.Type = types.Typ[types.String]
+		info.Types[conv] = tv
+		value = conv
+	}
+	def := &ast.Ident{NamePos: sw.Tag.Pos(), Name: name}
+	info.Defs[def] = obj
+
+	for _, stmt := range sw.Body.List {
+		clause := stmt.(*ast.CaseClause)
+		for i, expr := range clause.List {
+			if named {
+				expr = stringLit(expr, info)
+			}
+			use := &ast.Ident{NamePos: expr.Pos(), Name: name}
+			info.Uses[use] = obj
+			clause.List[i] = &ast.BinaryExpr{X: use, OpPos: expr.Pos(), Op: token.EQL, Y: expr}
+		}
+	}
+	lowered := &ast.SwitchStmt{
+		Switch: sw.Switch,
+		Init: &ast.AssignStmt{
+			Lhs:    []ast.Expr{def},
+			TokPos: sw.Tag.Pos(),
+			Tok:    token.DEFINE,
+			Rhs:    []ast.Expr{value},
+		},
+		Body: sw.Body,
+	}
+	if sw.Init == nil {
+		return lowered
+	}
+	return &ast.BlockStmt{
+		Lbrace: sw.Switch,
+		List:   []ast.Stmt{sw.Init, lowered},
+		Rbrace: sw.Body.Rbrace,
+	}
+}
+
+// stringLit returns a string literal with the value of a constant expression,
+// with its type recorded in info as string.
+func stringLit(expr ast.Expr, info *types.Info) ast.Expr {
+	tv := info.Types[expr]
+	tv.Type = types.Typ[types.String]
+	lit := &ast.BasicLit{
+		ValuePos: expr.Pos(),
+		Kind:     token.STRING,
+		Value:    strconv.Quote(constant.StringVal(tv.Value)),
+	}
+	info.Types[lit] = tv
+	return lit
+}
+
+// unusedName returns a name based on base which no identifier under node has,
+// so that declaring it cannot shadow anything used there.
+func unusedName(node ast.Node, base string) string {
+	used := make(map[string]bool)
+	ast.Inspect(node, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			used[ident.Name] = true
+		}
+		return true
+	})
+	name := base
+	for i := 1; used[name]; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	return name
+}
@@ -2,8 +2,12 @@ package consts
 
 import (
 	"go/ast"
+	"go/constant"
 	"go/token"
 	"go/types"
+	"strconv"
+
+	"github.com/AeonDave/garble/internal/typesutil"
 )
 
 // Transform tracks const identifiers that are rewritten into vars.
@@ -12,13 +16,23 @@ type Transform struct {
 	VarObj *types.Var
 }
 
-func ComputeTransforms(files []*ast.File, info *types.Info, pkg *types.Package) map[*types.Const]*Transform {
+// ComputeTransforms returns the constants declared in files which can be
+// rewritten into variables, so that their values are obfuscated like those
+// of any other package-level variable. A constant qualifies if it has a string
+// value, with a basic or named type as allowed by typesutil.IsSafeInstanceType,
+// and if none of its uses in files require a constant; see needsConst.
+// Values given by constant expressions are folded into literals.
+//
+// Other packages may require an exported constant to stay a constant,
+// so those only qualify if exported reports that none do.
+// If exported is nil, exported constants never qualify.
+func ComputeTransforms(files []*ast.File, info *types.Info, pkg *types.Package, exported func(*types.Const) bool) map[*types.Const]*Transform {
 	parentMaps := make(map[*ast.File]map[ast.Node]ast.Node, len(files))
 	constUses := make(map[*types.Const][]*ast.Ident)
 	identFile := make(map[*ast.Ident]*ast.File)
 
 	for _, file := range files {
-		parentMaps[file] = buildParentMap(file)
+		parentMaps[file] = BuildParentMap(file)
 		ast.Inspect(file, func(n ast.Node) bool {
 			ident, ok := n.(*ast.Ident)
 			if !ok {
@@ -40,7 +54,7 @@ func ComputeTransforms(files []*ast.File, info *types.Info, pkg *types.Package)
 	requiresConst := make(map[*types.Const]bool, len(constUses))
 	for obj, idents := range constUses {
 		for _, ident := range idents {
-			if isConstContext(ident, parentMaps[identFile[ident]]) {
+			if needsConst(ident, obj, parentMaps[identFile[ident]], info) {
 				requiresConst[obj] = true
 				break
 			}
@@ -62,12 +76,12 @@ func ComputeTransforms(files []*ast.File, info *types.Info, pkg *types.Package)
 				if len(vs.Names) == 0 || len(vs.Values) != len(vs.Names) {
 					continue
 				}
-				for idx, name := range vs.Names {
+				for _, name := range vs.Names {
 					obj, ok := info.Defs[name].(*types.Const)
 					if !ok || obj.Pkg() != pkg {
 						continue
 					}
-					if obj.Exported() {
+					if obj.Exported() && (exported == nil || !exported(obj)) {
 						continue
 					}
 					if requiresConst[obj] {
@@ -77,10 +91,7 @@ func ComputeTransforms(files []*ast.File, info *types.Info, pkg *types.Package)
 					if len(uses) == 0 {
 						continue
 					}
-					if !isBasicStringConst(obj) {
-						continue
-					}
-					if lit, ok := vs.Values[idx].(*ast.BasicLit); !ok || lit.Kind != token.STRING {
+					if !convertible(obj, vs.Type) {
 						continue
 					}
 					if _, seen := transforms[obj]; !seen {
@@ -94,6 +105,32 @@ func ComputeTransforms(files []*ast.File, info *types.Info, pkg *types.Package)
 	return transforms
 }
 
+// RequiredImports returns the constants declared in other packages
+// which files use where a constant is required; see needsConst.
+func RequiredImports(files []*ast.File, info *types.Info, pkg *types.Package) []*types.Const {
+	var required []*types.Const
+	seen := make(map[*types.Const]bool)
+	for _, file := range files {
+		parents := BuildParentMap(file)
+		ast.Inspect(file, func(n ast.Node) bool {
+			ident, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			obj, ok := info.Uses[ident].(*types.Const)
+			if !ok || obj.Pkg() == nil || obj.Pkg() == pkg || seen[obj] {
+				return true
+			}
+			if needsConst(ident, obj, parents, info) {
+				seen[obj] = true
+				required = append(required, obj)
+			}
+			return true
+		})
+	}
+	return required
+}
+
 func RewriteDecls(file *ast.File, info *types.Info, transforms map[*types.Const]*Transform) {
 	if len(transforms) == 0 {
 		return
@@ -138,13 +175,6 @@ func RewriteDecls(file *ast.File, info *types.Info, transforms map[*types.Const]
 					keptValues = append(keptValues, vs.Values[idx])
 					continue
 				}
-				lit, ok := vs.Values[idx].(*ast.BasicLit)
-				if !ok || lit.Kind != token.STRING {
-					keptNames = append(keptNames, name)
-					keptValues = append(keptValues, vs.Values[idx])
-					continue
-				}
-
 				changed = true
 
 				varDoc := vs.Doc
@@ -162,7 +192,7 @@ func RewriteDecls(file *ast.File, info *types.Info, transforms map[*types.Const]
 					Doc:     varDoc,
 					Comment: varComment,
 					Names:   []*ast.Ident{name},
-					Values:  []ast.Expr{vs.Values[idx]},
+					Values:  []ast.Expr{foldedValue(obj, vs.Values[idx], vs.Type, info)},
 				}
 				varDecl := &ast.GenDecl{
 					Tok:   token.VAR,
@@ -213,7 +243,8 @@ func RewriteDecls(file *ast.File, info *types.Info, transforms map[*types.Const]
 	}
 }
 
-func buildParentMap(root ast.Node) map[ast.Node]ast.Node {
+// BuildParentMap maps each node under root to its parent, for IsConstContext.
+func BuildParentMap(root ast.Node) map[ast.Node]ast.Node {
 	parents := make(map[ast.Node]ast.Node)
 	var stack []ast.Node
 	ast.Inspect(root, func(n ast.Node) bool {
@@ -232,7 +263,11 @@ func buildParentMap(root ast.Node) map[ast.Node]ast.Node {
 	return parents
 }
 
-func isConstContext(node ast.Node, parents map[ast.Node]ast.Node) bool {
+// IsConstContext reports whether an expression is required to be constant,
+// by being part of a constant declaration, a case clause of a switch with a tag,
+// an array length, or a composite literal key, which must be constant for
+// arrays and slices.
+func IsConstContext(node ast.Node, parents map[ast.Node]ast.Node) bool {
 	if parents == nil {
 		return false
 	}
@@ -244,6 +279,10 @@ func isConstContext(node ast.Node, parents map[ast.Node]ast.Node) bool {
 				return true
 			}
 		case *ast.CaseClause:
+			// The boolean cases of a switch without a tag need not be constant.
+			if sw, ok := parents[parents[p]].(*ast.SwitchStmt); ok && sw.Tag == nil {
+				break
+			}
 			for _, expr := range p.List {
 				if expr == child {
 					return true
@@ -253,21 +292,109 @@ func isConstContext(node ast.Node, parents map[ast.Node]ast.Node) bool {
 			if p.Len == child {
 				return true
 			}
+		case *ast.KeyValueExpr:
+			if p.Key == child {
+				if _, ok := parents[p].(*ast.CompositeLit); ok {
+					return true
+				}
+			}
 		}
 	}
 	return false
 }
 
-func isBasicStringConst(obj *types.Const) bool {
-	typ := obj.Type()
-	if _, isNamed := typ.(*types.Named); isNamed {
+// needsConst reports whether a use of a constant must remain a constant
+// expression. Besides the contexts in IsConstContext, an untyped constant
+// may be implicitly converted to a named type, which a string variable cannot.
+func needsConst(ident *ast.Ident, obj *types.Const, parents map[ast.Node]ast.Node, info *types.Info) bool {
+	if IsConstContext(ident, parents) {
+		return true
+	}
+	if basic, ok := obj.Type().(*types.Basic); !ok || basic.Info()&types.IsUntyped == 0 {
 		return false
 	}
-	if basic, ok := typ.(*types.Basic); ok {
-		switch basic.Kind() {
-		case types.String, types.UntypedString:
-			return true
-		}
+	var expr ast.Expr = ident
+	if sel, ok := parents[ident].(*ast.SelectorExpr); ok && sel.Sel == ident {
+		expr = sel
+	}
+	basic, ok := info.Types[expr].Type.(*types.Basic)
+	return !ok || (basic.Kind() != types.String && basic.Kind() != types.UntypedString)
+}
+
+// convertible reports whether a constant's declaration, with an optional
+// explicit type, can be rewritten into that of a variable.
+func convertible(obj *types.Const, typ ast.Expr) bool {
+	if obj.Val().Kind() != constant.String || !typesutil.IsSafeInstanceType(obj.Type()) {
+		return false
+	}
+	switch t := types.Unalias(obj.Type()).(type) {
+	case *types.Basic:
+		return t.Kind() == types.String || t.Kind() == types.UntypedString
+	case *types.Named:
+		// The folded value is converted to the named type,
+		// so we need a type expression we can copy.
+		_, ok := t.Underlying().(*types.Basic)
+		return ok && copyTypeName(typ, nil) != nil
 	}
 	return false
 }
+
+// foldedValue returns a string literal with the value of a constant,
+// converted to its type via a copy of the explicit type if it is named.
+// The literal's type is recorded in info, so that it can be obfuscated.
+func foldedValue(obj *types.Const, value, typ ast.Expr, info *types.Info) ast.Expr {
+	tv := info.Types[value]
+	tv.Type = types.Typ[types.String]
+	tv.Value = obj.Val()
+	lit := &ast.BasicLit{
+		ValuePos: value.Pos(),
+		Kind:     token.STRING,
+		Value:    strconv.Quote(constant.StringVal(obj.Val())),
+	}
+	info.Types[lit] = tv
+	if _, ok := types.Unalias(obj.Type()).(*types.Named); !ok {
+		return lit
+	}
+	return &ast.CallExpr{
+		Fun:    copyTypeName(typ, info),
+		Lparen: value.Pos(),
+		Args:   []ast.Expr{lit},
+		Rparen: value.End(),
+	}
+}
+
+// copyTypeName copies a type name such as "T" or "pkg.T", along with its
+// type information in info if not nil. It returns nil for any other expression.
+func copyTypeName(expr ast.Expr, info *types.Info) ast.Expr {
+	copyIdent := func(ident *ast.Ident) *ast.Ident {
+		dup := &ast.Ident{NamePos: ident.NamePos, Name: ident.Name}
+		if info != nil {
+			if obj := info.Uses[ident]; obj != nil {
+				info.Uses[dup] = obj
+			}
+			if tv, ok := info.Types[ident]; ok {
+				info.Types[dup] = tv
+			}
+		}
+		return dup
+	}
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return copyIdent(expr)
+	case *ast.SelectorExpr:
+		x, ok := expr.X.(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		dup := &ast.SelectorExpr{X: copyIdent(x), Sel: copyIdent(expr.Sel)}
+		if info != nil {
+			if tv, ok := info.Types[expr]; ok {
+				info.Types[dup] = tv
+			}
+		}
+		return dup
+	case *ast.ParenExpr:
+		return copyTypeName(expr.X, info)
+	}
+	return nil
+}
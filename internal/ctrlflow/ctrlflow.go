@@ -2,11 +2,13 @@ package ctrlflow
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"go/ast"
 	"go/format"
 	"go/token"
 	"go/types"
+	"log/slog"
 	"math"
 	mathrand "math/rand"
 	"os"
@@ -16,6 +18,7 @@ import (
 	"sync"
 
 	ah "github.com/AeonDave/garble/internal/asthelper"
+	"github.com/AeonDave/garble/internal/literals"
 	"github.com/AeonDave/garble/internal/ssa2ast"
 	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/ssa"
@@ -67,11 +70,20 @@ func parseControlflowSkipPkgs(raw string) map[string]bool {
 	return skip
 }
 
+// debugf prints to stderr with GARBLE_CONTROLFLOW_DEBUG=1.
+// It is also a debug event with log/slog, such as for "garble -debug=json".
 func debugf(format string, args ...any) {
-	if !ctrlflowDebug {
+	debugEvent := slog.Default().Enabled(context.Background(), slog.LevelDebug)
+	if !ctrlflowDebug && !debugEvent {
 		return
 	}
-	_, _ = fmt.Fprintf(os.Stderr, "[ctrlflow] "+format+"\n", args...)
+	msg := fmt.Sprintf(format, args...)
+	if ctrlflowDebug {
+		_, _ = fmt.Fprintln(os.Stderr, "[ctrlflow] "+msg)
+	}
+	if debugEvent {
+		slog.Debug("controlflow", "detail", msg)
+	}
 }
 
 // loadSkippedPackages loads the list of packages that were skipped during control-flow obfuscation
@@ -210,6 +222,42 @@ func extractControlFlowIntent(doc *ast.CommentGroup) (directiveParamMap, bool, b
 	return params, hasDirective, false
 }
 
+// Override holds the control-flow settings for a function which come from
+// outside its source code, such as a garble.toml file.
+type Override struct {
+	// Params are the defaults for the //garble:controlflow directive parameters,
+	// such as "flatten_passes". Parameters given in a directive take precedence.
+	Params map[string]string
+
+	// Enable, if non-nil, includes the function as if it had the
+	// //garble:controlflow directive, or excludes it as if it had
+	// //garble:nocontrolflow. An explicit //garble:nocontrolflow always wins.
+	Enable *bool
+}
+
+// apply merges the override into the intent extracted from a function's directives,
+// which must not include //garble:nocontrolflow.
+func (o Override) apply(params directiveParamMap, hasDirective, skip bool) (directiveParamMap, bool, bool) {
+	if len(o.Params) > 0 {
+		merged := make(directiveParamMap, len(o.Params)+len(params))
+		for k, v := range o.Params {
+			merged[k] = v
+		}
+		for k, v := range params {
+			merged[k] = v
+		}
+		params = merged
+	}
+	if o.Enable != nil {
+		if *o.Enable {
+			hasDirective = true
+		} else {
+			skip = true
+		}
+	}
+	return params, hasDirective, skip
+}
+
 func hasGoDirective(doc *ast.CommentGroup) bool {
 	if doc == nil {
 		return false
@@ -275,9 +323,16 @@ func shouldObfuscate(mode Mode, funcDecl *ast.FuncDecl, hasDirective bool) bool
 	}
 }
 
-// isHardFragilePackage determines if a package should always be skipped for control-flow obfuscation.
-// Returns true if the package should be skipped.
-func isHardFragilePackage(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File) bool {
+// FragileReasons reports why control-flow obfuscation would reject a package
+// as a whole. The hard reason applies in every mode, while the soft reason
+// only applies in conservative modes. Each reason is empty if the check passes.
+func FragileReasons(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File) (hard, soft string) {
+	return hardFragileReason(fset, ssaPkg, files), softFragileReason(ssaPkg, files)
+}
+
+// hardFragileReason determines if a package should always be skipped for control-flow obfuscation.
+// Returns the reason if the package should be skipped, or an empty string.
+func hardFragileReason(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File) string {
 	pkgPath := ssaPkg.Pkg.Path()
 
 	// Always skip critical stdlib packages (runtime, syscall, unsafe-heavy).
@@ -285,16 +340,14 @@ func isHardFragilePackage(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast
 		strings.HasPrefix(pkgPath, "runtime") ||
 		pkgPath == "syscall" ||
 		pkgPath == "unsafe" {
-		debugf("%s: fragile skip due to stdlib prefix", pkgPath)
-		return true
+		return "stdlib prefix"
 	}
 
 	// Skip packages that import "C" (cgo) - fragile type interactions.
 	for _, f := range files {
 		for _, imp := range f.Imports {
 			if imp.Path != nil && strings.Trim(imp.Path.Value, `"`) == "C" {
-				debugf("%s: fragile skip due to cgo import", pkgPath)
-				return true
+				return "cgo import"
 			}
 		}
 	}
@@ -303,19 +356,24 @@ func isHardFragilePackage(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast
 	// in the parsed file set (cgo rewrites sources during build).
 	for _, f := range files {
 		if isCgoGeneratedFile(fset, f) {
-			debugf("%s: fragile skip due to cgo-generated file", pkgPath)
-			return true
+			return "cgo-generated file"
 		}
 	}
 
-	return false
+	return ""
 }
 
 // isSoftFragilePackage determines if a package should be skipped only in conservative modes
 // (e.g. controlflow=auto). Returns true if the package should be skipped.
 func isSoftFragilePackage(ssaPkg *ssa.Package, files []*ast.File) bool {
-	pkgPath := ssaPkg.Pkg.Path()
+	reason := softFragileReason(ssaPkg, files)
+	if reason != "" {
+		debugf("%s: fragile skip due to %s", ssaPkg.Pkg.Path(), reason)
+	}
+	return reason != ""
+}
 
+func softFragileReason(ssaPkg *ssa.Package, files []*ast.File) string {
 	// Skip packages with dangerous compiler directives that indicate low-level code.
 	// These may not tolerate control-flow transformations.
 	// Safe directives like //go:build are allowed.
@@ -332,15 +390,14 @@ func isSoftFragilePackage(ssaPkg *ssa.Package, files []*ast.File) bool {
 			for _, c := range cg.List {
 				for _, dangerous := range dangerousDirectives {
 					if strings.HasPrefix(c.Text, dangerous) {
-						debugf("%s: fragile skip due to directive %s", pkgPath, dangerous)
-						return true
+						return "directive " + dangerous
 					}
 				}
 			}
 		}
 	}
 
-	return false
+	return ""
 }
 
 // hasBoundMethodClosure checks if a function (or any of its anonymous functions recursively)
@@ -472,8 +529,12 @@ func hasPredeclaredNames(fn *ssa.Function) bool {
 // junk_jumps - controls how many junk jumps are added. It does not affect final binary by itself, but together with flattening linearly increases complexity.
 // block_splits - controls number of times largest block must be splitted. Together with flattening improves obfuscation of long blocks without branches.
 //
+// If override is non-nil, it is called with each function's name, as per
+// asthelper.FuncDeclName, to obtain settings which don't come from directives.
+// If report is non-nil, it is filled with the functions which were obfuscated or skipped.
+//
 //goland:noinspection GoUnhandledErrorResult
-func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfRand *mathrand.Rand, mode Mode, sharedTempDir string) (newFileName string, newFile *ast.File, affectedFiles []*ast.File, err error) {
+func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfRand *mathrand.Rand, mode Mode, sharedTempDir string, override func(funcName string) Override, report *Report) (newFileName string, newFile *ast.File, affectedFiles []*ast.File, err error) {
 	if !mode.Enabled() {
 		debugf("%s: control-flow disabled (mode=%v)", ssaPkg.Pkg.Path(), mode)
 		return
@@ -482,13 +543,15 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 	currentPkgPath := ssaPkg.Pkg.Path()
 	if ctrlflowSkipPkgs != nil && ctrlflowSkipPkgs[currentPkgPath] {
 		debugf("%s: skip entire package due to GARBLE_CONTROLFLOW_SKIP_PKGS", currentPkgPath)
+		report.skipPackage("GARBLE_CONTROLFLOW_SKIP_PKGS")
 		return
 	}
 
 	// Heuristic check: skip control-flow obfuscation for fragile packages.
 	// Hard skips always apply; soft skips apply only in conservative modes.
-	if isHardFragilePackage(fset, ssaPkg, files) {
-		debugf("%s: skip entire package due to fragile heuristics", currentPkgPath)
+	if reason := hardFragileReason(fset, ssaPkg, files); reason != "" {
+		debugf("%s: skip entire package due to fragile heuristics: %s", currentPkgPath, reason)
+		report.skipPackage("fragile package: " + reason)
 		return
 	}
 	// NOTE: avoid package-wide soft skipping in auto mode. We now apply
@@ -507,6 +570,11 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 		ssaFunc  *ssa.Function
 		params   directiveParamMap
 		funcDecl *ast.FuncDecl
+		name     string
+
+		// literalDirectives are kept as the doc comment of the flattened
+		// function, so that its literals are obfuscated like before moving.
+		literalDirectives *ast.CommentGroup
 	}
 	var candidates []functionCandidate
 
@@ -520,11 +588,21 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 				continue
 			}
 
+			name := ah.FuncDeclName(funcDecl)
 			params, hasDirective, skip := extractControlFlowIntent(funcDecl.Doc)
+			skipReason := skipDirectiveName
+			if override != nil && !skip {
+				params, hasDirective, skip = override(name).apply(params, hasDirective, skip)
+				skipReason = "override"
+			}
 			if shouldSkipForGoDirective(mode, funcDecl.Doc) {
 				debugf("%s: skip candidate %s due to go directive", currentPkgPath, funcDecl.Name.Name)
+				report.skip(name, "go directive")
 				continue
 			}
+			if skip {
+				report.skip(name, skipReason)
+			}
 			if skip || !shouldObfuscate(mode, funcDecl, hasDirective) {
 				if ctrlflowDebug {
 					reason := "mode"
@@ -542,6 +620,7 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 			ssaFunc := ssa.EnclosingFunction(ssaPkg, path)
 			if ssaFunc == nil {
 				debugf("%s: unable to find SSA function for %s", currentPkgPath, funcDecl.Name.Name)
+				report.skip(name, "no SSA function")
 				continue
 			}
 			// Skip functions which create closures over non-anonymous functions (e.g., bound methods),
@@ -549,6 +628,7 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 			// Check both the function itself and all its anonymous functions recursively.
 			if mode != ModeAll && hasBoundMethodClosure(ssaFunc) {
 				debugf("%s: skip %s due to bound method closure", currentPkgPath, funcDecl.Name.Name)
+				report.skip(name, "bound method closure")
 				continue
 			}
 
@@ -558,6 +638,7 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 			if mode != ModeAll {
 				if reason, risky := hasRiskySSAPatterns(ssaFunc); risky {
 					debugf("%s: skip %s due to risky SSA pattern: %s", currentPkgPath, funcDecl.Name.Name, reason)
+					report.skip(name, "risky SSA pattern: "+reason)
 					continue
 				}
 			}
@@ -570,6 +651,9 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 				ssaFunc:  ssaFunc,
 				params:   params,
 				funcDecl: funcDecl,
+				name:     name,
+
+				literalDirectives: literals.CarriedDirectives(file, funcDecl),
 			})
 		}
 	}
@@ -588,6 +672,7 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 		impPath := imp.Path()
 		if skippedPackages[impPath] {
 			debugf("%s: dependency %s previously marked as skipped", currentPkgPath, impPath)
+			report.skipPackage("dependency " + impPath + " was skipped")
 			if err := saveSkippedPackage(sharedTempDir, currentPkgPath); err != nil {
 				return "", nil, nil, fmt.Errorf("failed to save skipped package: %v", err)
 			}
@@ -601,6 +686,8 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 	var ssaFuncs []*ssa.Function
 	var ssaParams []directiveParamMap
 	var funcDecls []*ast.FuncDecl
+	var funcNames []string
+	var funcLiteralDirectives []*ast.CommentGroup
 
 	for _, candidate := range candidates {
 		// Quick dry-run: attempt conversion without full obfuscation.
@@ -616,11 +703,14 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 		}()
 		if dryErr != nil {
 			debugf("%s: dry-run convert failed for %s: %v", currentPkgPath, candidate.ssaFunc.Name(), dryErr)
+			report.skip(candidate.name, "dry-run failed: "+dryErr.Error())
 			continue
 		}
 		ssaFuncs = append(ssaFuncs, candidate.ssaFunc)
 		ssaParams = append(ssaParams, candidate.params)
 		funcDecls = append(funcDecls, candidate.funcDecl)
+		funcNames = append(funcNames, candidate.name)
+		funcLiteralDirectives = append(funcLiteralDirectives, candidate.literalDirectives)
 	}
 
 	if len(ssaFuncs) == 0 {
@@ -660,6 +750,7 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 	for i, ssaFunc := range ssaFuncs {
 		params := ssaParams[i]
 		funcDecl := funcDecls[i]
+		name := funcNames[i]
 
 		split := params.GetInt("block_splits", defaultBlockSplits, maxBlockSplits)
 		junkCount := params.GetInt("junk_jumps", defaultJunkJumps, maxJunkJumps)
@@ -710,6 +801,7 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 		dispatchers, obfErr := applyObfuscation(ssaFunc)
 		if obfErr != nil {
 			debugf("%s: %v — skipping function", currentPkgPath, obfErr)
+			report.skip(name, obfErr.Error())
 			continue
 		}
 		for _, anonFunc := range ssaFunc.AnonFuncs {
@@ -764,6 +856,7 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 		}()
 		if convertErr != nil {
 			debugf("%s: conversion failed for %s after obfuscation: %v", currentPkgPath, ssaFunc.Name(), convertErr)
+			report.skip(name, convertErr.Error())
 			// SSA→AST conversion failed for this function. Skip it and leave
 			// the original function intact in the source file.
 			continue
@@ -793,7 +886,9 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 			}
 			astFunc.Body.List = append(flat, astFunc.Body.List...)
 		}
+		astFunc.Doc = funcLiteralDirectives[i]
 		newFile.Decls = append(newFile.Decls, astFunc)
+		report.flattened(name)
 
 		// Only now that conversion succeeded, remove the function from its original file
 		funcDecl.Name = ast.NewIdent("_")
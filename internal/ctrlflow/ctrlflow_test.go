@@ -119,3 +119,28 @@ func g() {
 		t.Fatal("did not expect bound method closure in g")
 	}
 }
+
+func TestOverrideApply(t *testing.T) {
+	yes, no := true, false
+
+	params, hasDirective, skip := Override{
+		Params: map[string]string{"flatten_passes": "2", "junk_jumps": "4"},
+		Enable: &yes,
+	}.apply(directiveParamMap{"flatten_passes": "3"}, false, false)
+	if !hasDirective || skip {
+		t.Fatalf("enabled override: hasDirective=%v skip=%v", hasDirective, skip)
+	}
+	if params["flatten_passes"] != "3" || params["junk_jumps"] != "4" {
+		t.Fatalf("directive params should win over override params: %v", params)
+	}
+
+	_, _, skip = Override{Enable: &no}.apply(nil, true, false)
+	if !skip {
+		t.Fatal("disabled override should skip the function")
+	}
+
+	params, hasDirective, skip = Override{}.apply(nil, false, false)
+	if params != nil || hasDirective || skip {
+		t.Fatalf("empty override changed the intent: %v %v %v", params, hasDirective, skip)
+	}
+}
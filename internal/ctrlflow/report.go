@@ -0,0 +1,51 @@
+package ctrlflow
+
+import "log/slog"
+
+// Report records the outcome of control-flow obfuscation for a single package.
+// A nil *Report is valid and records nothing.
+//
+// Skips and flattened functions are also logged as debug events with log/slog,
+// whether or not a report is being recorded.
+type Report struct {
+	// Mode is the control-flow mode which applied to the package.
+	Mode string
+
+	// SkippedPackage is the reason why the entire package was skipped, if any.
+	SkippedPackage string
+
+	// Flattened lists the functions which were obfuscated, in source order.
+	Flattened []string
+
+	// Skipped maps the candidate functions which were left untouched
+	// to the reason why, such as a risky SSA pattern or a failed dry-run.
+	// Functions which were never candidates for the mode are not included.
+	Skipped map[string]string
+}
+
+func (r *Report) skipPackage(reason string) {
+	slog.Debug("controlflow skip package", "reason", reason)
+	if r == nil {
+		return
+	}
+	r.SkippedPackage = reason
+}
+
+func (r *Report) skip(name, reason string) {
+	slog.Debug("controlflow skip func", "func", name, "reason", reason)
+	if r == nil {
+		return
+	}
+	if r.Skipped == nil {
+		r.Skipped = make(map[string]string)
+	}
+	r.Skipped[name] = reason
+}
+
+func (r *Report) flattened(name string) {
+	slog.Debug("controlflow flattened", "func", name)
+	if r == nil {
+		return
+	}
+	r.Flattened = append(r.Flattened, name)
+}
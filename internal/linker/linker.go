@@ -10,6 +10,7 @@ import (
 	"go/version"
 	"io"
 	"io/fs"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -245,9 +246,11 @@ func PatchLinker(goRoot, goVersion, cacheDir, tempDir string) (string, func(), e
 		return "", nil, err
 	}
 	if isCorrectVer && fileExists(outputLinkPath) {
+		slog.Debug("linker cache hit", "path", outputLinkPath, "goversion", goVersion)
 		successBuild = true
 		return outputLinkPath, unlock, nil
 	}
+	slog.Debug("linker cache miss", "path", outputLinkPath, "goversion", goVersion)
 
 	srcDir := filepath.Join(goRoot, "src")
 	workingDir := filepath.Join(tempDir, "linker-src")
@@ -1,7 +1,11 @@
 package literals
 
 import (
+	"bytes"
 	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
 	mathrand "math/rand"
 	"testing"
 )
@@ -55,3 +59,32 @@ func BenchmarkObfuscatorPerformance(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkChunkedCipher checks that obfuscating literals larger than maxSize
+// scales linearly: both ns/B and the generated source per input byte
+// should stay roughly constant as the size grows.
+func BenchmarkChunkedCipher(b *testing.B) {
+	for _, size := range []int{4 << 10, 16 << 10, 64 << 10, 256 << 10} {
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			rand := mathrand.New(mathrand.NewSource(42))
+			ctx := newBenchmarkContext(rand)
+
+			testData := make([]byte, size)
+			rand.Read(testData)
+
+			var block *ast.BlockStmt
+			b.ResetTimer()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				block = chunkedCipher{}.obfuscate(ctx, testData, nil)
+			}
+			b.StopTimer()
+
+			var buf bytes.Buffer
+			if err := printer.Fprint(&buf, token.NewFileSet(), block); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(buf.Len())/float64(size), "src-B/B")
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package literals
+
+import (
+	"go/ast"
+	"go/token"
+	mathrand "math/rand"
+	"strconv"
+
+	ah "github.com/AeonDave/garble/internal/asthelper"
+)
+
+// literalCache declares the package-level variables which let string literals
+// be decrypted at most once, as per BuilderConfig.Cache.
+// Each cached literal gets a slot for its plaintext and a channel which is
+// closed once the slot is filled, and all of them share a channel used as a lock.
+//
+// We use channels rather than sync.Once or sync/atomic as they need no imports,
+// and the package being compiled might not have those in its importcfg.
+// A select with a default case on a closed channel does not lock,
+// and closing a channel happens before any receive which observes it,
+// so reading the slot once the channel is closed is not a data race.
+type literalCache struct {
+	rand     *mathrand.Rand
+	nameFunc NameProviderFunc
+
+	lock  string
+	slots []cacheSlot
+
+	// size is the total length of the cached plaintexts, which stay in memory
+	// once decrypted until the program exits.
+	size int
+}
+
+type cacheSlot struct {
+	value, done string
+}
+
+// wrap turns a call which decrypts a string of the given length into:
+//
+//	func() string {
+//		select {
+//		case <-done:
+//			return value
+//		default:
+//		}
+//		if lock != nil {
+//			lock <- struct{}{}
+//			defer func() { <-lock }()
+//			select {
+//			case <-done:
+//				return value
+//			default:
+//			}
+//			defer close(done)
+//		}
+//		value = <call>
+//		return value
+//	}()
+//
+// The lock is only nil while the package's variables are being initialized,
+// in which case the literal is simply decrypted again on its next use.
+func (c *literalCache) wrap(call *ast.CallExpr, size int) *ast.CallExpr {
+	if c.lock == "" {
+		c.lock = c.nameFunc(c.rand, "literalCacheLock")
+	}
+	idx := strconv.Itoa(len(c.slots))
+	slot := cacheSlot{
+		value: c.nameFunc(c.rand, "literalCacheValue"+idx),
+		done:  c.nameFunc(c.rand, "literalCacheDone"+idx),
+	}
+	c.slots = append(c.slots, slot)
+	c.size += size
+
+	value := func() *ast.Ident { return ast.NewIdent(slot.value) }
+	done := func() *ast.Ident { return ast.NewIdent(slot.done) }
+	lock := func() *ast.Ident { return ast.NewIdent(c.lock) }
+	doneCheck := func() *ast.SelectStmt {
+		return &ast.SelectStmt{Body: ah.BlockStmt(
+			&ast.CommClause{
+				Comm: ah.ExprStmt(ah.UnaryExpr(token.ARROW, done())),
+				Body: []ast.Stmt{ah.ReturnStmt(value())},
+			},
+			&ast.CommClause{},
+		)}
+	}
+	block := ah.BlockStmt(
+		doneCheck(),
+		&ast.IfStmt{
+			Cond: ah.BinaryExpr(lock(), token.NEQ, ast.NewIdent("nil")),
+			Body: ah.BlockStmt(
+				&ast.SendStmt{Chan: lock(), Value: &ast.CompositeLit{Type: emptyStructType()}},
+				&ast.DeferStmt{Call: ah.CallExpr(&ast.FuncLit{
+					Type: &ast.FuncType{Params: &ast.FieldList{}},
+					Body: ah.BlockStmt(ah.ExprStmt(ah.UnaryExpr(token.ARROW, lock()))),
+				})},
+				doneCheck(),
+				&ast.DeferStmt{Call: ah.CallExprByName("close", done())},
+			),
+		},
+		ah.AssignStmt(value(), call),
+		ah.ReturnStmt(value()),
+	)
+	return ah.LambdaCall(nil, ast.NewIdent("string"), block, nil)
+}
+
+func emptyStructType() *ast.StructType {
+	return &ast.StructType{Fields: &ast.FieldList{}}
+}
+
+func chanOfEmptyStruct() *ast.ChanType {
+	return &ast.ChanType{Dir: ast.SEND | ast.RECV, Value: emptyStructType()}
+}
+
+// AddToFile declares the variables used by the cached literals in a file.
+// The lock is declared last, so that it is only non-nil once all the
+// channels it guards have been initialized.
+func (c *literalCache) AddToFile(file *ast.File) {
+	if len(c.slots) == 0 {
+		return
+	}
+	decl := &ast.GenDecl{Tok: token.VAR}
+	for _, slot := range c.slots {
+		decl.Specs = append(decl.Specs,
+			&ast.ValueSpec{
+				Names: []*ast.Ident{ast.NewIdent(slot.value)},
+				Type:  ast.NewIdent("string"),
+			},
+			&ast.ValueSpec{
+				Names:  []*ast.Ident{ast.NewIdent(slot.done)},
+				Values: []ast.Expr{ah.CallExprByName("make", chanOfEmptyStruct())},
+			},
+		)
+	}
+	decl.Specs = append(decl.Specs, &ast.ValueSpec{
+		Names:  []*ast.Ident{ast.NewIdent(c.lock)},
+		Values: []ast.Expr{ah.CallExprByName("make", chanOfEmptyStruct(), ah.IntLit(1))},
+	})
+	file.Decls = append(file.Decls, decl)
+}
+
+func newLiteralCache(rand *mathrand.Rand, nameFunc NameProviderFunc) *literalCache {
+	return &literalCache{
+		rand:     rand,
+		nameFunc: nameFunc,
+	}
+}
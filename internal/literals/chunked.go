@@ -0,0 +1,103 @@
+package literals
+
+import (
+	"go/ast"
+	"go/token"
+
+	ah "github.com/AeonDave/garble/internal/asthelper"
+)
+
+const (
+	// minCipherChunkSize and maxCipherChunkSize bound the size of the chunks
+	// which chunkedCipher encrypts independently.
+	minCipherChunkSize = maxSize / 4
+	maxCipherChunkSize = maxSize
+)
+
+// chunkedCipher is the strategy for literals larger than maxSize.
+// It splits the data into chunks, each encrypted with the custom cipher under
+// its own round keys, and decrypts them with a single loop over the chunks.
+// The S-box is shared by all chunks, so the generated code grows only with
+// the data and the round keys, both linearly.
+type chunkedCipher struct{}
+
+var _ obfuscator = chunkedCipher{}
+
+func (chunkedCipher) obfuscate(ctx *obfRand, data []byte, extKeys []*externalKey) *ast.BlockStmt {
+	params := newCustomCipherParams(ctx.Rand)
+	chunkSize := minCipherChunkSize + ctx.Intn(maxCipherChunkSize-minCipherChunkSize+1)
+
+	encrypted := make([]byte, len(data))
+	copy(encrypted, data)
+	var chunkKeys []ast.Expr
+	for off := 0; off < len(encrypted); off += chunkSize {
+		chunk := encrypted[off:min(off+chunkSize, len(encrypted))]
+		chunkParams := *params
+		chunkParams.keys = deriveRoundKeys(ctx.Rand, params.rounds)
+		customCipherEncrypt(&chunkParams, chunk)
+
+		keys := roundKeysLit(chunkParams.keys)
+		keys.Type = nil // elided in the outer composite literal
+		chunkKeys = append(chunkKeys, keys)
+	}
+
+	var dataExpr ast.Expr = ah.DataToByteSlice(encrypted)
+	if len(extKeys) > 0 && normalProb.Try(ctx.Rand) {
+		dataExpr = dataToInterleavedByteSlice(ctx.Rand, encrypted, extKeys)
+	}
+
+	names := newCipherVarNames(ctx.Rand)
+	extra := names.extra(ctx.Rand, 3)
+	allKeys, offset, chunk := extra[0], extra[1], extra[2]
+
+	// for offset := 0; offset < len(data); offset += chunkSize {
+	//	chunk := data[offset:]
+	//	if len(chunk) > chunkSize {
+	//		chunk = chunk[:chunkSize]
+	//	}
+	//	rkeys := allKeys[offset/chunkSize]
+	//	<rounds on chunk>
+	// }
+	chunkLoop := &ast.ForStmt{
+		Init: ah.AssignDefineStmt(ast.NewIdent(offset), ah.IntLit(0)),
+		Cond: ah.BinaryExpr(ast.NewIdent(offset), token.LSS, ah.CallExprByName("len", ast.NewIdent("data"))),
+		Post: &ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent(offset)},
+			Tok: token.ADD_ASSIGN,
+			Rhs: []ast.Expr{ah.IntLit(chunkSize)},
+		},
+		Body: ah.BlockStmt(
+			ah.AssignDefineStmt(ast.NewIdent(chunk), &ast.SliceExpr{
+				X:   ast.NewIdent("data"),
+				Low: ast.NewIdent(offset),
+			}),
+			&ast.IfStmt{
+				Cond: ah.BinaryExpr(ah.CallExprByName("len", ast.NewIdent(chunk)), token.GTR, ah.IntLit(chunkSize)),
+				Body: ah.BlockStmt(ah.AssignStmt(ast.NewIdent(chunk), &ast.SliceExpr{
+					X:    ast.NewIdent(chunk),
+					High: ah.IntLit(chunkSize),
+				})),
+			},
+			ah.AssignDefineStmt(ast.NewIdent(names.rkeys), ah.IndexExpr(allKeys,
+				ah.BinaryExpr(ast.NewIdent(offset), token.QUO, ah.IntLit(chunkSize)),
+			)),
+			customCipherRoundLoop(ctx.Rand, params.rounds, ast.NewIdent(chunk), names),
+		),
+	}
+
+	return ah.BlockStmt(
+		ah.AssignDefineStmt(ast.NewIdent("data"), dataExpr),
+		ah.AssignDefineStmt(ast.NewIdent(names.invSbox), invSboxLit(params)),
+		ah.AssignDefineStmt(ast.NewIdent(allKeys), &ast.CompositeLit{
+			Type: &ast.ArrayType{
+				Len: ah.IntLit(len(chunkKeys)),
+				Elt: &ast.ArrayType{
+					Len: ah.IntLit(params.rounds),
+					Elt: ast.NewIdent("uint32"),
+				},
+			},
+			Elts: chunkKeys,
+		}),
+		chunkLoop,
+	)
+}
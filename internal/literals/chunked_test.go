@@ -0,0 +1,81 @@
+package literals
+
+import (
+	"fmt"
+	"go/printer"
+	mathrand "math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChunkedCipherPickedForLargeLiterals(t *testing.T) {
+	rand := mathrand.New(mathrand.NewSource(1))
+	obf := &obfRand{Rand: rand, proxyDispatcher: newProxyDispatcher(rand, nil)}
+	for range 20 {
+		if got := getNextObfuscator(obf, maxSize+1); got != (chunkedCipher{}) {
+			t.Fatalf("got %T for a large literal, want chunkedCipher", got)
+		}
+		if got := getNextObfuscator(obf, maxSize); got == (chunkedCipher{}) {
+			t.Fatal("got chunkedCipher for a small literal")
+		}
+	}
+}
+
+func TestChunkedCipherRoundtrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a binary")
+	}
+	// The sizes cover a single chunk up to many chunks.
+	sizes := []int{1, maxSize + 1, 4 << 10, 100 << 10}
+	var src, want strings.Builder
+	src.WriteString("package main\n\nfunc main() {\n")
+	for i, size := range sizes {
+		data := strings.Repeat(fmt.Sprintf("line %d of a large literal\n", i), size/26+1)[:size]
+		fmt.Fprintf(&src, "\tprintln(%q)\n", data)
+		fmt.Fprintf(&want, "%s\n", data)
+	}
+	src.WriteString("}\n")
+
+	file, info, fset := parseAndTypecheck(t, src.String())
+	if testPkgToObfuscatorMap == nil {
+		testPkgToObfuscatorMap = make(map[string]obfuscator)
+	}
+	testPkgToObfuscatorMap[file.Name.Name] = chunkedCipher{}
+	defer delete(testPkgToObfuscatorMap, file.Name.Name)
+
+	rand := mathrand.New(mathrand.NewSource(7))
+	nameFunc := func(r *mathrand.Rand, base string) string { return fmt.Sprintf("%s%d", base, r.Uint64()) }
+	builder := NewBuilder(rand, file, nameFunc, BuilderConfig{})
+	obfuscated := builder.ObfuscateFile(file, info, nil)
+	builder.Finalize(obfuscated)
+	if got := builder.StrategyCounts()[strategyNameChunked]; got != len(sizes) {
+		t.Fatalf("chunked strategy used %d times, want %d", got, len(sizes))
+	}
+
+	srcPath := filepath.Join(t.TempDir(), "main.go")
+	f, err := os.Create(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := printer.Fprint(f, fset, obfuscated); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(srcPath); err != nil {
+		t.Fatal(err)
+	} else if strings.Contains(string(data), "of a large literal") {
+		t.Fatal("found a plaintext literal in the obfuscated source")
+	}
+	output, err := exec.Command("go", "run", srcPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %.500s", err, output)
+	}
+	if string(output) != want.String() {
+		t.Fatalf("got %d bytes of output, want %d:\n%.500s", len(output), want.Len(), output)
+	}
+}
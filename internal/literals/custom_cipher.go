@@ -110,6 +110,23 @@ func newCipherVarNames(rand *mathrand.Rand) *cipherVarNames {
 	}
 }
 
+// extra generates count more unique random variable names,
+// which also differ from the ones in n.
+func (n *cipherVarNames) extra(rand *mathrand.Rand, count int) []string {
+	seen := map[string]bool{
+		n.invSbox: true, n.rkeys: true, n.round: true,
+		n.key: true, n.keyBytes: true, n.idx: true,
+	}
+	names := make([]string, 0, count)
+	for len(names) < count {
+		if name := randomVarName(rand); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 // mbaXOR returns an AST expression algebraically equivalent to a ^ b,
 // randomly choosing between plain XOR and Mixed Boolean-Arithmetic (MBA)
 // encodings. The makeA/makeB factories are called to produce fresh AST
@@ -233,44 +250,56 @@ func customCipherInlineDecrypt(rand *mathrand.Rand, p *customCipherParams, dataI
 	stmts := make([]ast.Stmt, 0, 8)
 
 	// Emit inverse S-box as [256]byte{...}
-	invSboxElts := make([]ast.Expr, 256)
+	stmts = append(stmts, ah.AssignDefineStmt(ast.NewIdent(names.invSbox), invSboxLit(p)))
+
+	// Emit round keys as [rounds]uint32{...}
+	stmts = append(stmts, ah.AssignDefineStmt(ast.NewIdent(names.rkeys), roundKeysLit(p.keys)))
+
+	stmts = append(stmts, customCipherRoundLoop(rand, p.rounds, ast.NewIdent(dataIdent), names))
+
+	return ah.BlockStmt(stmts...)
+}
+
+// invSboxLit returns the inverse S-box as a [256]byte composite literal.
+func invSboxLit(p *customCipherParams) *ast.CompositeLit {
+	elts := make([]ast.Expr, 256)
 	for i, v := range p.invSbox {
-		invSboxElts[i] = ah.IntLit(int(v))
+		elts[i] = ah.IntLit(int(v))
 	}
-	invSboxLit := &ast.CompositeLit{
+	return &ast.CompositeLit{
 		Type: &ast.ArrayType{
 			Len: ah.IntLit(256),
 			Elt: ast.NewIdent("byte"),
 		},
-		Elts: invSboxElts,
+		Elts: elts,
 	}
-	stmts = append(stmts, ah.AssignDefineStmt(ast.NewIdent(names.invSbox), invSboxLit))
+}
 
-	// Emit round keys as [rounds]uint32{...}
-	keyElts := make([]ast.Expr, len(p.keys))
-	for i, k := range p.keys {
-		keyElts[i] = ah.UintLit(uint64(k))
+// roundKeysLit returns round keys as a [rounds]uint32 composite literal.
+func roundKeysLit(keys []uint32) *ast.CompositeLit {
+	elts := make([]ast.Expr, len(keys))
+	for i, k := range keys {
+		elts[i] = ah.UintLit(uint64(k))
 	}
-	keysLit := &ast.CompositeLit{
+	return &ast.CompositeLit{
 		Type: &ast.ArrayType{
-			Len: ah.IntLit(len(p.keys)),
+			Len: ah.IntLit(len(keys)),
 			Elt: ast.NewIdent("uint32"),
 		},
-		Elts: keyElts,
+		Elts: elts,
 	}
-	stmts = append(stmts, ah.AssignDefineStmt(ast.NewIdent(names.rkeys), keysLit))
+}
 
-	// for round := rounds-1; round >= 0; round--
-	di := ast.NewIdent(dataIdent)
-	roundLoop := &ast.ForStmt{
-		Init: ah.AssignDefineStmt(ast.NewIdent(names.round), ah.IntLit(p.rounds-1)),
+// customCipherRoundLoop generates the loop which runs all decryption rounds:
+//
+//	for round := rounds-1; round >= 0; round-- { ... }
+func customCipherRoundLoop(rand *mathrand.Rand, rounds int, dataIdent *ast.Ident, names *cipherVarNames) *ast.ForStmt {
+	return &ast.ForStmt{
+		Init: ah.AssignDefineStmt(ast.NewIdent(names.round), ah.IntLit(rounds-1)),
 		Cond: ah.BinaryExpr(ast.NewIdent(names.round), token.GEQ, ah.IntLit(0)),
 		Post: &ast.IncDecStmt{X: ast.NewIdent(names.round), Tok: token.DEC},
-		Body: &ast.BlockStmt{List: customCipherRoundBody(rand, di, names)},
+		Body: &ast.BlockStmt{List: customCipherRoundBody(rand, dataIdent, names)},
 	}
-	stmts = append(stmts, roundLoop)
-
-	return ah.BlockStmt(stmts...)
 }
 
 // customCipherRoundBody generates the body of one decryption round.
@@ -0,0 +1,319 @@
+package literals
+
+import (
+	"go/ast"
+	"strings"
+
+	ah "github.com/AeonDave/garble/internal/asthelper"
+)
+
+const (
+	// DirectiveOn and DirectiveOff turn literal obfuscation on or off
+	// for a function when in its doc comment, for a file when in a top-level
+	// comment of their own, or for a package when in the doc comment of
+	// the package clause.
+	DirectiveOn  = "//garble:literals"
+	DirectiveOff = "//garble:noliterals"
+
+	// CacheParam and NoCacheParam, as in "//garble:literals cache",
+	// choose whether string literals are decrypted at most once;
+	// see BuilderConfig.Cache.
+	CacheParam   = "cache"
+	NoCacheParam = "nocache"
+
+	// HashParam and NoHashParam, as in "//garble:literals hash",
+	// choose whether equality checks against string constants compare
+	// keyed hashes instead; see BuilderConfig.HashCompare.
+	HashParam   = "hash"
+	NoHashParam = "nohash"
+)
+
+// unsafeFuncDirectives are the compiler directives which make it unsafe to
+// obfuscate the literals in a function, as decoding a literal may allocate,
+// call other functions, or touch memory the race detector would see.
+var unsafeFuncDirectives = []string{
+	"//go:noescape",
+	"//go:uintptrescapes",
+	"//go:nosplit",
+	"//go:norace",
+}
+
+// unsafeFileDirective is the prefix of the cgo directives found in the files
+// which cgo generates, where none of the literals may be obfuscated.
+const unsafeFileDirective = "//go:cgo_"
+
+// Directive reports whether a comment group turns literal obfuscation on or off.
+// If it has both directives, the last one wins.
+func Directive(group *ast.CommentGroup) (on, ok bool) {
+	if group == nil {
+		return false, false
+	}
+	for _, comment := range group.List {
+		switch directiveName(comment.Text) {
+		case DirectiveOn:
+			on, ok = true, true
+		case DirectiveOff:
+			on, ok = false, true
+		}
+	}
+	return on, ok
+}
+
+func directiveName(text string) string {
+	name, _, _ := strings.Cut(text, " ")
+	return name
+}
+
+// paramDirective reports whether a comment group turns an option on or off,
+// via the parameter onParam or offParam to DirectiveOn, such as CacheParam
+// and NoCacheParam. If it does both, the last one wins.
+func paramDirective(group *ast.CommentGroup, onParam, offParam string) (on, ok bool) {
+	if group == nil {
+		return false, false
+	}
+	for _, comment := range group.List {
+		name, params, _ := strings.Cut(comment.Text, " ")
+		if name != DirectiveOn {
+			continue
+		}
+		for _, param := range strings.Fields(params) {
+			switch param {
+			case onParam:
+				on, ok = true, true
+			case offParam:
+				on, ok = false, true
+			}
+		}
+	}
+	return on, ok
+}
+
+// PackageCacheDirective is like PackageDirective, for the cache parameters.
+func PackageCacheDirective(files []*ast.File) (cache, ok bool) {
+	return packageParamDirective(files, CacheParam, NoCacheParam)
+}
+
+// PackageHashDirective is like PackageDirective, for the hash parameters.
+func PackageHashDirective(files []*ast.File) (hash, ok bool) {
+	return packageParamDirective(files, HashParam, NoHashParam)
+}
+
+func packageParamDirective(files []*ast.File, onParam, offParam string) (on, ok bool) {
+	for _, file := range files {
+		if on, ok := paramDirective(file.Doc, onParam, offParam); ok {
+			return on, true
+		}
+	}
+	return false, false
+}
+
+// PackageDirective returns the setting from a directive in the doc comment
+// of any of the package's package clauses.
+func PackageDirective(files []*ast.File) (on, ok bool) {
+	for _, file := range files {
+		if on, ok := Directive(file.Doc); ok {
+			return on, true
+		}
+	}
+	return false, false
+}
+
+// fileDirective returns the setting from a directive in a top-level comment
+// group which does not belong to the package clause or any declaration.
+func fileDirective(file *ast.File) (on, ok bool) {
+	return Directive(fileDirectiveGroup(file))
+}
+
+func fileDirectiveGroup(file *ast.File) *ast.CommentGroup {
+	for _, group := range file.Comments {
+		if group == file.Doc || group.Pos() < file.Package || attachedToDecl(file, group) {
+			continue
+		}
+		if _, ok := Directive(group); ok {
+			return group
+		}
+	}
+	return nil
+}
+
+func attachedToDecl(file *ast.File, group *ast.CommentGroup) bool {
+	for _, decl := range file.Decls {
+		var doc *ast.CommentGroup
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			doc = decl.Doc
+		case *ast.GenDecl:
+			doc = decl.Doc
+		}
+		if group == doc || decl.Pos() <= group.Pos() && group.Pos() < decl.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// HasOptIn reports whether any function or file in the package
+// has a //garble:literals directive.
+func HasOptIn(files []*ast.File) bool {
+	for _, file := range files {
+		for _, group := range file.Comments {
+			if group == file.Doc {
+				continue
+			}
+			for _, comment := range group.List {
+				if directiveName(comment.Text) == DirectiveOn {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// cached reports whether the string literals in a function declaration
+// in a file are decrypted at most once.
+func (cfg BuilderConfig) cached(file *ast.File, decl *ast.FuncDecl) bool {
+	return funcParam(file, decl, CacheParam, NoCacheParam, cfg.Cache)
+}
+
+// hashed reports whether the equality checks against string constants
+// in a function declaration in a file compare keyed hashes.
+func (cfg BuilderConfig) hashed(file *ast.File, decl *ast.FuncDecl) bool {
+	return funcParam(file, decl, HashParam, NoHashParam, cfg.HashCompare)
+}
+
+// funcParam returns the setting of an option for a function declaration
+// in a file from its directive or its file's, or else def.
+func funcParam(file *ast.File, decl *ast.FuncDecl, onParam, offParam string, def bool) bool {
+	if on, ok := paramDirective(decl.Doc, onParam, offParam); ok {
+		return on
+	}
+	if on, ok := paramDirective(fileDirectiveGroup(file), onParam, offParam); ok {
+		return on
+	}
+	return def
+}
+
+// CarriedDirectives returns the directives which apply to a function
+// declaration in a file, to be used as the doc comment of the function when
+// it is moved to another file, such as by control-flow obfuscation.
+// It returns nil if neither the function nor the file has any.
+func CarriedDirectives(file *ast.File, decl *ast.FuncDecl) *ast.CommentGroup {
+	on, ok := Directive(decl.Doc)
+	if !ok {
+		on, ok = fileDirective(file)
+	}
+	if !ok {
+		return nil
+	}
+	if !on {
+		return &ast.CommentGroup{List: []*ast.Comment{{Text: DirectiveOff}}}
+	}
+	text := DirectiveOn
+	for _, params := range [][2]string{{CacheParam, NoCacheParam}, {HashParam, NoHashParam}} {
+		on, ok := paramDirective(decl.Doc, params[0], params[1])
+		if !ok {
+			on, ok = paramDirective(fileDirectiveGroup(file), params[0], params[1])
+		}
+		switch {
+		case ok && on:
+			text += " " + params[0]
+		case ok:
+			text += " " + params[1]
+		}
+	}
+	return &ast.CommentGroup{List: []*ast.Comment{{Text: text}}}
+}
+
+// fileSkipReason returns why none of a file's literals may be obfuscated,
+// or the empty string if some may be.
+func fileSkipReason(file *ast.File) string {
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			if strings.HasPrefix(comment.Text, unsafeFileDirective) {
+				return directiveName(comment.Text)
+			}
+		}
+	}
+	return ""
+}
+
+// TopLevelEnabled reports whether the literals in a file which are not
+// inside a function declaration are obfuscated, such as those in
+// package-level variable declarations.
+func TopLevelEnabled(file *ast.File, cfg BuilderConfig) bool {
+	if fileSkipReason(file) != "" {
+		return false
+	}
+	if on, ok := fileDirective(file); ok {
+		return on
+	}
+	return !cfg.Disabled
+}
+
+// Enabled reports whether the literals in a function declaration in a file
+// are obfuscated, or if decl is nil, those outside function declarations.
+func Enabled(file *ast.File, decl *ast.FuncDecl, cfg BuilderConfig) bool {
+	if fileSkipReason(file) != "" {
+		return false
+	}
+	fileOn := TopLevelEnabled(file, cfg)
+	if decl == nil {
+		return fileOn
+	}
+	return cfg.funcSkipReason(decl, fileOn) == ""
+}
+
+// funcSkipReason returns why the literals in a function declaration are not
+// obfuscated, or the empty string if they are. fileOn is as per TopLevelEnabled,
+// and the file must not have a reason to be skipped entirely.
+func (cfg BuilderConfig) funcSkipReason(decl *ast.FuncDecl, fileOn bool) string {
+	if decl.Doc != nil {
+		for _, comment := range decl.Doc.List {
+			for _, dangerous := range unsafeFuncDirectives {
+				if directiveName(comment.Text) == dangerous {
+					return dangerous
+				}
+			}
+		}
+	}
+	if on, ok := Directive(decl.Doc); ok {
+		if on {
+			return ""
+		}
+		return DirectiveOff
+	}
+	if cfg.SkipFunc != nil && cfg.SkipFunc(decl) {
+		return "garble.toml"
+	}
+	if !fileOn {
+		return "off"
+	}
+	return ""
+}
+
+// Skipped returns the functions whose literals would be left untouched,
+// mapped to the reason why, like the directive responsible. Functions are
+// only included if literals are obfuscated in the rest of their file;
+// whole files with a cgo directive are included by their name.
+// names holds the file names, in the same order as files.
+func Skipped(files []*ast.File, names []string, cfg BuilderConfig) map[string]string {
+	skipped := make(map[string]string)
+	for i, file := range files {
+		if reason := fileSkipReason(file); reason != "" {
+			skipped[names[i]] = reason
+			continue
+		}
+		if !TopLevelEnabled(file, cfg) {
+			continue
+		}
+		for _, decl := range file.Decls {
+			if decl, ok := decl.(*ast.FuncDecl); ok && decl.Body != nil {
+				if reason := cfg.funcSkipReason(decl, true); reason != "" {
+					skipped[ah.FuncDeclName(decl)] = reason
+				}
+			}
+		}
+	}
+	return skipped
+}
@@ -0,0 +1,272 @@
+package literals
+
+import (
+	_ "embed"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	mathrand "math/rand"
+	"reflect"
+	"strings"
+
+	ah "github.com/AeonDave/garble/internal/asthelper"
+)
+
+//go:embed hashcmp_code.go
+var hashCompareCode string
+
+// hashCompareFuncs are the functions in hashCompareCode,
+// which get new names in each file they are added to.
+var hashCompareFuncs = []string{"_hsum", "_heq", "_hfold"}
+
+// hashComparison is an equality check against a string constant which is
+// rewritten into a comparison of keyed hashes, as per BuilderConfig.HashCompare:
+//
+//	x == "literal"                    =>  _heq(x, [10]uint64{...})
+//	x != "literal"                    =>  !_heq(x, [10]uint64{...})
+//	strings.EqualFold(x, "literal")   =>  _heq(_hfold(x), [10]uint64{...})
+//	bytes.Equal(x, []byte("literal")) =>  _heq(string(x), [10]uint64{...})
+//	hmac.Equal(x, []byte("literal"))  =>  _heq(string(x), [10]uint64{...})
+//
+// The constant operand is dropped, so its value is never decrypted.
+type hashComparison struct {
+	operand int    // index of the other operand; see hashComparison.operandOf
+	value   string // the constant, case-folded for strings.EqualFold
+	negate  bool   // for !=
+	fold    bool   // for strings.EqualFold
+	convert bool   // whether the operand needs a conversion to string
+}
+
+// hashComparisons adds the code for hash comparisons to a file,
+// giving its functions new names the first time they are used.
+type hashComparisons struct {
+	rand     *mathrand.Rand
+	nameFunc NameProviderFunc
+
+	names map[string]string // from hashCompareFuncs
+	count int
+}
+
+func newHashComparisons(rand *mathrand.Rand, nameFunc NameProviderFunc) *hashComparisons {
+	return &hashComparisons{
+		rand:     rand,
+		nameFunc: nameFunc,
+	}
+}
+
+// findHashComparison returns how to rewrite an expression via keyed hashes,
+// or nil if it is not an equality check against a non-empty string constant.
+// shadowed is as per Builder.shadowed.
+func findHashComparison(node ast.Expr, info *types.Info, shadowed map[string]bool) *hashComparison {
+	var cmp *hashComparison
+	switch node := node.(type) {
+	case *ast.BinaryExpr:
+		if node.Op != token.EQL && node.Op != token.NEQ {
+			return nil
+		}
+		// The result is a bool, and not an untyped bool given a named type.
+		if typ := info.TypeOf(node); typ != types.Typ[types.Bool] && typ != types.Typ[types.UntypedBool] {
+			return nil
+		}
+		for i, pair := range [][2]ast.Expr{{node.X, node.Y}, {node.Y, node.X}} {
+			value := info.Types[pair[0]].Value
+			if value == nil || value.Kind() != constant.String || info.Types[pair[1]].Value != nil {
+				continue
+			}
+			basic, ok := info.TypeOf(pair[1]).Underlying().(*types.Basic)
+			if !ok || basic.Kind() != types.String {
+				return nil
+			}
+			cmp = &hashComparison{
+				operand: 1 - i,
+				value:   constant.StringVal(value),
+				negate:  node.Op == token.NEQ,
+				convert: info.TypeOf(pair[1]) != types.Typ[types.String],
+			}
+		}
+	case *ast.CallExpr:
+		if len(node.Args) != 2 || node.Ellipsis.IsValid() {
+			return nil
+		}
+		switch calleeName(node.Fun, info) {
+		case "strings.EqualFold":
+			for i := range node.Args {
+				value := info.Types[node.Args[i]].Value
+				other := node.Args[1-i]
+				if value == nil || info.Types[other].Value != nil {
+					continue
+				}
+				folded, ok := foldASCII(constant.StringVal(value))
+				if !ok {
+					return nil
+				}
+				cmp = &hashComparison{operand: 1 - i, value: folded, fold: true}
+			}
+		case "bytes.Equal", "crypto/hmac.Equal":
+			for i := range node.Args {
+				value, ok := bytesConversion(node.Args[i], info)
+				other := node.Args[1-i]
+				if !ok {
+					continue
+				}
+				if _, ok := bytesConversion(other, info); ok {
+					return nil
+				}
+				cmp = &hashComparison{operand: 1 - i, value: value, convert: true}
+			}
+		}
+	}
+	if cmp == nil || cmp.value == "" {
+		return nil
+	}
+	if shadowed["uint64"] || cmp.convert && shadowed["string"] {
+		return nil
+	}
+	return cmp
+}
+
+// calleeName returns the qualified name of the package-level function
+// called via fun, such as "strings.EqualFold", or the empty string.
+func calleeName(fun ast.Expr, info *types.Info) string {
+	var ident *ast.Ident
+	switch fun := ast.Unparen(fun).(type) {
+	case *ast.Ident:
+		ident = fun
+	case *ast.SelectorExpr:
+		ident = fun.Sel
+	default:
+		return ""
+	}
+	obj, ok := info.Uses[ident].(*types.Func)
+	if !ok || obj.Pkg() == nil || obj.Signature().Recv() != nil {
+		return ""
+	}
+	return obj.Pkg().Path() + "." + obj.Name()
+}
+
+// bytesConversion returns the value of an expression like []byte("constant").
+func bytesConversion(expr ast.Expr, info *types.Info) (string, bool) {
+	call, ok := ast.Unparen(expr).(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 || !info.Types[call.Fun].IsType() {
+		return "", false
+	}
+	slice, ok := info.TypeOf(call.Fun).Underlying().(*types.Slice)
+	if !ok || !types.Identical(slice.Elem(), types.Typ[types.Byte]) {
+		return "", false
+	}
+	value := info.Types[call.Args[0]].Value
+	if value == nil || value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(value), true
+}
+
+// foldASCII returns an ASCII string in lower case, like _hfold.
+// It reports false if the string is not ASCII.
+func foldASCII(s string) (string, bool) {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return "", false
+		}
+	}
+	return strings.ToLower(s), true
+}
+
+// constantOf returns the constant operand of a comparison node.
+func (cmp *hashComparison) constantOf(node ast.Expr) ast.Expr {
+	switch node := node.(type) {
+	case *ast.BinaryExpr:
+		if cmp.operand == 0 {
+			return node.Y
+		}
+		return node.X
+	case *ast.CallExpr:
+		return node.Args[1-cmp.operand]
+	}
+	panic("unexpected hash comparison")
+}
+
+// operandOf returns the current non-constant operand of a comparison node.
+func (cmp *hashComparison) operandOf(node ast.Expr) ast.Expr {
+	switch node := node.(type) {
+	case *ast.BinaryExpr:
+		if cmp.operand == 0 {
+			return node.X
+		}
+		return node.Y
+	case *ast.CallExpr:
+		return node.Args[cmp.operand]
+	}
+	panic("unexpected hash comparison")
+}
+
+// rewrite returns the replacement for a comparison node, whose operands
+// may have been obfuscated since findHashComparison.
+func (h *hashComparisons) rewrite(cmp *hashComparison, node ast.Expr) ast.Expr {
+	if h.names == nil {
+		h.names = make(map[string]string, len(hashCompareFuncs))
+		for _, name := range hashCompareFuncs {
+			h.names[name] = h.nameFunc(h.rand, name[1:])
+		}
+	}
+	h.count++
+
+	operand := cmp.operandOf(node)
+	if cmp.convert {
+		operand = ah.CallExprByName("string", operand)
+	}
+	if cmp.fold {
+		operand = ah.CallExprByName(h.names["_hfold"], operand)
+	}
+	var key [10]uint64
+	for i := range 8 {
+		key[i] = h.rand.Uint64()
+	}
+	key[8] = _hsum(cmp.value, key[0], key[1], key[2], key[3])
+	key[9] = _hsum(cmp.value, key[4], key[5], key[6], key[7])
+	keyLit := &ast.CompositeLit{Type: ah.ArrayType(ah.IntLit(len(key)), ast.NewIdent("uint64"))}
+	for _, k := range key {
+		keyLit.Elts = append(keyLit.Elts, ah.UintLit(k))
+	}
+	var expr ast.Expr = ah.CallExprByName(h.names["_heq"], operand, keyLit)
+	if cmp.negate {
+		expr = ah.UnaryExpr(token.NOT, expr)
+	}
+	return expr
+}
+
+// AddToFile declares the functions used by the hash comparisons in a file.
+func (h *hashComparisons) AddToFile(file *ast.File) {
+	if h.count == 0 {
+		return
+	}
+	_, code, _ := strings.Cut(hashCompareCode, "// Injected code below this line.")
+	src, err := parser.ParseFile(token.NewFileSet(), "", "package p\n"+code, parser.SkipObjectResolution)
+	if err != nil {
+		panic(err) // the code is ours
+	}
+	for node := range ast.Preorder(src) {
+		clearPositions(node)
+		if ident, ok := node.(*ast.Ident); ok {
+			if name, ok := h.names[ident.Name]; ok {
+				ident.Name = name
+			}
+		}
+	}
+	file.Decls = append(file.Decls, src.Decls...)
+}
+
+var posType = reflect.TypeFor[token.Pos]()
+
+// clearPositions sets the positions in a node to token.NoPos, as the node
+// comes from another file set than the file it is being added to.
+func clearPositions(node ast.Node) {
+	v := reflect.ValueOf(node).Elem()
+	for i := range v.NumField() {
+		if field := v.Field(i); field.Type() == posType {
+			field.SetInt(int64(token.NoPos))
+		}
+	}
+}
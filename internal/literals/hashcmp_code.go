@@ -0,0 +1,81 @@
+package literals
+
+// The code below is added to files where strings are compared against
+// literals via keyed hashes, with new names for its functions; see hashcmp.go.
+//
+// _hsum is SipHash-2-4, except that the four words of initial state are given
+// directly, so that neither the key nor SipHash's constants are fixed.
+// _heq compares two such hashes of a string, under independent random states,
+// against the digests of a literal.
+//
+// The same functions compute the digests at build time,
+// so that we can test this code normally.
+// It must build with any Go version a module may declare.
+
+// Injected code below this line.
+
+func _hsum(s string, v0, v1, v2, v3 uint64) uint64 {
+	round := func() {
+		v0 += v1
+		v1 = v1<<13 | v1>>51
+		v1 ^= v0
+		v0 = v0<<32 | v0>>32
+		v2 += v3
+		v3 = v3<<16 | v3>>48
+		v3 ^= v2
+		v0 += v3
+		v3 = v3<<21 | v3>>43
+		v3 ^= v0
+		v2 += v1
+		v1 = v1<<17 | v1>>47
+		v1 ^= v2
+		v2 = v2<<32 | v2>>32
+	}
+	m := uint64(len(s)) << 56
+	for ; len(s) >= 8; s = s[8:] {
+		b := uint64(s[0]) | uint64(s[1])<<8 | uint64(s[2])<<16 | uint64(s[3])<<24 |
+			uint64(s[4])<<32 | uint64(s[5])<<40 | uint64(s[6])<<48 | uint64(s[7])<<56
+		v3 ^= b
+		round()
+		round()
+		v0 ^= b
+	}
+	for i := 0; i < len(s); i++ {
+		m |= uint64(s[i]) << (8 * uint(i))
+	}
+	v3 ^= m
+	round()
+	round()
+	v0 ^= m
+	v2 ^= 0xff
+	round()
+	round()
+	round()
+	round()
+	return v0 ^ v1 ^ v2 ^ v3
+}
+
+func _heq(s string, k [10]uint64) bool {
+	return (_hsum(s, k[0], k[1], k[2], k[3])^k[8])|(_hsum(s, k[4], k[5], k[6], k[7])^k[9]) == 0
+}
+
+// _hfold maps a string to the ASCII string it is equal to under Unicode case
+// folding, like strings.EqualFold, with any other rune becoming 0x80.
+// Only the Kelvin sign and the long s fold to ASCII letters.
+func _hfold(s string) string {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case 'A' <= r && r <= 'Z':
+			r += 'a' - 'A'
+		case r == '\u212a':
+			r = 'k'
+		case r == '\u017f':
+			r = 's'
+		case r >= 0x80:
+			r = 0x80
+		}
+		b = append(b, byte(r))
+	}
+	return string(b)
+}
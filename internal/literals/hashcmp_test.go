@@ -0,0 +1,127 @@
+package literals
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	mathrand "math/rand"
+	"strings"
+	"testing"
+)
+
+func TestHashSum(t *testing.T) {
+	// The test vector from the SipHash paper, with its constants.
+	const k0, k1 = 0x0706050403020100, 0x0f0e0d0c0b0a0908
+	msg := make([]byte, 15)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	got := _hsum(string(msg), k0^0x736f6d6570736575, k1^0x646f72616e646f6d, k0^0x6c7967656e657261, k1^0x7465646279746573)
+	if want := uint64(0xa129ca6149be45e5); got != want {
+		t.Fatalf("_hsum = %#x, want %#x", got, want)
+	}
+}
+
+func TestHashFold(t *testing.T) {
+	inputs := []string{"", "go", "GO", "Go!", "Key", "key", "KEY", "ſecret", "secret", "sécret", "\xffkey", "ke"}
+	for _, x := range inputs {
+		for _, y := range inputs {
+			folded, ok := foldASCII(y)
+			if !ok {
+				continue
+			}
+			if got, want := _hfold(x) == folded, strings.EqualFold(x, y); got != want {
+				t.Errorf("_hfold(%q) == %q is %v, but strings.EqualFold is %v", x, folded, got, want)
+			}
+		}
+	}
+}
+
+func TestObfuscateHashComparisons(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a binary")
+	}
+	src := `package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"strings"
+)
+
+type token string
+
+const apiKey = "sk_live_0123456789abcdef"
+
+var (
+	_ = bytes.Equal
+	_ = hmac.Equal
+	_ = strings.EqualFold
+)
+
+func check(s string, t token, b []byte) {
+	println(s == apiKey, "sk_live_0123456789abcdef" != s, t == "named-secret")
+	println(strings.EqualFold(s, "Fold-Secret"), bytes.Equal(b, []byte("bytes-secret")), hmac.Equal([]byte("hmac-secret"), b))
+	println(s == "a" && s != "", s == s+"")
+}
+
+//garble:literals nohash
+func plain(s string) bool {
+	return s == "plain-secret"
+}
+
+func main() {
+	for _, s := range []string{"sk_live_0123456789abcdef", "FOLD-SECRET", "fold-ſecret", "a", "x"} {
+		check(s, token(s), []byte(s))
+	}
+	check("", "named-secret", []byte("bytes-secret"))
+	check("", "", []byte("hmac-secret"))
+	println(plain("plain-secret"), plain("x"))
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{Importer: importer.Default()}
+	if _, err := conf.Check("main", fset, []*ast.File{file}, info); err != nil {
+		t.Fatal(err)
+	}
+	nameFunc := func(r *mathrand.Rand, base string) string { return fmt.Sprintf("%s%d", base, r.Uint64()) }
+	builder := NewBuilder(mathrand.New(mathrand.NewSource(1)), file, nameFunc, BuilderConfig{HashCompare: true})
+	obfuscated := builder.ObfuscateFile(file, info, nil)
+	builder.Finalize(obfuscated)
+	// Comparisons with the empty string, and those in plain, are left alone.
+	if got, want := builder.HashedComparisons(), 7; got != want {
+		t.Errorf("HashedComparisons() = %d, want %d", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, obfuscated); err != nil {
+		t.Fatal(err)
+	}
+	code := buf.String()
+	// The literals are dropped rather than obfuscated,
+	// so check has no code left to decrypt them.
+	_, check, _ := strings.Cut(code, "func check(")
+	check, _, _ = strings.Cut(check, "\n}\n")
+	if strings.Contains(check, "func(") {
+		t.Errorf("check decrypts literals:\n%s", check)
+	}
+
+	want := runGoSource(t, src)
+	if got := runGoSource(t, code); got != want {
+		t.Fatalf("got output:\n%s\nwant:\n%s\ncode:\n%s", got, want, code)
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"go/constant"
 	"go/token"
 	"go/types"
+	"log/slog"
 	mathrand "math/rand"
 
 	ah "github.com/AeonDave/garble/internal/asthelper"
+	"github.com/AeonDave/garble/internal/consts"
 	"golang.org/x/tools/go/ast/astutil"
 )
 
@@ -27,23 +29,105 @@ const (
 // NameProviderFunc defines a function type that generates a string based on a random source and a base name.
 type NameProviderFunc func(rand *mathrand.Rand, baseName string) string
 
-type BuilderConfig struct{}
+type BuilderConfig struct {
+	// Disabled leaves the literals untouched by default, so that only the
+	// functions and files with a //garble:literals directive are obfuscated.
+	Disabled bool
+
+	// SkipFunc, if non-nil, reports whether the literals in a function
+	// declaration should be left untouched.
+	// Directives in the function's doc comment take precedence.
+	SkipFunc func(decl *ast.FuncDecl) bool
+
+	// Cache decrypts each string literal in a function declaration at most
+	// once, keeping the plaintext in a package-level variable from then on,
+	// unless a directive with CacheParam or NoCacheParam says otherwise.
+	// This avoids the cost of decrypting in hot paths, at the expense of
+	// the plaintext staying in memory until the program exits.
+	Cache bool
+
+	// Numbers, if non-nil, obfuscates integer and float literals of basic
+	// types which are not required to be constant, until the budget runs out.
+	Numbers *NumberBudget
+
+	// HashCompare rewrites equality checks against string constants in
+	// function declarations, such as x == "secret" or bytes.Equal, into
+	// comparisons of keyed hashes, so that the constants are never decrypted,
+	// unless a directive with HashParam or NoHashParam says otherwise.
+	HashCompare bool
+}
 
 type Builder struct {
 	obfRand *obfRand
+	cfg     BuilderConfig
+	cache   *literalCache
+	hashes  *hashComparisons
+	numbers int // obfuscated integer and float literals
+
+	// shadowed holds the names of basic types which the package declares,
+	// as obfuscated numbers and hash comparisons use conversions like float64(x).
+	shadowed map[string]bool
 }
 
 func NewBuilder(rand *mathrand.Rand, file *ast.File, nameFunc NameProviderFunc, cfg BuilderConfig) *Builder {
-	return &Builder{obfRand: newObfRand(rand, file, nameFunc)}
+	return &Builder{
+		obfRand: newObfRand(rand, file, nameFunc),
+		cfg:     cfg,
+		cache:   newLiteralCache(rand, nameFunc),
+		hashes:  newHashComparisons(rand, nameFunc),
+	}
 }
 
+// ObfuscateFile obfuscates the literals in a file, following the directives
+// described in DirectiveOn as well as the builder's configuration.
+// Functions with compiler directives such as //go:nosplit are left alone,
+// as are files with cgo directives.
 func (b *Builder) ObfuscateFile(file *ast.File, info *types.Info, linkStrings map[*types.Var]string) *ast.File {
+	if fileSkipReason(file) != "" {
+		return file
+	}
+	fileOn := TopLevelEnabled(file, b.cfg)
+	caching := false // whether we are in a function whose literals are cached
+	hashing := false // whether we are in a function whose comparisons are hashed
+	hashCmps := make(map[ast.Expr]*hashComparison)
+	hashedConsts := make(map[ast.Node]bool) // constant operands of hashCmps
+	b.shadowed = shadowedTypeNames(info)
+	var parents map[ast.Node]ast.Node
+	if b.cfg.Numbers != nil {
+		parents = consts.BuildParentMap(file)
+	}
 	pre := func(cursor *astutil.Cursor) bool {
+		// Numbers are replaced before their children, so that only the
+		// outermost constant expression is obfuscated.
+		if node, ok := cursor.Node().(ast.Expr); ok && parents != nil {
+			if newnode := b.obfuscateNumber(node, info, parents); newnode != nil {
+				cursor.Replace(withPos(newnode, node.Pos()))
+				return false
+			}
+		}
+		if hashedConsts[cursor.Node()] {
+			return false // dropped by the comparison
+		}
+		if node, ok := cursor.Node().(ast.Expr); ok && hashing {
+			if cmp := findHashComparison(node, info, b.shadowed); cmp != nil {
+				hashCmps[node] = cmp
+				hashedConsts[cmp.constantOf(node)] = true
+			}
+		}
 		switch node := cursor.Node().(type) {
 		case *ast.GenDecl:
 			if node.Tok == token.CONST {
 				return false
 			}
+			if _, topLevel := cursor.Parent().(*ast.File); topLevel && !fileOn {
+				return false
+			}
+		case *ast.FuncDecl:
+			if b.cfg.funcSkipReason(node, fileOn) != "" {
+				return false
+			}
+			caching = b.cfg.cached(file, node)
+			hashing = b.cfg.hashed(file, node)
 		case *ast.ValueSpec:
 			for _, name := range node.Names {
 				obj := info.Defs[name].(*types.Var)
@@ -56,10 +140,19 @@ func (b *Builder) ObfuscateFile(file *ast.File, info *types.Info, linkStrings ma
 	}
 
 	post := func(cursor *astutil.Cursor) bool {
+		if _, ok := cursor.Node().(*ast.FuncDecl); ok {
+			caching = false
+			hashing = false
+			return true
+		}
 		node, ok := cursor.Node().(ast.Expr)
 		if !ok {
 			return true
 		}
+		if cmp := hashCmps[node]; cmp != nil {
+			cursor.Replace(withPos(b.hashes.rewrite(cmp, node), node.Pos()))
+			return true
+		}
 
 		typeAndValue := info.Types[node]
 		if !typeAndValue.IsValue() {
@@ -72,7 +165,11 @@ func (b *Builder) ObfuscateFile(file *ast.File, info *types.Info, linkStrings ma
 				return true
 			}
 
-			cursor.Replace(withPos(obfuscateString(b.obfRand, value), node.Pos()))
+			call := obfuscateString(b.obfRand, value)
+			if caching {
+				call = b.cache.wrap(call, len(value))
+			}
+			cursor.Replace(withPos(call, node.Pos()))
 
 			return true
 		}
@@ -112,8 +209,82 @@ func (b *Builder) ObfuscateStringLiteral(value string, pos token.Pos) ast.Expr {
 	return withPos(obfuscateString(b.obfRand, value), pos).(ast.Expr)
 }
 
+// obfuscateNumber returns the replacement for an integer or float constant,
+// or nil if it should be left alone.
+func (b *Builder) obfuscateNumber(node ast.Expr, info *types.Info, parents map[ast.Node]ast.Node) ast.Expr {
+	tv := info.Types[node]
+	if !tv.IsValue() || tv.Value == nil {
+		return nil
+	}
+	typ, ok := tv.Type.(*types.Basic)
+	if !ok || typ.Info()&(types.IsInteger|types.IsFloat) == 0 || consts.IsConstContext(node, parents) {
+		return nil
+	}
+	// Constant expressions like len(array) may be the only use of a variable,
+	// so we leave those alone, though we may still obfuscate their operands.
+	for n := range ast.Preorder(node) {
+		if ident, ok := n.(*ast.Ident); ok {
+			if _, ok := info.Uses[ident].(*types.Var); ok {
+				return nil
+			}
+		}
+	}
+	if b.shadowed[typ.Name()] || (typ.Info()&types.IsFloat != 0 && (b.shadowed["float64"] || b.shadowed["int64"])) {
+		return nil
+	}
+	if b.cfg.Numbers.left <= 0 {
+		return nil
+	}
+	newnode := obfuscateNumber(b.obfRand, typ, tv.Value)
+	if newnode == nil {
+		return nil
+	}
+	b.cfg.Numbers.left--
+	b.numbers++
+	return newnode
+}
+
+// shadowedTypeNames returns the names of the basic types which are declared
+// anywhere in a package, such as a local variable named int.
+func shadowedTypeNames(info *types.Info) map[string]bool {
+	shadowed := make(map[string]bool)
+	for ident := range info.Defs {
+		if obj := types.Universe.Lookup(ident.Name); obj != nil {
+			if _, ok := obj.(*types.TypeName); ok {
+				shadowed[ident.Name] = true
+			}
+		}
+	}
+	return shadowed
+}
+
+// StrategyCounts returns how many literals were obfuscated with each strategy,
+// keyed by the names returned by RegisteredStrategyNames.
+func (b *Builder) StrategyCounts() map[string]int {
+	return b.obfRand.strategyCounts
+}
+
+// NumberCount returns how many integer and float literals were obfuscated.
+func (b *Builder) NumberCount() int {
+	return b.numbers
+}
+
+// HashedComparisons returns how many equality checks against string
+// constants were rewritten into comparisons of keyed hashes.
+func (b *Builder) HashedComparisons() int {
+	return b.hashes.count
+}
+
+// CachedLiterals returns how many string literals are decrypted at most once,
+// as per BuilderConfig.Cache, and their total length in bytes.
+func (b *Builder) CachedLiterals() (count, size int) {
+	return len(b.cache.slots), b.cache.size
+}
+
 func (b *Builder) Finalize(file *ast.File) {
 	b.obfRand.proxyDispatcher.AddToFile(file)
+	b.cache.AddToFile(file)
+	b.hashes.AddToFile(file)
 }
 
 // Obfuscate replaces literals with obfuscated anonymous functions.
@@ -344,9 +515,17 @@ func obfuscateByteArray(obfRand *obfRand, isPointer bool, data []byte, length in
 }
 
 func getNextObfuscator(obfRand *obfRand, size int) obfuscator {
+	var obf obfuscator
 	if size <= maxSize {
-		return obfRand.nextObfuscator()
+		obf = obfRand.nextObfuscator()
 	} else {
-		return obfRand.nextLinearTimeObfuscatorForSize(size)
+		obf = obfRand.nextLinearTimeObfuscatorForSize(size)
+	}
+	if obfRand.strategyCounts == nil {
+		obfRand.strategyCounts = make(map[string]int)
 	}
+	name := strategyNameOf(obf)
+	obfRand.strategyCounts[name]++
+	slog.Debug("literal strategy", "strategy", name, "size", size)
+	return obf
 }
@@ -2,12 +2,16 @@ package literals
 
 import (
 	"bytes"
+	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/printer"
 	"go/token"
 	"go/types"
 	mathrand "math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -74,6 +78,198 @@ var link = "link"
 	}
 }
 
+func TestObfuscateFileSkipFunc(t *testing.T) {
+	src := `package p
+
+func keep() string { return "keep" }
+func hide() string { return "hide" }
+`
+	file, info, fset := parseAndTypecheck(t, src)
+	rand := mathrand.New(mathrand.NewSource(1))
+	builder := NewBuilder(rand, file, func(r *mathrand.Rand, base string) string { return base }, BuilderConfig{
+		SkipFunc: func(decl *ast.FuncDecl) bool { return decl.Name.Name == "keep" },
+	})
+	obfuscated := builder.ObfuscateFile(file, info, nil)
+	builder.Finalize(obfuscated)
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, obfuscated); err != nil {
+		t.Fatalf("print failed: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "\"keep\"") {
+		t.Fatal("expected string in skipped func to remain unobfuscated")
+	}
+	if strings.Contains(out, "\"hide\"") {
+		t.Fatal("expected obfuscated string to be removed")
+	}
+	total := 0
+	for _, n := range builder.StrategyCounts() {
+		total += n
+	}
+	if total != 1 {
+		t.Fatalf("StrategyCounts total=%d, want 1", total)
+	}
+}
+
+func TestObfuscateFileDirectives(t *testing.T) {
+	src := `package p
+
+//garble:noliterals
+
+var top = "top"
+
+//go:nosplit
+func fast() string { return "fast" }
+
+//garble:literals
+func hide() string { return "hide" }
+
+func plain() string { return "plain" }
+`
+	file, info, fset := parseAndTypecheck(t, src)
+	builder := newTestBuilder(t, file)
+	obfuscated := builder.ObfuscateFile(file, info, nil)
+	builder.Finalize(obfuscated)
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, obfuscated); err != nil {
+		t.Fatalf("print failed: %v", err)
+	}
+	out := buf.String()
+	for _, kept := range []string{`"top"`, `"fast"`, `"plain"`} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("expected %s to remain unobfuscated", kept)
+		}
+	}
+	if strings.Contains(out, `"hide"`) {
+		t.Error("expected the string in the opted-in func to be obfuscated")
+	}
+
+	// With the package default off, only the opted-in func is obfuscated.
+	src = `package p
+
+var top = "top"
+
+//garble:literals
+func hide() string { return "hide" }
+
+func plain() string { return "plain" }
+`
+	file, info, fset = parseAndTypecheck(t, src)
+	rand := mathrand.New(mathrand.NewSource(1))
+	builder = NewBuilder(rand, file, func(r *mathrand.Rand, base string) string { return base }, BuilderConfig{Disabled: true})
+	obfuscated = builder.ObfuscateFile(file, info, nil)
+	builder.Finalize(obfuscated)
+
+	buf.Reset()
+	if err := printer.Fprint(&buf, fset, obfuscated); err != nil {
+		t.Fatalf("print failed: %v", err)
+	}
+	out = buf.String()
+	if !strings.Contains(out, `"top"`) || !strings.Contains(out, `"plain"`) {
+		t.Error("expected literals outside the opted-in func to remain unobfuscated")
+	}
+	if strings.Contains(out, `"hide"`) {
+		t.Error("expected the string in the opted-in func to be obfuscated")
+	}
+}
+
+func TestObfuscateFileCache(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a binary")
+	}
+	src := `package main
+
+//garble:literals nocache
+
+var top = "top"
+
+//garble:literals cache
+func hot() string { return "hot" }
+
+func cold() string { return "cold" }
+
+func main() {
+	done := make(chan bool)
+	for range 4 {
+		go func() {
+			for range 100 {
+				if hot() != "hot" || cold() != "cold" {
+					panic("wrong literal")
+				}
+			}
+			done <- true
+		}()
+	}
+	for range 4 {
+		<-done
+	}
+	println(top, hot(), cold())
+}
+`
+	file, info, fset := parseAndTypecheck(t, src)
+	rand := mathrand.New(mathrand.NewSource(1))
+	nameFunc := func(r *mathrand.Rand, base string) string { return fmt.Sprintf("%s%d", base, r.Uint64()) }
+	builder := NewBuilder(rand, file, nameFunc, BuilderConfig{Cache: true})
+	obfuscated := builder.ObfuscateFile(file, info, nil)
+	builder.Finalize(obfuscated)
+
+	// Only the literal in hot is cached, as the file directive wins over the
+	// config, and top is not in a function.
+	if count, size := builder.CachedLiterals(); count != 1 || size != len("hot") {
+		t.Fatalf("CachedLiterals() = %d, %d; want 1, %d", count, size, len("hot"))
+	}
+
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "main.go")
+	f, err := os.Create(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := printer.Fprint(f, fset, obfuscated); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("go", "run", srcPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if got, want := string(out), "top hot cold\n"; got != want {
+		t.Fatalf("got output %q, want %q", got, want)
+	}
+}
+
+func TestCarriedDirectives(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"package p\n\nfunc f() {}\n", ""},
+		{"package p\n\n//garble:noliterals\nfunc f() {}\n", "//garble:noliterals"},
+		{"package p\n\n//garble:literals cache\nfunc f() {}\n", "//garble:literals cache"},
+		{"package p\n\n//garble:literals nocache\n\n//garble:literals\nfunc f() {}\n", "//garble:literals nocache"},
+		{"package p\n\n//garble:literals cache\n\n//garble:noliterals\nfunc f() {}\n", "//garble:noliterals"},
+		{"package p\n\n//garble:noliterals\n\nfunc f() {}\n", "//garble:noliterals"},
+		{"package p\n\n//garble:literals hash\n\n//garble:literals nocache\nfunc f() {}\n", "//garble:literals nocache hash"},
+	}
+	for _, test := range tests {
+		file, err := parser.ParseFile(token.NewFileSet(), "p.go", test.src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if group := CarriedDirectives(file, file.Decls[0].(*ast.FuncDecl)); group != nil {
+			got = group.List[0].Text
+		}
+		if got != test.want {
+			t.Errorf("CarriedDirectives(%q) = %q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
 func TestHandleCompositeLiteralByteSlice(t *testing.T) {
 	src := `package p
 var b = []byte{1,2,3}
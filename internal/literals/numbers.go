@@ -0,0 +1,141 @@
+package literals
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"math"
+	"strconv"
+
+	ah "github.com/AeonDave/garble/internal/asthelper"
+)
+
+// DefaultNumberBudget is how many integer and float literals are obfuscated
+// in each package by default; see NumberBudget.
+const DefaultNumberBudget = 256
+
+// NumberBudget limits how many integer and float literals are obfuscated in a
+// package. Each one becomes a few arithmetic operations on a value loaded from
+// memory, so obfuscating every number could noticeably slow down hot arithmetic.
+// A budget is shared by the builders for all of a package's files.
+type NumberBudget struct {
+	left int
+}
+
+// NewNumberBudget returns a budget allowing n numeric literals to be obfuscated.
+func NewNumberBudget(n int) *NumberBudget {
+	return &NumberBudget{left: n}
+}
+
+// numberKeyBits returns the width of the keys for integers of a basic type,
+// which must fit in the type on every architecture.
+func numberKeyBits(typ *types.Basic) uint {
+	switch typ.Kind() {
+	case types.Int8, types.Uint8:
+		return 8
+	case types.Int16, types.Uint16:
+		return 16
+	case types.Int32, types.Uint32, types.Int, types.Uint, types.Uintptr:
+		return 32
+	case types.Int64, types.Uint64:
+		return 64
+	}
+	return 0
+}
+
+// obfuscateNumber returns an expression with the value of a typed integer or
+// float constant which does not appear as an immediate, or nil if the value
+// is not worth obfuscating, such as zero or one.
+//
+// An integer is XORed with a random key, which is hidden via proxyDispatcher
+// so that the compiler cannot fold it back, and the two are combined with
+// mbaXOR. A float is split into an integer mantissa, obfuscated the same way,
+// and a power of two, which reveals nothing but its magnitude.
+func obfuscateNumber(obfRand *obfRand, typ *types.Basic, value constant.Value) ast.Expr {
+	info := typ.Info()
+	switch {
+	case info&types.IsUntyped != 0:
+		return nil
+	case info&types.IsInteger != 0:
+		if constant.Compare(constant.MakeInt64(-1), token.LEQ, value) && constant.Compare(value, token.LEQ, constant.MakeInt64(1)) {
+			return nil
+		}
+		return obfuscateInt(obfRand, typ, value)
+	case info&types.IsFloat != 0:
+		var f float64
+		if typ.Kind() == types.Float32 {
+			f32, _ := constant.Float32Val(value)
+			f = float64(f32)
+		} else {
+			f, _ = constant.Float64Val(value)
+		}
+		if f == 0 || math.IsInf(f, 0) {
+			return nil
+		}
+		frac, exp := math.Frexp(f)
+		mant, exp := int64(math.Ldexp(frac, 53)), exp-53
+		// Subnormal values have fewer significant bits,
+		// so the mantissa loses nothing but trailing zeros.
+		for exp < -1074 {
+			mant >>= 1
+			exp++
+		}
+		mantExpr := obfuscateInt(obfRand, types.Typ[types.Int64], constant.MakeInt64(mant))
+		scale := &ast.BasicLit{Kind: token.FLOAT, Value: strconv.FormatFloat(math.Ldexp(1, exp), 'g', -1, 64)}
+		var expr ast.Expr = ah.BinaryExpr(ah.CallExprByName("float64", mantExpr), token.MUL, scale)
+		if typ.Kind() != types.Float64 {
+			expr = ah.CallExprByName(typ.Name(), expr)
+		}
+		return expr
+	}
+	return nil
+}
+
+// obfuscateInt is like obfuscateNumber for integers.
+func obfuscateInt(obfRand *obfRand, typ *types.Basic, value constant.Value) ast.Expr {
+	bits := numberKeyBits(typ)
+	if bits == 0 {
+		return nil
+	}
+	var key uint64
+	for key == 0 {
+		key = obfRand.Uint64() >> (64 - bits)
+	}
+	var cipher, keyVal constant.Value
+	if typ.Info()&types.IsUnsigned != 0 {
+		plain, _ := constant.Uint64Val(value)
+		cipher, keyVal = constant.MakeUint64(plain^key), constant.MakeUint64(key)
+	} else {
+		signedKey := int64(key<<(64-bits)) >> (64 - bits) // sign-extended
+		plain, _ := constant.Int64Val(value)
+		// The XOR of two sign-extended values is sign-extended too,
+		// so the result still fits in the type.
+		cipher, keyVal = constant.MakeInt64(plain^signedKey), constant.MakeInt64(signedKey)
+	}
+	hidden := obfRand.proxyDispatcher.HideValue(intLit(keyVal), ast.NewIdent(typ.Name()))
+	return &ast.ParenExpr{X: mbaXOR(obfRand.Rand,
+		func() ast.Expr { return intLit(cipher) },
+		func() ast.Expr { return cloneSelector(hidden) },
+	)}
+}
+
+// intLit returns an integer literal, negated if the value is negative.
+func intLit(value constant.Value) ast.Expr {
+	if constant.Sign(value) < 0 {
+		return ah.UnaryExpr(token.SUB, intLit(constant.UnaryOp(token.SUB, value, 0)))
+	}
+	return &ast.BasicLit{Kind: token.INT, Value: value.ExactString()}
+}
+
+// cloneSelector returns a copy of a path returned by proxyDispatcher.HideValue,
+// as each occurrence in the syntax tree needs its own nodes.
+func cloneSelector(expr ast.Expr) ast.Expr {
+	switch expr := expr.(type) {
+	case *ast.SelectorExpr:
+		return &ast.SelectorExpr{X: cloneSelector(expr.X), Sel: ast.NewIdent(expr.Sel.Name)}
+	case *ast.Ident:
+		return ast.NewIdent(expr.Name)
+	}
+	panic("unexpected expression in a proxy path")
+}
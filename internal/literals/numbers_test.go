@@ -0,0 +1,134 @@
+package literals
+
+import (
+	"bytes"
+	"fmt"
+	"go/printer"
+	mathrand "math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestObfuscateNumbers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a binary")
+	}
+	src := `package main
+
+const limit = 123456789
+
+type flag uint8
+
+var table = [4]int{2: 77777}
+
+var magic uint32 = 0xEDB88320
+
+func values(n uint) {
+	var arr [limit % 10]byte
+	f32 := float32(0.1)
+	println(int8(-100), uint8(200), int16(-31234), uint16(65000))
+	println(int32(-2000000001), uint32(4000000001))
+	println(int64(-9223372036854775808), uint64(18446744073709551615))
+	println(-123456, uint(987654), uintptr(0xdeadbeef), limit)
+	println(float64(3.141592653589793), -2.5e300, 5e-324, f32, float32(-3.4e38))
+	println(1<<n, len(arr), table[2], magic, flag(42), 0, 1, -1)
+}
+
+func kind(n int) string {
+	switch n {
+	case 31337:
+		return "case"
+	}
+	return "other"
+}
+
+func main() {
+	values(3)
+	println(kind(31337), kind(2))
+}
+`
+	file, info, fset := parseAndTypecheck(t, src)
+	rand := mathrand.New(mathrand.NewSource(1))
+	nameFunc := func(r *mathrand.Rand, base string) string { return fmt.Sprintf("%s%d", base, r.Uint64()) }
+	builder := NewBuilder(rand, file, nameFunc, BuilderConfig{Numbers: NewNumberBudget(DefaultNumberBudget)})
+	obfuscated := builder.ObfuscateFile(file, info, nil)
+	builder.Finalize(obfuscated)
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, obfuscated); err != nil {
+		t.Fatal(err)
+	}
+	code := buf.String()
+	for _, plain := range []string{"0xEDB88320", "3.141592653589793", "987654", "77777"} {
+		if strings.Contains(code, plain) {
+			t.Errorf("%s survived obfuscation:\n%s", plain, code)
+		}
+	}
+	// Numbers required to be constant are left alone.
+	for _, kept := range []string{"const limit = 123456789", "{2: ", "case 31337", "[limit % 10]byte"} {
+		if !strings.Contains(code, kept) {
+			t.Errorf("%q was obfuscated:\n%s", kept, code)
+		}
+	}
+
+	want := runGoSource(t, src)
+	if got := runGoSource(t, code); got != want {
+		t.Fatalf("got output:\n%s\nwant:\n%s\ncode:\n%s", got, want, code)
+	}
+}
+
+func TestObfuscateNumbersBudget(t *testing.T) {
+	src := `package p
+
+var a, b, c = 1000, 2000, 3000
+`
+	budget := NewNumberBudget(2)
+	var counts []int
+	for range 2 {
+		file, info, _ := parseAndTypecheck(t, src)
+		builder := NewBuilder(mathrand.New(mathrand.NewSource(1)), file,
+			func(r *mathrand.Rand, base string) string { return base }, BuilderConfig{Numbers: budget})
+		builder.ObfuscateFile(file, info, nil)
+		counts = append(counts, builder.NumberCount())
+	}
+	// The budget is shared by all of a package's files.
+	if counts[0] != 2 || counts[1] != 0 {
+		t.Fatalf("NumberCount() = %v, want [2 0]", counts)
+	}
+}
+
+func TestObfuscateNumbersShadowed(t *testing.T) {
+	src := `package p
+
+func f() {
+	var int64 struct{}
+	_ = int64
+	println(3.5, uint32(70000))
+}
+`
+	file, info, _ := parseAndTypecheck(t, src)
+	builder := NewBuilder(mathrand.New(mathrand.NewSource(1)), file,
+		func(r *mathrand.Rand, base string) string { return base }, BuilderConfig{Numbers: NewNumberBudget(10)})
+	builder.ObfuscateFile(file, info, nil)
+	// Obfuscated floats use int64, so only the uint32 can be obfuscated.
+	if got := builder.NumberCount(); got != 1 {
+		t.Fatalf("NumberCount() = %d, want 1", got)
+	}
+}
+
+// runGoSource runs a main package with a single file, returning its output.
+func runGoSource(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte(src), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("go", "run", path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s\n%s", err, out, src)
+	}
+	return string(out)
+}
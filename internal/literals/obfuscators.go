@@ -69,6 +69,7 @@ const (
 	strategyNameShuffle = "shuffle"
 	strategyNameSeed    = "seed"
 	strategyNameCipher  = "cipher"
+	strategyNameChunked = "chunked"
 )
 
 func init() {
@@ -81,6 +82,10 @@ func init() {
 	// Primary strategy: custom cipher with per-build random S-box.
 	// Weight 6 gives ~60% selection probability (6 / (4×1 + 6) = 60%).
 	registerStrategy(strategyNameCipher, customCipherObfuscator{}, withWeight(6))
+
+	// Literals larger than maxSize are split into chunks, each encrypted
+	// with the custom cipher, so that the generated code grows linearly.
+	registerStrategy(strategyNameChunked, chunkedCipher{}, withLinearOnly())
 }
 
 func genRandIntSlice(obfRand *mathrand.Rand, max, count int) []int {
@@ -285,6 +290,9 @@ type obfRand struct {
 	testObfuscator obfuscator
 
 	proxyDispatcher *proxyDispatcher
+
+	// strategyCounts counts how many literals each strategy obfuscated.
+	strategyCounts map[string]int
 }
 
 func (r *obfRand) nextObfuscator() obfuscator {
@@ -317,5 +325,5 @@ func (r *obfRand) nextLinearTimeObfuscatorForSize(dataLen int) obfuscator {
 
 func newObfRand(rand *mathrand.Rand, file *ast.File, nameFunc NameProviderFunc) *obfRand {
 	testObf := testPkgToObfuscatorMap[file.Name.Name]
-	return &obfRand{rand, testObf, newProxyDispatcher(rand, nameFunc)}
+	return &obfRand{rand, testObf, newProxyDispatcher(rand, nameFunc), nil}
 }
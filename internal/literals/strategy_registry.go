@@ -3,20 +3,28 @@ package literals
 import (
 	"fmt"
 	mathrand "math/rand"
+	"reflect"
 	"sync"
 )
 
 type strategyOption func(*strategyConfig)
 
 type strategyConfig struct {
-	linear bool
-	weight int // selection weight (higher = more likely). Default 1.
+	linear     bool
+	linearOnly bool
+	weight     int // selection weight (higher = more likely). Default 1.
 }
 
 func withLinearSupport() strategyOption {
 	return func(cfg *strategyConfig) { cfg.linear = true }
 }
 
+// withLinearOnly is like withLinearSupport, but the strategy is only picked
+// for literals larger than maxSize.
+func withLinearOnly() strategyOption {
+	return func(cfg *strategyConfig) { cfg.linear, cfg.linearOnly = true, true }
+}
+
 func withWeight(w int) strategyOption {
 	return func(cfg *strategyConfig) { cfg.weight = w }
 }
@@ -29,6 +37,7 @@ type strategyEntry struct {
 type strategyRegistry struct {
 	mu      sync.RWMutex
 	entries map[string]strategyEntry
+	order   []string // all names, in registration order
 	general []string
 	linear  []string
 }
@@ -53,7 +62,10 @@ func (r *strategyRegistry) register(name string, obf obfuscator, opts ...strateg
 		cfg.weight = 1
 	}
 	r.entries[name] = strategyEntry{obf: obf, weight: cfg.weight}
-	r.general = append(r.general, name)
+	r.order = append(r.order, name)
+	if !cfg.linearOnly {
+		r.general = append(r.general, name)
+	}
 	if cfg.linear {
 		r.linear = append(r.linear, name)
 	}
@@ -98,8 +110,8 @@ func (r *strategyRegistry) pickLinear(rand *mathrand.Rand) obfuscator {
 func (r *strategyRegistry) names() []string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	names := make([]string, len(r.general))
-	copy(names, r.general)
+	names := make([]string, len(r.order))
+	copy(names, r.order)
 	return names
 }
 
@@ -110,6 +122,20 @@ func (r *strategyRegistry) byName(name string) (obfuscator, bool) {
 	return e.obf, ok
 }
 
+// nameOf returns the registered name of an obfuscator, matching by type,
+// or its Go type name if it was never registered.
+func (r *strategyRegistry) nameOf(obf obfuscator) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	typ := reflect.TypeOf(obf)
+	for _, name := range r.order {
+		if reflect.TypeOf(r.entries[name].obf) == typ {
+			return name
+		}
+	}
+	return fmt.Sprintf("%T", obf)
+}
+
 var defaultStrategies = newStrategyRegistry()
 
 func registerStrategy(name string, obf obfuscator, opts ...strategyOption) {
@@ -128,6 +154,10 @@ func strategyByName(name string) (obfuscator, bool) {
 	return defaultStrategies.byName(name)
 }
 
+func strategyNameOf(obf obfuscator) string {
+	return defaultStrategies.nameOf(obf)
+}
+
 func pickGeneralStrategy(rand *mathrand.Rand) obfuscator {
 	return defaultStrategies.pickGeneral(rand)
 }
@@ -45,3 +45,16 @@ func TestStrategyRegistryNamesAndLookup(t *testing.T) {
 		t.Fatal("did not expect to find missing strategy")
 	}
 }
+
+func TestStrategyRegistryNameOf(t *testing.T) {
+	r := newStrategyRegistry()
+	r.register("a", swap{})
+	r.register("c", split{}, withLinearSupport())
+
+	if got := r.nameOf(split{}); got != "c" {
+		t.Fatalf("nameOf(split{})=%q, want %q", got, "c")
+	}
+	if got := r.nameOf(shuffle{}); got != "literals.shuffle" {
+		t.Fatalf("nameOf(shuffle{})=%q, want the Go type name", got)
+	}
+}
@@ -1,6 +1,10 @@
 package pipeline
 
-import "fmt"
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
 
 // Step represents a discrete unit of work executed within a pipeline.
 // Implementations should mutate the provided context and return an error
@@ -43,9 +47,13 @@ func (p *Pipeline[C]) Add(step Step[C]) {
 // Execute runs all steps in order, passing the shared context to each.
 // An error returned by any step stops execution and is wrapped with the
 // failing step's name for easier debugging.
+// Each step is logged as a debug event with log/slog, along with its duration.
 func (p *Pipeline[C]) Execute(ctx C) error {
 	for _, step := range p.steps {
-		if err := step.Run(ctx); err != nil {
+		start := time.Now()
+		err := step.Run(ctx)
+		slog.Debug("pipeline step", "step", step.Name(), "took", time.Since(start), "ok", err == nil)
+		if err != nil {
 			return fmt.Errorf("%s step failed: %w", step.Name(), err)
 		}
 	}
@@ -0,0 +1,190 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/AeonDave/garble/internal/typesutil"
+)
+
+// keepDirective marks a declaration, type, struct field, or method
+// whose name must not be obfuscated, for example because it is looked up
+// by name at run time in a way that reflectInspector cannot see.
+// The keep patterns in garble.toml do the same for code we cannot annotate.
+const keepDirective = "//garble:keep"
+
+func hasKeepDirective(groups ...*ast.CommentGroup) bool {
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		for _, comment := range group.List {
+			if rest, ok := strings.CutPrefix(comment.Text, keepDirective); ok && (rest == "" || rest[0] == ' ') {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keepKey returns the key under which pkgCache.KeptNames records an object,
+// or the empty string if the object is never kept.
+//
+// Top-level names are keyed like "pkg.Name". Methods are keyed like "pkg.*.Name",
+// since all methods with the same name in a package are hashed the same way,
+// and keeping only some of them could break interface satisfaction.
+// Fields are keyed by the identity of their struct type like hashWithStruct,
+// so that conversions between identical struct types keep working.
+func keepKey(obj types.Object, fieldToStruct map[*types.Var]*types.Struct) string {
+	pkg := obj.Pkg()
+	if pkg == nil {
+		return ""
+	}
+	switch obj := obj.(type) {
+	case *types.Var:
+		if obj.IsField() {
+			strct := fieldToStruct[obj]
+			if strct == nil {
+				return ""
+			}
+			return fieldKeepKey(strct, obj.Name())
+		}
+	case *types.Func:
+		if obj.Signature().Recv() != nil {
+			return pkg.Path() + ".*." + obj.Name()
+		}
+	}
+	if obj.Parent() != pkg.Scope() {
+		return "" // local names are not visible at run time
+	}
+	return pkg.Path() + "." + obj.Name()
+}
+
+func fieldKeepKey(strct *types.Struct, name string) string {
+	return "field:" + strconv.FormatUint(uint64(typeutil_hash(strct)), 32) + "." + name
+}
+
+// keptTopLevelNames returns the keys of the top-level names which must not be
+// obfuscated in a package, without the need for type information.
+// It is enough for assembly files, which can only reference top-level names.
+func keptTopLevelNames(lpkg *listedPackage, files []*ast.File) map[string]bool {
+	kept := make(map[string]bool)
+	keep := func(name string, directive bool) {
+		if name == "_" {
+			return
+		}
+		if directive || sharedCache.Config.KeepName(lpkg.ImportPath, name) {
+			kept[lpkg.ImportPath+"."+name] = true
+		}
+	}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					keep(decl.Name.Name, hasKeepDirective(decl.Doc))
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						keep(spec.Name.Name, hasKeepDirective(decl.Doc, spec.Doc, spec.Comment))
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							keep(name.Name, hasKeepDirective(decl.Doc, spec.Doc, spec.Comment))
+						}
+					}
+				}
+			}
+		}
+	}
+	return kept
+}
+
+// keptNames extends keptTopLevelNames with the methods and struct fields
+// which must not be obfuscated, which requires type information.
+func keptNames(lpkg *listedPackage, pkg *types.Package, files []*ast.File, info *types.Info) map[string]bool {
+	kept := keptTopLevelNames(lpkg, files)
+	var fieldToStruct map[*types.Var]*types.Struct
+	keep := func(obj types.Object) {
+		if obj == nil || obj.Name() == "_" {
+			return
+		}
+		if fieldToStruct == nil {
+			fieldToStruct = typesutil.FieldToStruct(info)
+		}
+		if key := keepKey(obj, fieldToStruct); key != "" {
+			kept[key] = true
+		}
+	}
+
+	// Methods, including interface methods, and fields with the directive.
+	for _, file := range files {
+		for node := range ast.Preorder(file) {
+			switch node := node.(type) {
+			case *ast.FuncDecl:
+				if node.Recv != nil && hasKeepDirective(node.Doc) {
+					keep(info.Defs[node.Name])
+				}
+			case *ast.Field:
+				if hasKeepDirective(node.Doc, node.Comment) {
+					for _, name := range node.Names {
+						keep(info.Defs[name])
+					}
+				}
+			}
+		}
+	}
+
+	// Methods and fields matching the keep patterns, qualified by their type.
+	if sharedCache.Config == nil || len(sharedCache.Config.Keep) == 0 {
+		return kept
+	}
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		tname, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		keepQualified := func(obj types.Object) bool {
+			return sharedCache.Config.KeepName(lpkg.ImportPath, name+"."+obj.Name())
+		}
+		if named, ok := tname.Type().(*types.Named); ok {
+			for method := range named.Methods() {
+				if keepQualified(method) {
+					keep(method)
+				}
+			}
+		}
+		switch underlying := tname.Type().Underlying().(type) {
+		case *types.Interface:
+			for method := range underlying.ExplicitMethods() {
+				if keepQualified(method) {
+					keep(method)
+				}
+			}
+		case *types.Struct:
+			for field := range underlying.Fields() {
+				if keepQualified(field) {
+					kept[fieldKeepKey(underlying, field.Name())] = true
+				}
+			}
+		}
+	}
+	return kept
+}
+
+// isKept reports whether an object's name must not be obfuscated,
+// as recorded in the package cache by keptNames.
+func (tf *transformer) isKept(obj types.Object) bool {
+	if len(tf.curPkgCache.KeptNames) == 0 {
+		return false
+	}
+	key := keepKey(obj, tf.fieldToStruct)
+	return key != "" && tf.curPkgCache.KeptNames[key]
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/AeonDave/garble/internal/config"
+)
+
+func TestKeptNames(t *testing.T) {
+	src := `package p
+
+//garble:keep
+func KeptFunc() {}
+
+func notKept() {}
+
+//garble:keep
+type (
+	keptType  int
+	keptType2 int
+)
+
+var (
+	keptVar = 1 //garble:keep
+	otherVar = 2
+)
+
+type T struct {
+	keptField int //garble:keep
+	//garble:keeper is a different directive
+	otherField int
+}
+
+//garble:keep
+func (T) keptMethod() {}
+
+func (T) otherMethod() {}
+
+type Entry struct {
+	Level, Message int
+}
+
+func (Entry) byPattern() {}
+
+func ByPattern() {}
+`
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	pkg, err := new(types.Config).Check("test/p", fset, []*ast.File{file}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Parse("garble.toml", []byte(`keep = ["test/p.ByPattern", "test/p.Entry.Level", "test/*.Entry.by*"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	origShared := sharedCache
+	sharedCache = &sharedCacheType{Config: cfg}
+	defer func() { sharedCache = origShared }()
+
+	lpkg := &listedPackage{ImportPath: "test/p"}
+	kept := keptNames(lpkg, pkg, []*ast.File{file}, info)
+
+	entry := pkg.Scope().Lookup("Entry").Type().Underlying().(*types.Struct)
+	strct := pkg.Scope().Lookup("T").Type().Underlying().(*types.Struct)
+	want := []string{
+		"test/p.KeptFunc",
+		"test/p.keptType",
+		"test/p.keptType2",
+		"test/p.keptVar",
+		"test/p.ByPattern",
+		"test/p.*.keptMethod",
+		"test/p.*.byPattern",
+		fieldKeepKey(strct, "keptField"),
+		fieldKeepKey(entry, "Level"),
+	}
+	got := slices.Sorted(maps.Keys(kept))
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Fatalf("keptNames:\ngot  %q\nwant %q", got, want)
+	}
+}
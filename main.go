@@ -19,6 +19,7 @@ import (
 	"io"
 	"io/fs"
 	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -26,6 +27,7 @@ import (
 	"runtime"
 	"runtime/debug"
 	"runtime/pprof"
+	"strconv"
 	"strings"
 	"time"
 
@@ -105,19 +107,33 @@ var booleanFlags = map[string]bool{
 }
 
 var flagSet = flag.NewFlagSet("garble", flag.ExitOnError)
-var rxGarbleFlag = regexp.MustCompile(`-(?:literals|tiny|debug|debugdir|seed|controlflow|force-rename)(?:$|=)`)
+var rxGarbleFlag = regexp.MustCompile(`-(?:literals|literals-cache|literals-hash|tiny|debug|debugdir|seed|controlflow|force-rename|wire-tags|encrypt-tags|names|manifest|manifest-key|manifest-plaintext|from-manifest|report)(?:$|=)`)
 
 var (
-	flagLiterals         bool
-	flagTiny             bool
-	flagDebug            bool
-	flagDebugDir         string
-	flagSeed             seedFlag
-	flagCacheEncrypt     = true // Default ON for security
-	buildNonceRandom     bool
-	flagControlFlowMode  = ctrlflow.ModeOff
-	controlFlowFlagValue = controlFlowFlag{mode: ctrlflow.ModeOff}
-	flagForceRename      bool
+	flagLiterals          bool
+	flagLiteralsCache     bool
+	flagLiteralsHash      bool
+	flagTiny              bool
+	flagDebug             bool
+	flagDebugJSON         bool
+	debugFlagValue        debugFlag
+	flagDebugDir          string
+	flagSeed              seedFlag
+	flagCacheEncrypt      = true // Default ON for security
+	buildNonceRandom      bool
+	flagControlFlowMode   = ctrlflow.ModeOff
+	controlFlowFlagValue  = controlFlowFlag{mode: ctrlflow.ModeOff}
+	flagForceRename       bool
+	flagForceRenameAuto   bool
+	forceRenameFlagValue  forceRenameFlag
+	flagWireTags          bool
+	flagEncryptTags       bool
+	flagNames             = namesHash
+	flagManifest          string
+	flagManifestKey       string
+	flagManifestPlaintext bool
+	flagFromManifest      string
+	flagReport            string
 
 	// Presumably OK to share fset across packages.
 	fset = token.NewFileSet()
@@ -130,12 +146,22 @@ var requestedOutputPath string
 func init() {
 	flagSet.Usage = usage
 	flagSet.BoolVar(&flagLiterals, "literals", false, "Obfuscate literals such as strings")
+	flagSet.BoolVar(&flagLiteralsCache, "literals-cache", false, "Decrypt each obfuscated string literal in a function at most once,\nkeeping the plaintext in memory for the rest of the program's life")
+	flagSet.BoolVar(&flagLiteralsHash, "literals-hash", false, "Compare strings against obfuscated string constants via keyed hashes,\nso that the constants are never decrypted")
 	flagSet.BoolVar(&flagTiny, "tiny", false, "Optimize for binary size with some obfuscation trade-offs")
-	flagSet.BoolVar(&flagDebug, "debug", false, "Print debug logs to stderr")
+	flagSet.Var(&debugFlagValue, "debug", "Print debug logs to stderr; use -debug=json for one JSON object per line")
 	flagSet.StringVar(&flagDebugDir, "debugdir", "", "Write the obfuscated source to a directory, e.g. -debugdir=out")
 	flagSet.Var(&flagSeed, "seed", "Provide a base64-encoded seed, e.g. -seed=o9WDTZ4CN4w\nRandom seed is the default; use -seed=random to print it")
 	flagSet.Var(&controlFlowFlagValue, "controlflow", "Control-flow obfuscation scope: off, directives, auto, all")
-	flagSet.BoolVar(&flagForceRename, "force-rename", false, "Rename exported methods even if they might implement interfaces")
+	flagSet.Var(&forceRenameFlagValue, "force-rename", "Rename exported methods even if they might implement interfaces;\nuse -force-rename=auto to only rename those which whole-program analysis finds safe")
+	flagSet.BoolVar(&flagWireTags, "wire-tags", false, "Add struct tags with the original field names to reflected fields,\nso that encodings like encoding/json keep their output")
+	flagSet.BoolVar(&flagEncryptTags, "encrypt-tags", false, "Encrypt struct tags in obfuscated packages, decrypting them when read via reflect")
+	flagSet.StringVar(&flagNames, "names", namesHash, "Style of obfuscated names: hash, or words for names like loadSlotState")
+	flagSet.StringVar(&flagManifest, "manifest", "", "Write a build manifest for \"garble reverse\" to a file, e.g. -manifest=app.manifest")
+	flagSet.StringVar(&flagManifestKey, "manifest-key", "", "Encrypt the -manifest file to an X25519 public key from \"garble keygen\", or a file holding it")
+	flagSet.BoolVar(&flagManifestPlaintext, "manifest-plaintext", false, "Write the -manifest file unencrypted, even though it contains the seed")
+	flagSet.StringVar(&flagFromManifest, "from-manifest", "", "Reproduce the build recorded in a manifest file, using its seed, nonce, and flags")
+	flagSet.StringVar(&flagReport, "report", "", "Write a JSON report of the obfuscation of each package to a file, e.g. -report=out.json")
 
 	var noCacheEncrypt bool
 	flagSet.BoolVar(&noCacheEncrypt, "no-cache-encrypt", false, "Disable cache encryption (not recommended for production)")
@@ -198,13 +224,25 @@ func main() {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(2)
 	}
+	if flagNames != namesHash && flagNames != namesWords {
+		fmt.Fprintf(os.Stderr, "invalid -names %q: must be %q or %q\n", flagNames, namesHash, namesWords)
+		os.Exit(2)
+	}
 
 	log.SetPrefix("[garble] ")
 	log.SetFlags(0) // no timestamps, as they aren't very useful
-	if flagDebug {
+	switch {
+	case flagDebugJSON:
+		// Every log line becomes a JSON object, and so do the debug events
+		// which our internal packages log via log/slog.
+		// The handler writes each object at once, which keeps the lines from
+		// concurrent toolexec processes sharing stderr apart.
+		log.SetPrefix("")
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	case flagDebug:
 		// TODO: cover this in the tests.
 		log.SetOutput(&uniqueLineWriter{out: os.Stderr})
-	} else {
+	default:
 		log.SetOutput(io.Discard)
 	}
 	args := flagSet.Args()
@@ -214,7 +252,7 @@ func main() {
 	}
 
 	command := args[0]
-	if !flagSeed.present() && (command == "build" || command == "test" || command == "run") {
+	if !flagSeed.present() && (command == "build" || command == "test" || command == "run" || command == "install") {
 		if err := flagSeed.setRandom(false); err != nil {
 			_, _ = fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
@@ -292,7 +330,32 @@ func mainErr(args []string) error {
 			fmt.Printf("%16s %s\n", setting.Key, setting.Value)
 		}
 		return nil
-	case "build", "test", "run":
+	case "build", "test", "run", "install":
+		if err := checkManifestFlags(); err != nil {
+			return err
+		}
+		if command == "install" {
+			var cleanup func()
+			var err error
+			if args, cleanup, err = prepareInstallVersion(args); err != nil {
+				return err
+			}
+			defer cleanup()
+		}
+		var fromManifest *buildManifest
+		if flagFromManifest != "" {
+			m, err := readBuildManifest(flagFromManifest, os.Getenv("GARBLE_MANIFEST_KEY"))
+			if err != nil {
+				return err
+			}
+			if err := m.apply(); err != nil {
+				return err
+			}
+			// Build flags given on the command line are added after the recorded ones,
+			// so that they take precedence.
+			args = append(m.buildFlagsFor(command), args...)
+			fromManifest = m
+		}
 		cmd, err := toolexecCmd(command, args)
 		defer func() {
 			if err := os.RemoveAll(os.Getenv("GARBLE_SHARED")); err != nil {
@@ -312,24 +375,56 @@ func mainErr(args []string) error {
 		if err != nil {
 			return err
 		}
+		if fromManifest != nil {
+			fromManifest.checkBuild()
+		}
+		if flagManifest != "" {
+			if err := writeBuildManifest(flagManifest, flagManifestKey); err != nil {
+				return err
+			}
+		}
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		log.Printf("calling via toolexec: %s", cmd)
 		if err := cmd.Run(); err != nil {
 			return err
 		}
+		if flagReport != "" {
+			if err := writeBuildReport(flagReport); err != nil {
+				return err
+			}
+		}
 		return finalizeRequestedOutput(sharedCache.GoEnv.GOOS)
 
+	case "reverse":
+		return commandReverse(args)
+
+	case "plan":
+		return commandPlan(args)
+
+	case "audit":
+		return commandAudit(args)
+
+	case "keygen":
+		return commandKeygen(args)
+
+	case "cache":
+		return commandCache(args)
+
 	case "toolexec":
 		_, tool := filepath.Split(args[0])
 		if runtime.GOOS == "windows" {
 			tool = strings.TrimSuffix(tool, ".exe")
 		}
+		if flagDebugJSON {
+			slog.SetDefault(slog.Default().With("tool", tool, "pkg", os.Getenv("TOOLEXEC_IMPORTPATH")))
+		}
 		transform := transformMethods[tool]
 		transformed := args[1:]
 		if transform != nil {
 			startTime := time.Now()
 			log.Printf("transforming %s with args: %s", tool, strings.Join(transformed, " "))
+			slog.Debug("transform start")
 
 			// We're in a toolexec sub-process, not directly called by the user.
 			// Load the shared data and wrap the tool, like the compiler or linker.
@@ -353,6 +448,7 @@ func mainErr(args []string) error {
 				return err
 			}
 			log.Printf("transformed args for %s in %s: %s", tool, debugSince(startTime), strings.Join(transformed, " "))
+			slog.Debug("transform end", "took", debugSince(startTime))
 		} else {
 			log.Printf("skipping transform on %s with args: %s", tool, strings.Join(transformed, " "))
 		}
@@ -415,6 +511,19 @@ This command wraps "go %s". Below is its help:
 	// Here is the only place we initialize the cache.
 	// The sub-processes will parse it from a shared gob file.
 	sharedCache = &sharedCacheType{}
+	if err := fetchGoEnv(); err != nil {
+		return nil, err
+	}
+
+	if !goVersionOK() {
+		return nil, errJustExit(1)
+	}
+
+	// garble.toml may set the nonce, so load it first.
+	if err := loadProjectConfig(); err != nil {
+		return nil, err
+	}
+
 	nonce, nonceRandom, err := generateBuildNonce()
 	if err != nil {
 		return nil, err
@@ -439,31 +548,14 @@ This command wraps "go %s". Below is its help:
 		sharedCache.ForwardBuildFlags = append(sharedCache.ForwardBuildFlags, "-test")
 	}
 
-	if err := fetchGoEnv(); err != nil {
-		return nil, err
-	}
-
-	if !goVersionOK() {
-		return nil, errJustExit(1)
-	}
-
 	execPath, err := os.Executable()
 	if err != nil {
 		return nil, err
 	}
 
-	// Always an absolute directory; defaults to e.g. "~/.cache/garble".
-	if dir := os.Getenv("GARBLE_CACHE"); dir != "" {
-		sharedCache.CacheDir, err = filepath.Abs(dir)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		parentDir, err := os.UserCacheDir()
-		if err != nil {
-			return nil, err
-		}
-		sharedCache.CacheDir = filepath.Join(parentDir, "garble")
+	sharedCache.CacheDir, err = garbleCacheDir()
+	if err != nil {
+		return nil, err
 	}
 
 	binaryBuildID, err := buildidOf(execPath)
@@ -475,6 +567,16 @@ This command wraps "go %s". Below is its help:
 	if err := appendListedPackages(args, true); err != nil {
 		return nil, err
 	}
+	// analyzeProgram stores the package caches under the final action IDs,
+	// so it must run last.
+	if err := analyzeConsts(command, flags); err != nil {
+		return nil, err
+	}
+	if flagForceRenameAuto {
+		if err := analyzeProgram(command, flags); err != nil {
+			return nil, err
+		}
+	}
 
 	sharedTempDir, err = saveSharedCache()
 	if err != nil {
@@ -533,13 +635,14 @@ This command wraps "go %s". Below is its help:
 	toolexecFlag.WriteString(" toolexec")
 	goArgs = append(goArgs, toolexecFlag.String())
 
-	if flagControlFlowMode.Enabled() {
+	if flagControlFlowMode.Enabled() || sharedCache.Config.AnyControlFlow() {
 		goArgs = append(goArgs, "-debug-actiongraph", filepath.Join(sharedTempDir, actionGraphFileName))
 	}
-	if flagDebugDir != "" {
+	if flagDebugDir != "" || flagReport != "" {
 		// In case the user deletes the debug directory,
 		// and a previous build is cached,
 		// rebuild all packages to re-fill the debug dir.
+		// Similarly, a report needs every package to be compiled.
 		goArgs = append(goArgs, "-a")
 	}
 	if command == "test" {
@@ -581,6 +684,62 @@ This command wraps "go %s". Below is its help:
 	return cmd, nil
 }
 
+// debugFlag is a boolean flag which also accepts "json",
+// to print structured debug logs instead of plain text.
+// It sets flagDebug and flagDebugJSON directly, so that they stay in sync
+// no matter when the flag is set, such as by buildManifest.apply.
+type debugFlag struct{}
+
+func (debugFlag) IsBoolFlag() bool { return true }
+
+func (debugFlag) String() string {
+	if flagDebugJSON {
+		return "json"
+	}
+	return strconv.FormatBool(flagDebug)
+}
+
+func (*debugFlag) Set(value string) error {
+	if value == "json" {
+		flagDebug, flagDebugJSON = true, true
+		return nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf(`must be a boolean or "json"`)
+	}
+	flagDebug, flagDebugJSON = enabled, false
+	return nil
+}
+
+// forceRenameFlag is a boolean flag which also accepts "auto",
+// as implemented by analyzeProgram.
+// Like debugFlag, it sets flagForceRename and flagForceRenameAuto directly,
+// as buildManifest.apply and garble.toml may set it after the flags are parsed.
+type forceRenameFlag struct{}
+
+func (forceRenameFlag) IsBoolFlag() bool { return true }
+
+func (forceRenameFlag) String() string {
+	if flagForceRenameAuto {
+		return "auto"
+	}
+	return strconv.FormatBool(flagForceRename)
+}
+
+func (*forceRenameFlag) Set(value string) error {
+	if value == "auto" {
+		flagForceRename, flagForceRenameAuto = true, true
+		return nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf(`must be a boolean or "auto"`)
+	}
+	flagForceRename, flagForceRenameAuto = enabled, false
+	return nil
+}
+
 type controlFlowFlag struct {
 	mode ctrlflow.Mode
 	set  bool
@@ -834,6 +993,12 @@ Similarly, to combine garble flags and Go build flags:
 	build          replace "go build"
 	test           replace "go test"
 	run            replace "go run"
+	install        replace "go install"
+	reverse        de-obfuscate output such as stack traces
+	plan           show what a build would obfuscate, without building
+	audit          check a built binary for names and strings which leaked
+	keygen         generate a key pair to encrypt build manifests
+	cache          inspect, verify, and clean the garble cache
 	version        print the version and build settings of the garble binary
 
 To learn more about a command, run "garble help <command>".
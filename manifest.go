@@ -0,0 +1,352 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/AeonDave/garble/internal/config"
+	"github.com/AeonDave/garble/internal/literals"
+)
+
+// buildManifest records the inputs which determine how a build was obfuscated,
+// so that commands like "garble reverse" can recompute the same names and
+// positions later on without requiring the original environment.
+//
+// Note that the manifest contains the seed, so it must be kept private.
+// It is encrypted with -manifest-key so that only the holder of the
+// matching private key can read it; see sealManifest.
+// Writing it unencrypted requires -manifest-plaintext.
+type buildManifest struct {
+	GoVersion string // as per GoEnv.GOVERSION
+
+	// BinaryContentID identifies the garble binary which did the build,
+	// as per sharedCache.BinaryContentID.
+	BinaryContentID []byte
+
+	// Nonce is the base64-encoded build nonce, as per GARBLE_BUILD_NONCE.
+	Nonce string
+
+	GOGARBLE string
+
+	// Flags holds garble's own flags which affect the build,
+	// as written by appendFlags, including -seed.
+	Flags []string
+
+	// BuildFlags holds the Go build flags forwarded to "go list",
+	// such as -tags, as per ForwardBuildFlags.
+	BuildFlags []string
+
+	// Packages lists the import paths of the obfuscated packages.
+	Packages []string
+
+	// Config holds the settings from garble.toml, if the main module had one,
+	// as its rules affect obfuscation; see projectConfigHashInput.
+	Config *config.Config `json:",omitempty"`
+}
+
+// appliedManifest is the manifest being reproduced, if any,
+// whose settings loadProjectConfig uses instead of garble.toml.
+var appliedManifest *buildManifest
+
+// newBuildManifest fills a buildManifest from the current sharedCache and flags.
+func newBuildManifest() *buildManifest {
+	var flags bytes.Buffer
+	appendFlags(&flags, true)
+	var pkgs []string
+	for _, path := range slices.Sorted(maps.Keys(sharedCache.ListedPackages)) {
+		if sharedCache.ListedPackages[path].ToObfuscate {
+			pkgs = append(pkgs, path)
+		}
+	}
+	return &buildManifest{
+		GoVersion:       sharedCache.GoEnv.GOVERSION,
+		BinaryContentID: sharedCache.BinaryContentID,
+		Nonce:           base64.RawStdEncoding.EncodeToString(sharedCache.BuildNonce),
+		GOGARBLE:        sharedCache.GOGARBLE,
+		Flags:           strings.Fields(flags.String()),
+		BuildFlags:      sharedCache.ForwardBuildFlags,
+		Packages:        pkgs,
+		Config:          sharedCache.Config,
+	}
+}
+
+// writeBuildManifest writes the manifest for the current build to path.
+// If publicKey is not empty, the manifest is encrypted to it;
+// see checkManifestFlags.
+func writeBuildManifest(path, publicKey string) error {
+	data, err := json.MarshalIndent(newBuildManifest(), "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if publicKey != "" {
+		recipient, err := parseManifestPublicKey(publicKey)
+		if err != nil {
+			return err
+		}
+		if data, err = sealManifest(data, recipient); err != nil {
+			return err
+		}
+	}
+	// The manifest includes the seed, so don't make it world-readable.
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("cannot write build manifest: %v", err)
+	}
+	return nil
+}
+
+// readBuildManifest reads a manifest written by writeBuildManifest.
+// If the manifest is encrypted, keyPath must name the file holding the private key,
+// as written by "garble keygen".
+func readBuildManifest(path, keyPath string) (*buildManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read build manifest: %v", err)
+	}
+	if bytes.HasPrefix(data, encryptedManifestMagic) {
+		if keyPath == "" {
+			return nil, fmt.Errorf("build manifest %s is encrypted; provide its private key via GARBLE_MANIFEST_KEY", path)
+		}
+		key, err := readManifestPrivateKey(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = openManifest(data, key); err != nil {
+			return nil, fmt.Errorf("cannot decrypt build manifest %s: %v", path, err)
+		}
+	}
+	var m buildManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("cannot decode build manifest %s: %v", path, err)
+	}
+	return &m, nil
+}
+
+// apply restores the global garble flags and environment recorded in the manifest.
+// Flags given on the command line take precedence over the recorded ones.
+// It must be called before toolexecCmd, which reads the nonce and GOGARBLE.
+func (m *buildManifest) apply() error {
+	setFlags := make(map[string]bool)
+	flagSet.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	for _, arg := range m.Flags {
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "-"), "=")
+		if setFlags[name] {
+			continue
+		}
+		if !hasValue {
+			value = "true" // a boolean flag
+		}
+		if err := flagSet.Set(name, value); err != nil {
+			return fmt.Errorf("invalid flag %q in build manifest: %v", arg, err)
+		}
+		if name == "no-cache-encrypt" {
+			flagCacheEncrypt = false
+		}
+	}
+	if err := resolveControlFlowMode(); err != nil {
+		return err
+	}
+	if m.Nonce != "" {
+		_ = os.Setenv("GARBLE_BUILD_NONCE", m.Nonce)
+	}
+	if m.GOGARBLE != "" {
+		_ = os.Setenv("GOGARBLE", m.GOGARBLE)
+	}
+	appliedManifest = m
+	return nil
+}
+
+// buildFlagsFor returns the recorded build flags which apply to a command.
+// "garble test" records -test for "go list", which other commands don't accept.
+func (m *buildManifest) buildFlagsFor(command string) []string {
+	if command == "test" {
+		return m.BuildFlags
+	}
+	return slices.DeleteFunc(slices.Clone(m.BuildFlags), func(f string) bool { return f == "-test" })
+}
+
+// checkBuild warns if the current build can't reproduce the recorded one,
+// since a different Go or garble version obfuscates differently.
+// It must be called after toolexecCmd.
+func (m *buildManifest) checkBuild() {
+	if m.GoVersion != sharedCache.GoEnv.GOVERSION {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: the manifest was built with %s, but this build uses %s\n",
+			m.GoVersion, sharedCache.GoEnv.GOVERSION)
+	}
+	if !bytes.Equal(m.BinaryContentID, sharedCache.BinaryContentID) {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: the manifest was built with a different garble binary\n")
+	}
+}
+
+// Encrypted manifests start with encryptedManifestMagic, followed by an ephemeral
+// X25519 public key, an ASCON-128 nonce, and the ciphertext with its tag.
+// The ASCON key is derived from the X25519 shared secret and both public keys,
+// so each manifest is encrypted with a fresh key.
+var encryptedManifestMagic = []byte("garble-manifest-x25519-ascon128\n")
+
+const (
+	manifestPublicKeySize = 32
+	manifestNonceSize     = 16
+)
+
+func manifestCipherKey(shared, ephemeral, recipient []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("garble-manifest-v1"))
+	h.Write(shared)
+	h.Write(ephemeral)
+	h.Write(recipient)
+	return h.Sum(nil)[:16]
+}
+
+// sealManifest encrypts a manifest so that only the owner of the private key
+// matching recipient can decrypt it with openManifest.
+func sealManifest(plaintext []byte, recipient *ecdh.PublicKey) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, manifestNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	ephemeralPub := ephemeral.PublicKey().Bytes()
+	key := manifestCipherKey(shared, ephemeralPub, recipient.Bytes())
+
+	out := slices.Clone(encryptedManifestMagic)
+	out = append(out, ephemeralPub...)
+	out = append(out, nonce...)
+	out = append(out, literals.AsconEncrypt(key, nonce, plaintext)...)
+	return out, nil
+}
+
+// openManifest decrypts a manifest encrypted by sealManifest.
+func openManifest(data []byte, key *ecdh.PrivateKey) ([]byte, error) {
+	data = bytes.TrimPrefix(data, encryptedManifestMagic)
+	if len(data) < manifestPublicKeySize+manifestNonceSize {
+		return nil, errors.New("encrypted manifest is too short")
+	}
+	ephemeralPub, nonce, sealed := data[:manifestPublicKeySize], data[manifestPublicKeySize:][:manifestNonceSize], data[manifestPublicKeySize+manifestNonceSize:]
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralPub)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := key.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, ok := literals.AsconDecrypt(manifestCipherKey(shared, ephemeralPub, key.PublicKey().Bytes()), nonce, sealed)
+	if !ok {
+		return nil, errors.New("wrong private key or tampered manifest")
+	}
+	return plaintext, nil
+}
+
+// parseManifestPublicKey decodes a base64 X25519 public key,
+// as printed by "garble keygen", or reads it from a file.
+func parseManifestPublicKey(s string) (*ecdh.PublicKey, error) {
+	if data, err := os.ReadFile(s); err == nil {
+		s = string(data)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	b, err := decodeManifestKey(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest public key: %v", err)
+	}
+	return ecdh.X25519().NewPublicKey(b)
+}
+
+// readManifestPrivateKey reads a base64 X25519 private key from a file,
+// as written by "garble keygen".
+func readManifestPrivateKey(path string) (*ecdh.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read manifest private key: %v", err)
+	}
+	b, err := decodeManifestKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest private key in %s: %v", path, err)
+	}
+	return ecdh.X25519().NewPrivateKey(b)
+}
+
+func decodeManifestKey(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+	b, err := base64.RawStdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != manifestPublicKeySize {
+		return nil, fmt.Errorf("got %d bytes, want %d", len(b), manifestPublicKeySize)
+	}
+	return b, nil
+}
+
+// checkManifestFlags validates -manifest and the flags which go with it.
+// Since the manifest contains the seed, it is only written unencrypted
+// when asked for explicitly.
+func checkManifestFlags() error {
+	switch {
+	case flagManifest == "" && (flagManifestKey != "" || flagManifestPlaintext):
+		return fmt.Errorf("-manifest-key and -manifest-plaintext require -manifest")
+	case flagManifestKey != "" && flagManifestPlaintext:
+		return fmt.Errorf("-manifest-key and -manifest-plaintext are mutually exclusive")
+	case flagManifest != "" && flagManifestKey == "" && !flagManifestPlaintext:
+		return fmt.Errorf("-manifest requires -manifest-key, as the manifest contains the seed; use -manifest-plaintext to write it unencrypted")
+	}
+	return nil
+}
+
+// commandKeygen implements "garble keygen".
+func commandKeygen(args []string) error {
+	if hasHelpFlag(args) || len(args) != 1 {
+		_, _ = fmt.Fprint(os.Stderr, `
+usage: garble keygen private-key-file
+
+Keygen generates an X25519 key pair to encrypt build manifests.
+The private key is written to the given file, which must not exist yet,
+and the public key is printed to standard output. For example:
+
+	garble keygen vendor.key > vendor.pub
+	garble -manifest=app.garble -manifest-key=vendor.pub build ./cmd/app
+	GARBLE_MANIFEST_KEY=vendor.key garble reverse -manifest=app.garble ./cmd/app < crash.log
+`[1:])
+		return errJustExit(2)
+	}
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, base64.RawStdEncoding.EncodeToString(key.Bytes())); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Println(base64.RawStdEncoding.EncodeToString(key.PublicKey().Bytes()))
+	return nil
+}
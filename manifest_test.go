@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/garble/internal/config"
+)
+
+func TestSealManifest(t *testing.T) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte(`{"Nonce": "secret"}`)
+	sealed, err := sealManifest(plaintext, key.PublicKey())
+	if err != nil {
+		t.Fatalf("sealManifest: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Fatalf("sealed manifest contains the plaintext")
+	}
+	got, err := openManifest(sealed, key)
+	if err != nil {
+		t.Fatalf("openManifest: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatalf("openManifest = %q; want %q", got, plaintext)
+	}
+
+	other, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openManifest(sealed, other); err == nil {
+		t.Fatalf("expected an error with the wrong private key")
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := openManifest(sealed, key); err == nil {
+		t.Fatalf("expected an error with a tampered manifest")
+	}
+	if _, err := openManifest(encryptedManifestMagic, key); err == nil {
+		t.Fatalf("expected an error with a truncated manifest")
+	}
+}
+
+func TestManifestKeys(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "vendor.key")
+	pubPath := filepath.Join(dir, "vendor.pub")
+
+	stdout := os.Stdout
+	pubFile, err := os.Create(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = pubFile
+	err = commandKeygen([]string{keyPath})
+	os.Stdout = stdout
+	pubFile.Close()
+	if err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	if err := commandKeygen([]string{keyPath}); err == nil {
+		t.Fatalf("expected keygen to refuse to overwrite a key")
+	}
+
+	priv, err := readManifestPrivateKey(keyPath)
+	if err != nil {
+		t.Fatalf("readManifestPrivateKey: %v", err)
+	}
+	pub, err := parseManifestPublicKey(pubPath)
+	if err != nil {
+		t.Fatalf("parseManifestPublicKey from file: %v", err)
+	}
+	if !pub.Equal(priv.PublicKey()) {
+		t.Fatalf("public key does not match the private key")
+	}
+	data, _ := os.ReadFile(pubPath)
+	if _, err := parseManifestPublicKey(string(data)); err != nil {
+		t.Fatalf("parseManifestPublicKey from value: %v", err)
+	}
+	if _, err := parseManifestPublicKey("AAAA"); err == nil {
+		t.Fatalf("expected an error for a short key")
+	}
+}
+
+func TestManifestConfig(t *testing.T) {
+	cfg, err := config.Parse("garble.toml", []byte(`
+literals = true
+keep = ["example.com/app.Plugin"]
+
+[[function]]
+package = "example.com/app"
+name = "hot*"
+literals = false
+junk_jumps = 8
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(&buildManifest{Config: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m buildManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	// The build cache keys and the obfuscated names depend on the hash.
+	if !bytes.Equal(m.Config.Hash(), cfg.Hash()) {
+		t.Fatalf("garble.toml settings changed in the manifest: %s", data)
+	}
+}
+
+func TestManifestApplyForceRename(t *testing.T) {
+	defer func(enabled, auto, debug, debugJSON bool) {
+		flagForceRename, flagForceRenameAuto = enabled, auto
+		flagDebug, flagDebugJSON = debug, debugJSON
+		appliedManifest = nil
+	}(flagForceRename, flagForceRenameAuto, flagDebug, flagDebugJSON)
+	// apply may set the build nonce, which this manifest doesn't record.
+	t.Setenv("GARBLE_BUILD_NONCE", os.Getenv("GARBLE_BUILD_NONCE"))
+
+	flagForceRename, flagForceRenameAuto = false, false
+	flagDebug, flagDebugJSON = false, false
+	m := &buildManifest{Flags: []string{"-force-rename=auto", "-debug=json"}}
+	if err := m.apply(); err != nil {
+		t.Fatal(err)
+	}
+	// Reversing and rebuilding read the globals, not the flag values.
+	if !flagForceRename || !flagForceRenameAuto {
+		t.Fatalf("-force-rename=auto from the manifest was not applied")
+	}
+	if !flagDebug || !flagDebugJSON {
+		t.Fatalf("-debug=json from the manifest was not applied")
+	}
+	var buf bytes.Buffer
+	appendFlags(&buf, false)
+	if got := buf.String(); !strings.Contains(got, " -force-rename=auto") || !strings.Contains(got, " -debug=json") {
+		t.Fatalf("toolexec flags lost the manifest flags: %q", got)
+	}
+}
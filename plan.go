@@ -0,0 +1,240 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/AeonDave/garble/internal/ctrlflow"
+)
+
+// commandPlan implements "garble plan".
+func commandPlan(args []string) error {
+	flags, args := splitFlagsFromArgs(args)
+	if hasHelpFlag(flags) {
+		_, _ = fmt.Fprint(os.Stderr, `
+usage: garble [garble flags] plan [-json] [build flags] [packages]
+
+Plan shows how a build of the given packages would be obfuscated,
+without obfuscating or linking anything. For example:
+
+	garble -literals -controlflow=auto plan ./...
+
+For every package in the build, it shows whether the package matches GOGARBLE,
+whether literal obfuscation applies or is disabled by a low-level directive,
+and which control-flow mode applies. Packages which control-flow obfuscation
+would reject as fragile are noted, as are standard library packages
+whose control-flow mode is downgraded to "directives".
+
+The -json flag prints a JSON array with one object per package instead.
+`[1:])
+		return errJustExit(2)
+	}
+
+	jsonOutput := false
+	var rest []string
+	for _, arg := range flags {
+		switch arg {
+		case "-json", "-json=true", "--json":
+			jsonOutput = true
+		case "-json=false", "--json=false":
+			jsonOutput = false
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	flags = rest
+
+	// We don't actually run a main Go command with all flags,
+	// so if the user gave a non-build flag,
+	// we need this check to not silently ignore it.
+	if _, firstUnknown := filterForwardBuildFlags(flags); firstUnknown != "" {
+		// A bit of a hack to get a normal flag.Parse error.
+		return flag.NewFlagSet("", flag.ContinueOnError).Parse([]string{firstUnknown})
+	}
+
+	// Like "garble reverse", we only use toolexecCmd
+	// to ensure that sharedCache.ListedPackages is filled.
+	_, err := toolexecCmd("list", append(flags, args...))
+	defer func() {
+		_ = os.RemoveAll(os.Getenv("GARBLE_SHARED"))
+	}()
+	if err != nil {
+		return err
+	}
+
+	var plan []*packagePlan
+	for _, path := range slices.Sorted(maps.Keys(sharedCache.ListedPackages)) {
+		plan = append(plan, planPackage(sharedCache.ListedPackages[path]))
+	}
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(plan)
+	}
+	return printPlan(os.Stdout, plan)
+}
+
+// packagePlan describes how a single package would be obfuscated.
+type packagePlan struct {
+	ImportPath string
+	Standard   bool `json:",omitempty"`
+	Obfuscate  bool
+
+	// NotObfuscated explains why a package isn't obfuscated.
+	NotObfuscated string `json:",omitempty"`
+
+	Literals bool
+	// LiteralsOptIn is set if any function or file has a //garble:literals directive.
+	LiteralsOptIn bool `json:",omitempty"`
+	// LiteralsSkipped is as per packageReport.LiteralsSkipped.
+	LiteralsSkipped map[string]string `json:",omitempty"`
+
+	ControlFlow string `json:",omitempty"`
+	// ControlFlowDowngraded is the mode which was requested for a standard
+	// library package, before it was downgraded to "directives".
+	ControlFlowDowngraded string `json:",omitempty"`
+
+	// FragileHard and FragileSoft are the reasons given by ctrlflow.FragileReasons.
+	FragileHard string `json:",omitempty"`
+	FragileSoft string `json:",omitempty"`
+
+	// Error is set if the package could not be loaded or analyzed.
+	Error string `json:",omitempty"`
+}
+
+// planPackage works out the plan for one listed package.
+// Obfuscated packages are parsed, typechecked, and built into SSA form,
+// just like transformCompile does, to run the same checks that a build would.
+func planPackage(lpkg *listedPackage) (p *packagePlan) {
+	p = &packagePlan{
+		ImportPath: lpkg.ImportPath,
+		Standard:   lpkg.Standard,
+		Obfuscate:  lpkg.ToObfuscate,
+	}
+	if lpkg.Error != nil {
+		p.Error = lpkg.Error.Err
+	}
+	path := lpkg.ImportPath
+	if lpkg.ForTest != "" {
+		path = lpkg.ForTest
+	}
+	switch {
+	case lpkg.ToObfuscate:
+	case runtimeAndDeps[path] || path == "runtime/cgo":
+		p.NotObfuscated = "runtime dependency"
+		return p
+	case len(lpkg.CompiledGoFiles) == 0:
+		p.NotObfuscated = "no Go files"
+		return p
+	default:
+		p.NotObfuscated = "not matched by GOGARBLE"
+		return p
+	}
+
+	p.Literals = literalsEnabledFor(lpkg)
+	mode := controlFlowModeFor(lpkg)
+	p.ControlFlow = mode.String()
+	if requested := sharedCache.Config.ControlFlowFor(lpkg.ImportPath, flagControlFlowMode); requested != mode && requested.Enabled() {
+		p.ControlFlowDowngraded = requested.String()
+	}
+	if p.Error != "" {
+		return p
+	}
+
+	// parseFiles patches the first main package it sees with reflect code,
+	// which we don't want to leak between packages.
+	reflectPatchFile = ""
+	files, err := parseFiles(lpkg, lpkg.Dir, lpkg.CompiledGoFiles)
+	reflectPatchFile = ""
+	if err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	on, optIn := literalsSettingFor(lpkg, files)
+	p.Literals, p.LiteralsOptIn = on, optIn
+	if on || optIn {
+		p.LiteralsSkipped = literalsSkipped(lpkg, files, on)
+		if len(p.LiteralsSkipped) == 0 {
+			p.LiteralsSkipped = nil
+		}
+	}
+	if !mode.Enabled() {
+		return p
+	}
+	// Like applyControlFlowTransforms, don't let a panic in go/types
+	// or go/ssa stop us from reporting on the remaining packages.
+	defer func() {
+		if r := recover(); r != nil {
+			p.Error = fmt.Sprintf("analysis panic: %v", r)
+		}
+	}()
+	pkg, info, err := typecheck(lpkg.ImportPath, files, importerForPkg(lpkg))
+	if err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	ssaPkg := ssaBuildPkg(pkg, files, info)
+	p.FragileHard, p.FragileSoft = ctrlflow.FragileReasons(fset, ssaPkg, files)
+	return p
+}
+
+// printPlan prints a plan as a table, with one package per line.
+func printPlan(w io.Writer, plan []*packagePlan) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "PACKAGE\tOBFUSCATE\tSTD\tLITERALS\tCONTROLFLOW\tNOTES")
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	for _, p := range plan {
+		literals, controlFlow := "-", "-"
+		var notes []string
+		if p.Obfuscate {
+			switch {
+			case p.Literals:
+				literals = "on"
+			case p.LiteralsOptIn:
+				literals = "directives"
+			default:
+				literals = "off"
+			}
+			if len(p.LiteralsSkipped) > 0 {
+				var skipped []string
+				for _, name := range slices.Sorted(maps.Keys(p.LiteralsSkipped)) {
+					skipped = append(skipped, fmt.Sprintf("%s (%s)", name, p.LiteralsSkipped[name]))
+				}
+				notes = append(notes, "literals skipped in "+strings.Join(skipped, ", "))
+			}
+			controlFlow = p.ControlFlow
+		} else {
+			notes = append(notes, p.NotObfuscated)
+		}
+		if p.ControlFlowDowngraded != "" {
+			notes = append(notes, fmt.Sprintf("controlflow downgraded from %s", p.ControlFlowDowngraded))
+		}
+		if p.FragileHard != "" {
+			notes = append(notes, "controlflow skips package: "+p.FragileHard)
+		}
+		if p.FragileSoft != "" {
+			notes = append(notes, "controlflow skips low-level functions: "+p.FragileSoft)
+		}
+		if p.Error != "" {
+			notes = append(notes, "error: "+strings.ReplaceAll(p.Error, "\n", " "))
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", p.ImportPath,
+			yesNo(p.Obfuscate), yesNo(p.Standard), literals, controlFlow, strings.Join(notes, "; "))
+	}
+	return tw.Flush()
+}
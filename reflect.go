@@ -2,6 +2,7 @@ package main
 
 import (
 	_ "embed"
+	"go/token"
 	"go/types"
 	"maps"
 	"os"
@@ -26,6 +27,11 @@ func abiNamePatch(path string) (string, error) {
 	replace := `return _rn(unsafe.String(n.DataChecked(1+i, "non-empty string"), l))`
 
 	str := strings.Replace(string(data), find, replace, 1)
+	if flagEncryptTags {
+		if str, err = abiTagPatch(str); err != nil {
+			return "", err
+		}
+	}
 
 	originalNames := `
 //go:linkname _rn
@@ -76,6 +82,10 @@ type reflectInspector struct {
 
 	propagatedInstr map[ssa.Instruction]bool
 
+	// lookupOnly holds the positions of the reflect.ValueOf and reflect.TypeOf
+	// calls which are only used for reflect lookups; see reflectLookups.
+	lookupOnly map[token.Pos]bool
+
 	result pkgCache
 }
 
@@ -155,6 +165,17 @@ func (ri *reflectInspector) ignoreReflectedTypes(ssaPkg *ssa.Package) {
 	}
 }
 
+// recordLookups records the types of the fields found by reflect lookups
+// as used for reflection, since the found values may be reflected further.
+// The type declaring the looked up members does not need to be recorded.
+func (ri *reflectInspector) recordLookups(lookups []reflectLookup) {
+	for _, lookup := range lookups {
+		if field, ok := lookup.member.(*types.Var); ok {
+			ri.recursivelyRecordUsedForReflect(field.Type())
+		}
+	}
+}
+
 // Exported methods with unnamed structs as paramters may be "used" in interface declarations
 // elsewhere, these interfaces will break if any method uses reflection on the same parameter.
 //
@@ -256,6 +277,9 @@ func (ri *reflectInspector) checkFunction(fun *ssa.Function) {
 					ri.propagatedInstr[inst] = true
 				}
 			case *ssa.Call:
+				if ri.lookupOnly[inst.Pos()] {
+					continue // the lookups are rewritten; see rewriteReflectLookups
+				}
 				callName := inst.Call.Value.String()
 				if m := inst.Call.Method; m != nil {
 					callName = inst.Call.Method.FullName()
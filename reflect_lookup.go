@@ -0,0 +1,379 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"log"
+	"strconv"
+
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// reflectLookup is a call like reflect.ValueOf(x).FieldByName("ID")
+// or t.MethodByName("Close"), whose name argument is a constant
+// and whose receiver describes a Go type known at compile time.
+//
+// Since reflection sees the obfuscated names, rewriteReflectLookups
+// replaces the constant with the obfuscated name of the member.
+type reflectLookup struct {
+	call   *ast.CallExpr
+	member types.Object  // the field or method being looked up
+	strct  *types.Struct // the struct declaring the field, if member is one
+}
+
+// reflectLookups finds the reflect lookups in a package's files. It also
+// returns the positions of the reflect.ValueOf and reflect.TypeOf calls whose
+// results are only used for lookups, which reflectInspector can then ignore,
+// as the lookups keep working when the looked up type is obfuscated.
+//
+// Both reflectInspector and the transformer call this function,
+// so that they always agree on which lookups get rewritten.
+func reflectLookups(pkg *types.Package, files []*ast.File, info *types.Info) (lookups []reflectLookup, lookupOnly map[token.Pos]bool) {
+	f := lookupFinder{
+		pkg:          pkg,
+		info:         info,
+		vars:         make(map[*types.Var]ast.Expr),
+		reassigned:   make(map[*types.Var]bool),
+		uses:         make(map[*types.Var]int),
+		lookupUses:   make(map[*types.Var]int),
+		lookupRoots:  make(map[*ast.CallExpr]bool),
+		varRoots:     make(map[*types.Var]*ast.CallExpr),
+		lookupOnlyAt: make(map[token.Pos]bool),
+	}
+	for _, file := range files {
+		f.collectVars(file)
+	}
+	for _, file := range files {
+		for node := range ast.Preorder(file) {
+			call, ok := node.(*ast.CallExpr)
+			if !ok {
+				continue
+			}
+			if lookup, ok := f.lookup(call); ok {
+				lookups = append(lookups, lookup)
+			}
+		}
+	}
+	for root := range f.lookupRoots {
+		f.lookupOnlyAt[root.Lparen] = true
+	}
+	for v, root := range f.varRoots {
+		if f.uses[v] > 0 && f.uses[v] == f.lookupUses[v] {
+			f.lookupOnlyAt[root.Lparen] = true
+		}
+	}
+	return lookups, f.lookupOnlyAt
+}
+
+type lookupFinder struct {
+	pkg  *types.Package
+	info *types.Info
+
+	// vars holds the initial value of the local variables which are
+	// declared with a single value, like "v := reflect.ValueOf(x)".
+	// Package-level variables may be used by other packages, so we skip them.
+	vars       map[*types.Var]ast.Expr
+	reassigned map[*types.Var]bool
+
+	// uses and lookupUses count all uses of a variable in vars,
+	// and the uses which are the receiver of a reflect lookup.
+	uses       map[*types.Var]int
+	lookupUses map[*types.Var]int
+
+	// lookupRoots holds the reflect.ValueOf and reflect.TypeOf calls
+	// which are directly the receiver of a reflect lookup, and varRoots holds
+	// the calls which are the initial value of a variable in vars.
+	lookupRoots  map[*ast.CallExpr]bool
+	varRoots     map[*types.Var]*ast.CallExpr
+	lookupOnlyAt map[token.Pos]bool
+}
+
+func (f *lookupFinder) collectVars(file *ast.File) {
+	define := func(name *ast.Ident, value ast.Expr) {
+		if v, ok := f.info.Defs[name].(*types.Var); ok && v.Parent() != f.pkg.Scope() {
+			f.vars[v] = value
+		}
+	}
+	reassign := func(expr ast.Expr) {
+		if ident, ok := ast.Unparen(expr).(*ast.Ident); ok {
+			if v, ok := f.info.Uses[ident].(*types.Var); ok {
+				f.reassigned[v] = true
+			}
+		}
+	}
+	for node := range ast.Preorder(file) {
+		switch node := node.(type) {
+		case *ast.AssignStmt:
+			if node.Tok == token.DEFINE && len(node.Lhs) == len(node.Rhs) {
+				for i, lhs := range node.Lhs {
+					if ident, ok := lhs.(*ast.Ident); ok {
+						define(ident, node.Rhs[i])
+					}
+				}
+			}
+			for _, lhs := range node.Lhs {
+				reassign(lhs)
+			}
+		case *ast.ValueSpec:
+			if len(node.Names) == len(node.Values) {
+				for i, name := range node.Names {
+					define(name, node.Values[i])
+				}
+			}
+		case *ast.RangeStmt:
+			reassign(node.Key)
+			reassign(node.Value)
+		case *ast.IncDecStmt:
+			reassign(node.X)
+		case *ast.UnaryExpr:
+			if node.Op == token.AND {
+				reassign(node.X)
+			}
+		case *ast.Ident:
+			if v, ok := f.info.Uses[node].(*types.Var); ok {
+				f.uses[v]++
+			}
+		}
+	}
+}
+
+// lookup reports whether call is a reflect lookup.
+func (f *lookupFinder) lookup(call *ast.CallExpr) (reflectLookup, bool) {
+	fn, _ := typeutil.Callee(f.info, call).(*types.Func)
+	if fn == nil || fn.Pkg() == nil || fn.Pkg().Path() != "reflect" || len(call.Args) != 1 {
+		return reflectLookup{}, false
+	}
+	isField := false
+	switch fn.Name() {
+	case "FieldByName":
+		isField = true
+	case "MethodByName":
+	default:
+		return reflectLookup{}, false
+	}
+	tv := f.info.Types[call.Args[0]]
+	if tv.Value == nil || tv.Value.Kind() != constant.String || !f.rewritable(call.Args[0]) {
+		return reflectLookup{}, false
+	}
+	name := constant.StringVal(tv.Value)
+	sel := call.Fun.(*ast.SelectorExpr) // since fn is a method
+	typ, root, rootVar := f.describedType(sel.X)
+	if typ == nil {
+		return reflectLookup{}, false
+	}
+
+	lookup := reflectLookup{call: call}
+	if isField {
+		if _, ok := typ.Underlying().(*types.Struct); !ok {
+			return reflectLookup{}, false // FieldByName panics on other kinds
+		}
+		obj, index, _ := types.LookupFieldOrMethod(typ, false, fieldLookupPkg(typ), name)
+		field, ok := obj.(*types.Var)
+		if !ok || !field.IsField() || field.Origin() != field {
+			return reflectLookup{}, false // not a field, or of a generic type
+		}
+		lookup.member = field
+		lookup.strct = declaringStruct(typ, index)
+		if lookup.strct == nil {
+			return reflectLookup{}, false
+		}
+	} else {
+		if !token.IsExported(name) {
+			return reflectLookup{}, false // never found by MethodByName
+		}
+		method, ok := types.NewMethodSet(typ).Lookup(nil, name).Obj().(*types.Func)
+		if !ok {
+			return reflectLookup{}, false
+		}
+		lookup.member = method
+	}
+	if root != nil {
+		f.lookupRoots[root] = true
+	}
+	if rootVar != nil {
+		f.lookupUses[rootVar]++
+	}
+	return lookup, true
+}
+
+// rewritable reports whether a constant name argument can be replaced.
+// We only do so for literals and constants declared in the same package,
+// as replacing a qualified constant could leave its import unused.
+func (f *lookupFinder) rewritable(expr ast.Expr) bool {
+	switch expr := ast.Unparen(expr).(type) {
+	case *ast.BasicLit:
+		return true
+	case *ast.Ident:
+		obj, ok := f.info.Uses[expr].(*types.Const)
+		return ok && obj.Pkg() == f.pkg
+	}
+	return false
+}
+
+// describedType returns the Go type which a reflect.Value or reflect.Type
+// expression describes, or nil if it is not known at compile time.
+// It also returns the reflect.ValueOf or reflect.TypeOf call
+// or the variable which the expression starts from, if any.
+func (f *lookupFinder) describedType(expr ast.Expr) (_ types.Type, root *ast.CallExpr, rootVar *types.Var) {
+	switch expr := ast.Unparen(expr).(type) {
+	case *ast.Ident:
+		v, ok := f.info.Uses[expr].(*types.Var)
+		if !ok || f.reassigned[v] || f.vars[v] == nil {
+			return nil, nil, nil
+		}
+		typ, root, _ := f.describedType(f.vars[v])
+		if typ == nil {
+			return nil, nil, nil
+		}
+		if root != nil {
+			f.varRoots[v] = root
+		}
+		return typ, nil, v
+	case *ast.CallExpr:
+		fn, _ := typeutil.Callee(f.info, expr).(*types.Func)
+		if fn == nil || fn.Pkg() == nil || fn.Pkg().Path() != "reflect" {
+			return nil, nil, nil
+		}
+		switch fn.Name() {
+		case "ValueOf", "TypeOf":
+			if fn.Signature().Recv() != nil || len(expr.Args) != 1 {
+				return nil, nil, nil
+			}
+			typ := f.info.TypeOf(expr.Args[0])
+			if typ == nil || types.IsInterface(typ) {
+				return nil, nil, nil // only known at run time
+			}
+			return typ, expr, nil
+		case "TypeFor":
+			inst, ok := f.info.Instances[typeForIdent(expr.Fun)]
+			if !ok || inst.TypeArgs.Len() != 1 || types.IsInterface(inst.TypeArgs.At(0)) {
+				return nil, nil, nil
+			}
+			return inst.TypeArgs.At(0), nil, nil
+		case "Indirect", "Elem":
+			var inner ast.Expr
+			if fn.Name() == "Indirect" && fn.Signature().Recv() == nil && len(expr.Args) == 1 {
+				inner = expr.Args[0]
+			} else if fn.Name() == "Elem" && fn.Signature().Recv() != nil {
+				inner = expr.Fun.(*ast.SelectorExpr).X
+			} else {
+				return nil, nil, nil
+			}
+			typ, root, rootVar := f.describedType(inner)
+			if typ == nil {
+				return nil, nil, nil
+			}
+			ptr, ok := typ.Underlying().(*types.Pointer)
+			if !ok {
+				return nil, nil, nil
+			}
+			return ptr.Elem(), root, rootVar
+		}
+	}
+	return nil, nil, nil
+}
+
+func typeForIdent(fun ast.Expr) *ast.Ident {
+	if index, ok := fun.(*ast.IndexExpr); ok {
+		fun = index.X
+	}
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		return fun
+	case *ast.SelectorExpr:
+		return fun.Sel
+	}
+	return nil
+}
+
+// fieldLookupPkg returns the package to look up unexported fields in,
+// since reflect finds them by name regardless of the package.
+func fieldLookupPkg(typ types.Type) *types.Package {
+	if tname := namedTypeOf(typ); tname != nil {
+		return tname.Pkg()
+	}
+	return nil
+}
+
+func namedTypeOf(typ types.Type) *types.TypeName {
+	if named, ok := types.Unalias(typ).(*types.Named); ok {
+		return named.Obj()
+	}
+	return nil
+}
+
+// declaringStruct follows the index path given by types.LookupFieldOrMethod,
+// returning the struct type which declares the field.
+func declaringStruct(typ types.Type, index []int) *types.Struct {
+	var strct *types.Struct
+	for _, i := range index {
+		if ptr, ok := typ.Underlying().(*types.Pointer); ok {
+			typ = ptr.Elem()
+		}
+		s, ok := typ.Underlying().(*types.Struct)
+		if !ok || i >= s.NumFields() {
+			return nil
+		}
+		strct = s
+		typ = s.Field(i).Type()
+	}
+	return strct
+}
+
+// reflectLookupName returns the obfuscated name of the member which
+// a reflect lookup finds, following the same rules as transformGoFile.
+// It returns false if the name is not obfuscated.
+func (tf *transformer) reflectLookupName(lookup reflectLookup) (string, bool) {
+	member := lookup.member
+	lpkg, err := listPackage(tf.curPkg, member.Pkg().Path())
+	if err != nil || !lpkg.ToObfuscate {
+		return "", false
+	}
+	switch member := member.(type) {
+	case *types.Var:
+		if member.Embedded() {
+			// Embedded fields are named after their type; leave them be.
+			return "", false
+		}
+		if tf.curPkgCache.KeptNames[fieldKeepKey(lookup.strct, member.Name())] {
+			return "", false
+		}
+		return hashWithStruct(lookup.strct, member), true
+	case *types.Func:
+		if tf.isKept(member) || !tf.renamesExportedMethod(member) {
+			return "", false
+		}
+		return hashMethodGlobal(member.Name()), true
+	}
+	return "", false
+}
+
+// rewriteReflectLookups replaces the constant names in the reflect lookups
+// within file with the names that the looked up members are obfuscated to.
+// It runs before literal obfuscation, so that the new names are obfuscated too.
+func (tf *transformer) rewriteReflectLookups(file *ast.File) {
+	for _, lookup := range tf.reflectLookups {
+		call := lookup.call
+		if call.Pos() < file.FileStart || call.Pos() > file.FileEnd {
+			continue
+		}
+		newName, ok := tf.reflectLookupName(lookup)
+		if !ok {
+			continue
+		}
+		arg := call.Args[0]
+		tv := tf.info.Types[arg]
+		tv.Value = constant.MakeString(newName)
+		lit := &ast.BasicLit{ValuePos: arg.Pos(), Kind: token.STRING, Value: strconv.Quote(newName)}
+		tf.info.Types[lit] = tv
+		call.Args[0] = lit
+		if flagDebug { // TODO(mvdan): remove once https://go.dev/issue/53465 if fixed
+			log.Printf("reflect lookup of %q rewritten to %q", lookup.member.Name(), newName)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/types"
+	"slices"
+	"testing"
+)
+
+func TestReflectLookups(t *testing.T) {
+	src := `package p
+
+import "reflect"
+
+type Config struct {
+	Token string
+	Inner
+}
+
+type Inner struct{ ID int }
+
+func (Config) Close() {}
+
+const tokenName = "Token"
+
+func direct(c Config) {
+	reflect.ValueOf(c).FieldByName(tokenName)
+	reflect.ValueOf(&c).Elem().FieldByName("ID")
+	reflect.TypeFor[Config]().MethodByName("Close")
+}
+
+func viaVar(c *Config) {
+	v := reflect.ValueOf(c)
+	v.MethodByName("Close")
+	v.Elem().FieldByName("Token")
+}
+
+func usedOtherwise(c Config) reflect.Type {
+	t := reflect.TypeOf(c)
+	t.FieldByName("Token")
+	return t
+}
+
+func unknown(x any, name string) {
+	reflect.ValueOf(x).FieldByName("Token")
+	reflect.ValueOf(Config{}).FieldByName(name)
+	reflect.ValueOf(Config{}).FieldByName("Missing")
+	reflect.ValueOf(Config{}).MethodByName("close")
+
+	v := reflect.ValueOf(Config{})
+	v = reflect.ValueOf(Inner{})
+	v.FieldByName("ID")
+}
+`
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Instances: make(map[*ast.Ident]types.Instance),
+	}
+	pkg, err := (&types.Config{Importer: importer.Default()}).Check("test/p", fset, []*ast.File{file}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookups, lookupOnly := reflectLookups(pkg, []*ast.File{file}, info)
+
+	var got []string
+	for _, lookup := range lookups {
+		fn := enclosingFunc(file, lookup.call)
+		name := lookup.member.Name()
+		if lookup.strct != nil {
+			name = "field " + name
+		}
+		got = append(got, fn+": "+name)
+	}
+	want := []string{
+		"direct: field Token",
+		"direct: field ID",
+		"direct: Close",
+		"viaVar: Close",
+		"viaVar: field Token",
+		"usedOtherwise: field Token",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("reflectLookups:\ngot  %q\nwant %q", got, want)
+	}
+
+	// The ValueOf calls in direct and viaVar are only used for lookups,
+	// but not the TypeOf call in usedOtherwise, nor any in unknown.
+	var gotOnly []string
+	for node := range ast.Preorder(file) {
+		if call, ok := node.(*ast.CallExpr); ok && lookupOnly[call.Lparen] {
+			gotOnly = append(gotOnly, enclosingFunc(file, call))
+		}
+	}
+	if want := []string{"direct", "direct", "viaVar"}; !slices.Equal(gotOnly, want) {
+		t.Errorf("reflectLookups lookupOnly in %q, want %q", gotOnly, want)
+	}
+}
+
+func enclosingFunc(file *ast.File, node ast.Node) string {
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Pos() <= node.Pos() && node.End() <= fn.End() {
+			return fn.Name.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// exportAnalysis finds the exported top-level names in obfuscated packages
+// which are only ever used from their own package, as part of analyzeProgram.
+// Since the compiler only enforces the export rules across packages,
+// such names can be obfuscated like unexported ones; see unexportName.
+//
+// All keys are as per resaltKey.
+type exportAnalysis struct {
+	candidates map[string]bool // exported top-level names in obfuscated packages
+	referenced map[string]bool // names which must stay exported
+
+	// imported records the packages imported by a package which is not
+	// obfuscated, as well as cgo packages, so none of their names can be renamed.
+	imported map[string]bool
+	// asmNames records all names which any assembly file may refer to.
+	asmNames map[string]bool
+}
+
+func newExportAnalysis() *exportAnalysis {
+	return &exportAnalysis{
+		candidates: make(map[string]bool),
+		referenced: make(map[string]bool),
+		imported:   make(map[string]bool),
+		asmNames:   make(map[string]bool),
+	}
+}
+
+// addObfuscated records the candidates and references in an obfuscated package.
+// Names which reflection sees or which are kept are never candidates.
+func (e *exportAnalysis) addObfuscated(lpkg *listedPackage, pkg *types.Package, files []*ast.File, info *types.Info, cached pkgCache) {
+	// cgo code may call any //export function by name;
+	// the comments are gone by the time we see the generated files.
+	if slices.Contains(lpkg.Imports, "C") {
+		e.imported[lpkg.ImportPath] = true
+	}
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		if !scope.Lookup(name).Exported() {
+			continue
+		}
+		key := resaltKey(lpkg.ImportPath, name)
+		if _, ok := cached.ReflectObjectNames[hashWithPackage(lpkg, name)]; ok {
+			continue
+		}
+		if cached.KeptNames[key] {
+			continue
+		}
+		e.candidates[key] = true
+	}
+
+	// Marking fields and methods as well is harmless, as they are never candidates.
+	for _, obj := range info.Uses {
+		if obj.Pkg() != nil && obj.Pkg() != pkg {
+			e.referenced[resaltKey(obj.Pkg().Path(), obj.Name())] = true
+		}
+	}
+	for _, file := range files {
+		for node := range ast.Preorder(file) {
+			strct, ok := node.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			// An embedded type's name is also the name of a field,
+			// which other packages may select or see via reflection.
+			for _, field := range strct.Fields.List {
+				if len(field.Names) > 0 {
+					continue
+				}
+				if ident := embeddedTypeIdent(field.Type); ident != nil {
+					if obj := info.Uses[ident]; obj != nil && obj.Pkg() != nil {
+						e.referenced[resaltKey(obj.Pkg().Path(), obj.Name())] = true
+					}
+				}
+			}
+		}
+	}
+	e.addLinknames(lpkg, files)
+}
+
+// addExternal records the references from a package which is not obfuscated.
+// We do not type-check such packages, so we conservatively treat all of
+// the names in the packages they import as referenced.
+func (e *exportAnalysis) addExternal(lpkg *listedPackage, files []*ast.File) {
+	for _, imp := range lpkg.Imports {
+		e.imported[imp] = true
+	}
+	e.addLinknames(lpkg, files)
+}
+
+// addLinknames records the local and remote names in //go:linkname directives.
+func (e *exportAnalysis) addLinknames(lpkg *listedPackage, files []*ast.File) {
+	for _, file := range files {
+		for _, group := range file.Comments {
+			for _, comment := range group.List {
+				fields := strings.Fields(comment.Text)
+				if len(fields) < 2 || fields[0] != "//go:linkname" {
+					continue
+				}
+				e.referenced[resaltKey(lpkg.ImportPath, fields[1])] = true
+				if len(fields) < 3 {
+					continue
+				}
+				// The remote name is like "path/to/pkg.Name" or "path/to/pkg.Type.Method".
+				target := fields[2]
+				slash := strings.LastIndexByte(target, '/')
+				dot := strings.IndexByte(target[slash+1:], '.')
+				if dot < 0 {
+					continue
+				}
+				path, name := target[:slash+1+dot], target[slash+1+dot+1:]
+				name, _, _ = strings.Cut(name, ".")
+				e.referenced[resaltKey(path, name)] = true
+			}
+		}
+	}
+}
+
+// asmNameRx matches the names referenced in Go assembly,
+// which follow a middle dot, like "·Name" or "path∕to∕pkg·Name".
+var asmNameRx = regexp.MustCompile(`·([\pL_][\pL\pN_]*)`)
+
+// addAsm records the names which a package's assembly files may refer to.
+// Since resolving the packages is not worth the effort, we only keep the names.
+func (e *exportAnalysis) addAsm(lpkg *listedPackage) error {
+	for _, name := range lpkg.SFiles {
+		data, err := os.ReadFile(filepath.Join(lpkg.Dir, name))
+		if err != nil {
+			return err
+		}
+		for _, match := range asmNameRx.FindAllSubmatch(data, -1) {
+			e.asmNames[string(match[1])] = true
+		}
+	}
+	return nil
+}
+
+// result returns the candidates which are never referenced from elsewhere.
+func (e *exportAnalysis) result() map[string]bool {
+	renamed := make(map[string]bool)
+	for key := range e.candidates {
+		path, name := splitMethodKey(key)
+		if !e.referenced[key] && !e.imported[path] && !e.asmNames[name] {
+			renamed[key] = true
+		}
+	}
+	return renamed
+}
+
+// embeddedTypeIdent returns the identifier naming an embedded field's type,
+// such as "T" in "*pkg.T[int]".
+func embeddedTypeIdent(expr ast.Expr) *ast.Ident {
+	for {
+		switch x := expr.(type) {
+		case *ast.Ident:
+			return x
+		case *ast.StarExpr:
+			expr = x.X
+		case *ast.SelectorExpr:
+			expr = x.Sel
+		case *ast.IndexExpr:
+			expr = x.X
+		case *ast.IndexListExpr:
+			expr = x.X
+		default:
+			return nil
+		}
+	}
+}
+
+// unexportName turns an obfuscated name into an unexported one,
+// for the names in sharedCache.RenamedExports.
+func unexportName(name string) string {
+	if isUpper(name[0]) {
+		return string(toLower(name[0])) + name[1:]
+	}
+	return name
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"maps"
+	"slices"
+	"testing"
+)
+
+type mapImporter map[string]*types.Package
+
+func (m mapImporter) Import(path string) (*types.Package, error) { return m[path], nil }
+
+func TestExportAnalysis(t *testing.T) {
+	sources := []struct{ path, src string }{
+		{"test/p", `package p
+
+import _ "unsafe"
+
+func Internal() int { return Used + Embedded{}.N }
+
+var Used = 1
+
+type Embedded struct{ N int }
+
+type Outer struct{ Embedded }
+
+func AsmFunc()
+
+//go:linkname Linked test/q.remote
+func Linked()
+
+type Kept int
+
+const Reflected = 2
+
+func unexported() {}
+`},
+		{"test/q", `package q
+
+import "test/p"
+
+var _ = p.Used
+
+func remote() {}
+
+func Exported() {}
+`},
+	}
+	origShared := sharedCache
+	sharedCache = &sharedCacheType{}
+	defer func() { sharedCache = origShared }()
+
+	e := newExportAnalysis()
+	imported := mapImporter{"unsafe": types.Unsafe}
+	for _, source := range sources {
+		file, err := parser.ParseFile(fset, source.path+".go", source.src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info := &types.Info{
+			Defs: make(map[*ast.Ident]types.Object),
+			Uses: make(map[*ast.Ident]types.Object),
+		}
+		pkg, err := (&types.Config{Importer: imported}).Check(source.path, fset, []*ast.File{file}, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		imported[source.path] = pkg
+
+		lpkg := &listedPackage{ImportPath: source.path, GarbleActionID: [32]byte{1}}
+		cached := pkgCache{
+			ReflectObjectNames: map[objectString]string{
+				hashWithPackage(lpkg, "Reflected"): "Reflected",
+			},
+			KeptNames: map[string]bool{"test/p.Kept": true},
+		}
+		e.addObfuscated(lpkg, pkg, []*ast.File{file}, info, cached)
+	}
+	e.asmNames["AsmFunc"] = true
+
+	got := slices.Sorted(maps.Keys(e.result()))
+	want := []string{"test/p.Internal", "test/p.Outer", "test/q.Exported"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("exportAnalysis.result:\ngot  %q\nwant %q", got, want)
+	}
+
+	// A package which is not obfuscated may use any name in its imports.
+	e.addExternal(&listedPackage{ImportPath: "test/r", Imports: []string{"test/q"}}, nil)
+	got = slices.Sorted(maps.Keys(e.result()))
+	want = []string{"test/p.Internal", "test/p.Outer"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("exportAnalysis.result with external importer:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestUnexportName(t *testing.T) {
+	for name, want := range map[string]string{
+		"Abc": "abc",
+		"abc": "abc",
+		"Zq_": "zq_",
+		"_Ab": "_Ab",
+	} {
+		if got := unexportName(name); got != want {
+			t.Errorf("unexportName(%q) = %q; want %q", name, got, want)
+		}
+	}
+}
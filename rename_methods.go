@@ -0,0 +1,380 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"maps"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// methodKey returns a string which identifies a method in every garble process,
+// such as "pkg/path.Type.Method" for a method declared on a named type.
+//
+// Methods declared in interface literals, or on types local to a function,
+// are keyed like "*.Method". This joins all of them into a single method for
+// the sake of analyzeProgram, which is simple and errs on the safe side.
+func methodKey(fn *types.Func) string {
+	fn = fn.Origin()
+	recv := types.Unalias(fn.Signature().Recv().Type())
+	if ptr, ok := recv.(*types.Pointer); ok {
+		recv = types.Unalias(ptr.Elem())
+	}
+	if named, ok := recv.(*types.Named); ok {
+		tname := named.Origin().Obj()
+		if pkg := tname.Pkg(); pkg != nil && tname.Parent() == pkg.Scope() {
+			return pkg.Path() + "." + tname.Name() + "." + fn.Name()
+		}
+	}
+	return "*." + fn.Name()
+}
+
+// analyzeProgram implements -force-rename=auto by filling
+// sharedCache.RenamedMethods with the exported methods which can be renamed
+// without breaking the program, and sharedCache.RenamedExports as per
+// exportAnalysis.
+//
+// Renaming a method is only safe if every method it may have to match
+// at run time is renamed in the same way. We build a graph of all exported
+// methods in the obfuscated packages, joining each interface method with
+// the methods of every type which may implement the interface.
+// Since hashMethodGlobal only depends on the method name, renaming every
+// method in a connected component keeps them matching.
+// A component must keep its names if any of its methods:
+//
+//   - is declared in a package which is not obfuscated,
+//   - shares its name with a method or interface method in such a package,
+//   - belongs to a type which is used with reflection, or
+//   - is kept via //garble:keep or garble.toml.
+//
+// Types are considered to implement an interface if they have methods with
+// the same names, ignoring signatures, which may only join more methods.
+// Since only an executable build sees every package which uses a name,
+// other builds leave all exported names alone, like the default.
+// Test binaries also use exported names from the generated test main package,
+// which we cannot see, so their exported top-level names are left alone too.
+func analyzeProgram(command string, flags []string) error {
+	if !buildsExecutable(command, flags) {
+		log.Printf("-force-rename=auto: not building an executable; exported names are not renamed")
+		return nil
+	}
+	startTime := time.Now()
+	g := methodGraph{
+		parent:      make(map[string]string),
+		obfuscated:  make(map[string]bool),
+		implementer: make(map[string][]map[string]string),
+	}
+	var (
+		interfaces    []map[string]string
+		roots         []string
+		externalNames = make(map[string]bool)
+		keptNames     = make(map[string]bool)
+		pkgCaches     = make(map[*listedPackage]pkgCache)
+		exports       = newExportAnalysis()
+	)
+	for _, path := range slices.Sorted(maps.Keys(sharedCache.ListedPackages)) {
+		lpkg := sharedCache.ListedPackages[path]
+		if err := exports.addAsm(lpkg); err != nil {
+			return err
+		}
+		if len(lpkg.CompiledGoFiles) == 0 {
+			continue
+		}
+		if !lpkg.ToObfuscate {
+			files, err := parseExternalFiles(lpkg)
+			if err != nil {
+				return err
+			}
+			addExternalMethodNames(files, externalNames)
+			exports.addExternal(lpkg, files)
+			continue
+		}
+
+		// parseFiles patches the first main package it sees with reflect code,
+		// which we don't want to leak between packages.
+		reflectPatchFile = ""
+		files, err := parseFiles(lpkg, lpkg.Dir, lpkg.CompiledGoFiles)
+		reflectPatchFile = ""
+		if err != nil {
+			return err
+		}
+		pkg, info, err := typecheck(lpkg.ImportPath, files, importerForPkg(lpkg))
+		if err != nil {
+			return fmt.Errorf("-force-rename=auto: %v", err)
+		}
+		// The package cache tells us which types are used with reflection.
+		cached, err := loadPkgCache(lpkg, pkg, files, info, nil)
+		if err != nil {
+			return err
+		}
+		pkgCaches[lpkg] = cached
+		maps.Copy(keptNames, cached.KeptNames)
+		exports.addObfuscated(lpkg, pkg, files, info, cached)
+
+		for ident, obj := range info.Defs {
+			tname, ok := obj.(*types.TypeName)
+			if !ok || tname.IsAlias() || ident.Name == "_" {
+				continue
+			}
+			typ := tname.Type()
+			if _, ok := typ.(*types.TypeParam); ok {
+				continue // covered by its constraint
+			}
+			_, isIface := typ.Underlying().(*types.Interface)
+			if !isIface {
+				typ = types.NewPointer(typ)
+			}
+			methods := g.addType(typ)
+			if isIface {
+				interfaces = append(interfaces, methods)
+			}
+			if tname.Parent() == pkg.Scope() {
+				if _, ok := cached.ReflectObjectNames[hashWithPackage(lpkg, tname.Name())]; ok {
+					roots = slices.AppendSeq(roots, maps.Values(methods))
+				}
+			}
+		}
+		for _, tv := range info.Types {
+			if iface, ok := tv.Type.(*types.Interface); ok && iface.NumMethods() > 0 {
+				interfaces = append(interfaces, g.addType(iface))
+			}
+		}
+	}
+
+	for key := range g.parent {
+		_, name := splitMethodKey(key)
+		if externalNames[name] || !g.obfuscated[key] || keptNames[methodKeptKey(key)] {
+			roots = append(roots, key)
+		}
+	}
+	for _, iface := range interfaces {
+		g.joinImplementers(iface)
+	}
+
+	keptRoots := make(map[string]bool)
+	for _, key := range roots {
+		keptRoots[g.find(key)] = true
+	}
+	renamed := make(map[string]bool)
+	for key := range g.parent {
+		if g.obfuscated[key] && !keptRoots[g.find(key)] {
+			renamed[key] = true
+		}
+	}
+	sharedCache.RenamedMethods = renamed
+	if command != "test" {
+		sharedCache.RenamedExports = exports.result()
+	}
+	log.Printf("-force-rename=auto: renaming %d of %d exported methods and %d of %d exported names in %s",
+		len(renamed), len(g.parent), len(sharedCache.RenamedExports), len(exports.candidates), debugSince(startTime))
+
+	// Which names are renamed in a package depends on the whole program,
+	// so the result must be part of every package's action ID.
+	resetGarbleActionIDs()
+	// The package caches do not depend on the renamed methods,
+	// so store them under the new action IDs for the compiler to reuse.
+	fsCache, err := openCache()
+	if err != nil {
+		return err
+	}
+	for lpkg, cached := range pkgCaches {
+		if err := putPkgCache(fsCache, lpkg.GarbleActionID, cached); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildsExecutable reports whether a build links an executable
+// which includes every package that the build obfuscates.
+func buildsExecutable(command string, flags []string) bool {
+	switch flagValue(flags, "-buildmode") {
+	case "", "default", "exe", "pie":
+	default:
+		return false
+	}
+	switch command {
+	case "test":
+		return true
+	case "build", "install", "run":
+		for _, lpkg := range sharedCache.ListedPackages {
+			if lpkg.Name == "main" && !lpkg.DepOnly {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resetGarbleActionIDs recomputes the action IDs of all listed packages,
+// after a whole-program analysis has changed buildFlagHashInput.
+func resetGarbleActionIDs() {
+	sharedCache.BuildFlagHashInput = nil
+	for _, lpkg := range sharedCache.ListedPackages {
+		if lpkg.BuildID != "" {
+			lpkg.GarbleActionID = addGarbleToHash(decodeBuildIDHash(splitActionID(lpkg.BuildID)))
+		}
+	}
+}
+
+// parseExternalFiles parses the Go files of a package which is not obfuscated,
+// with comments, but without the patches that parseFiles may apply.
+func parseExternalFiles(lpkg *listedPackage) ([]*ast.File, error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range lpkg.CompiledGoFiles {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(lpkg.Dir, name)
+		}
+		file, err := parser.ParseFile(fset, name, nil, parser.SkipObjectResolution|parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// addExternalMethodNames adds the names of the exported methods and interface
+// methods declared in a package which is not obfuscated.
+// We look at the syntax, as export data omits interfaces inside functions,
+// like the ones which errors.Is uses to call Is and Unwrap methods.
+func addExternalMethodNames(files []*ast.File, names map[string]bool) {
+	for _, file := range files {
+		for node := range ast.Preorder(file) {
+			switch node := node.(type) {
+			case *ast.FuncDecl:
+				if node.Recv != nil && node.Name.IsExported() {
+					names[node.Name.Name] = true
+				}
+			case *ast.InterfaceType:
+				for _, field := range node.Methods.List {
+					for _, name := range field.Names {
+						if name.IsExported() {
+							names[name.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// methodGraph is a union-find of methods, keyed as per methodKey.
+type methodGraph struct {
+	parent     map[string]string
+	obfuscated map[string]bool // whether a method's package is obfuscated
+
+	// implementer indexes the method sets added via addType
+	// by each of their method names.
+	implementer map[string][]map[string]string
+}
+
+// addType records the exported methods in the method set of typ,
+// returning them as a map from method names to their keys.
+func (g *methodGraph) addType(typ types.Type) map[string]string {
+	methods := make(map[string]string)
+	mset := types.NewMethodSet(typ)
+	for sel := range mset.Methods() {
+		fn, ok := sel.Obj().(*types.Func)
+		if !ok || !fn.Exported() {
+			continue
+		}
+		key := methodKey(fn)
+		methods[fn.Name()] = key
+		if _, ok := g.parent[key]; !ok {
+			g.parent[key] = key
+			lpkg := sharedCache.ListedPackages[fn.Pkg().Path()]
+			g.obfuscated[key] = lpkg != nil && lpkg.ToObfuscate
+		}
+	}
+	for name := range methods {
+		g.implementer[name] = append(g.implementer[name], methods)
+	}
+	return methods
+}
+
+func (g *methodGraph) find(key string) string {
+	for g.parent[key] != key {
+		g.parent[key] = g.parent[g.parent[key]]
+		key = g.parent[key]
+	}
+	return key
+}
+
+func (g *methodGraph) union(a, b string) {
+	if a, b = g.find(a), g.find(b); a != b {
+		g.parent[a] = b
+	}
+}
+
+// joinImplementers joins the methods of an interface with the methods of the
+// same name in all method sets which have every method in the interface.
+func (g *methodGraph) joinImplementers(iface map[string]string) {
+	if len(iface) == 0 {
+		return
+	}
+	// Only check the method sets which have the least common method name.
+	rarest := ""
+	for name := range iface {
+		if rarest == "" || len(g.implementer[name]) < len(g.implementer[rarest]) {
+			rarest = name
+		}
+	}
+candidates:
+	for _, methods := range g.implementer[rarest] {
+		for name := range iface {
+			if _, ok := methods[name]; !ok {
+				continue candidates
+			}
+		}
+		for name, key := range iface {
+			g.union(key, methods[name])
+		}
+	}
+}
+
+// splitMethodKey splits a methodKey into its receiver and method name parts.
+func splitMethodKey(key string) (recv, name string) {
+	i := len(key) - 1
+	for i >= 0 && key[i] != '.' {
+		i--
+	}
+	return key[:i], key[i+1:]
+}
+
+// methodKeptKey returns the keepKey for the method with a methodKey.
+func methodKeptKey(key string) string {
+	recv, name := splitMethodKey(key)
+	if recv == "*" {
+		return "" // methods in interface literals cannot be kept
+	}
+	pkgPath, _ := splitMethodKey(recv)
+	return pkgPath + ".*." + name
+}
+
+// forceRenameAutoHashInput is added to buildFlagHashInput,
+// as the names renamed by -force-rename=auto affect the obfuscated output.
+func forceRenameAutoHashInput() string {
+	if sharedCache.RenamedMethods == nil {
+		return ""
+	}
+	h := sha256.New()
+	for _, renamed := range []map[string]bool{sharedCache.RenamedMethods, sharedCache.RenamedExports} {
+		for _, key := range slices.Sorted(maps.Keys(renamed)) {
+			h.Write([]byte(key))
+			h.Write([]byte{0})
+		}
+		h.Write([]byte{1})
+	}
+	return fmt.Sprintf(" renamed-names=%x", h.Sum(nil))
+}
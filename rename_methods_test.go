@@ -0,0 +1,144 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"testing"
+)
+
+func TestMethodGraph(t *testing.T) {
+	src := `package p
+
+type Shape interface{ Area() int }
+
+type Square struct{}
+
+func (Square) Area() int { return 1 }
+func (Square) Scale()    {}
+
+type Circle struct{}
+
+func (*Circle) Area() int { return 2 }
+
+type Named struct{}
+
+func (Named) Scale() {}
+
+func local() {
+	var _ interface{ Scale() } = Square{}
+}
+`
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Defs:  make(map[*ast.Ident]types.Object),
+		Types: make(map[ast.Expr]types.TypeAndValue),
+	}
+	pkg, err := new(types.Config).Check("test/p", fset, []*ast.File{file}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origShared := sharedCache
+	sharedCache = &sharedCacheType{ListedPackages: map[string]*listedPackage{
+		"test/p": {ImportPath: "test/p", ToObfuscate: true},
+	}}
+	defer func() { sharedCache = origShared }()
+
+	g := methodGraph{
+		parent:      make(map[string]string),
+		obfuscated:  make(map[string]bool),
+		implementer: make(map[string][]map[string]string),
+	}
+	var interfaces []map[string]string
+	for _, name := range []string{"Shape", "Square", "Circle", "Named"} {
+		typ := pkg.Scope().Lookup(name).Type()
+		if _, ok := typ.Underlying().(*types.Interface); ok {
+			interfaces = append(interfaces, g.addType(typ))
+		} else {
+			g.addType(types.NewPointer(typ))
+		}
+	}
+	for _, tv := range info.Types {
+		if iface, ok := tv.Type.(*types.Interface); ok && iface.NumMethods() > 0 {
+			interfaces = append(interfaces, g.addType(iface))
+		}
+	}
+	for _, iface := range interfaces {
+		g.joinImplementers(iface)
+	}
+
+	for _, key := range []string{
+		"test/p.Shape.Area",
+		"test/p.Square.Area",
+		"test/p.Square.Scale",
+		"test/p.Circle.Area",
+		"test/p.Named.Scale",
+		"*.Scale",
+	} {
+		if !g.obfuscated[key] {
+			t.Errorf("method %q is missing or not obfuscated", key)
+		}
+	}
+	joined := func(a, b string) bool { return g.find(a) == g.find(b) }
+	for _, pair := range [][2]string{
+		{"test/p.Shape.Area", "test/p.Square.Area"},
+		{"test/p.Shape.Area", "test/p.Circle.Area"},
+		{"*.Scale", "test/p.Square.Scale"},
+		{"*.Scale", "test/p.Named.Scale"},
+	} {
+		if !joined(pair[0], pair[1]) {
+			t.Errorf("%q and %q should be joined", pair[0], pair[1])
+		}
+	}
+	if joined("test/p.Square.Area", "test/p.Square.Scale") {
+		t.Errorf("methods with different names should not be joined")
+	}
+}
+
+func TestMethodKeptKey(t *testing.T) {
+	for _, test := range []struct {
+		key, recv, name, kept string
+	}{
+		{"test/p.T.Method", "test/p.T", "Method", "test/p.*.Method"},
+		{"example.com/a.b/c.T.Method", "example.com/a.b/c.T", "Method", "example.com/a.b/c.*.Method"},
+		{"*.Method", "*", "Method", ""},
+	} {
+		recv, name := splitMethodKey(test.key)
+		if recv != test.recv || name != test.name {
+			t.Errorf("splitMethodKey(%q) = %q, %q; want %q, %q", test.key, recv, name, test.recv, test.name)
+		}
+		if got := methodKeptKey(test.key); got != test.kept {
+			t.Errorf("methodKeptKey(%q) = %q; want %q", test.key, got, test.kept)
+		}
+	}
+}
+
+func TestForceRenameFlag(t *testing.T) {
+	for _, test := range []struct {
+		value         string
+		enabled, auto bool
+		wantErr       bool
+	}{
+		{"true", true, false, false},
+		{"false", false, false, false},
+		{"auto", true, true, false},
+		{"sometimes", false, false, true},
+	} {
+		flagForceRename, flagForceRenameAuto = false, false
+		var f forceRenameFlag
+		err := f.Set(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Set(%q) error = %v; want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		if flagForceRename != test.enabled || flagForceRenameAuto != test.auto {
+			t.Errorf("Set(%q) = enabled=%v auto=%v; want enabled=%v auto=%v", test.value,
+				flagForceRename, flagForceRenameAuto, test.enabled, test.auto)
+		}
+	}
+	flagForceRename, flagForceRenameAuto = false, false
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/AeonDave/garble/internal/ctrlflow"
+)
+
+// reportDirName is the directory under GARBLE_SHARED where each toolexec
+// sub-process writes the report for the package it compiled.
+const reportDirName = "report"
+
+// buildReport is the JSON document written by -report,
+// summarizing what garble did to each package in a build.
+type buildReport struct {
+	GoVersion string // as per GoEnv.GOVERSION
+	GOGARBLE  string
+
+	// Flags holds garble's own flags which affected the build, without -seed.
+	Flags []string
+
+	Packages []*packageReport
+}
+
+// packageReport summarizes the obfuscation of a single compiled package.
+type packageReport struct {
+	ImportPath  string
+	ToObfuscate bool
+
+	// RenamedIdentifiers counts the identifiers declared in the package
+	// which were given obfuscated names.
+	RenamedIdentifiers int
+
+	// ReflectedNames lists the names of types and fields in the package
+	// which reflectInspector found to be used via reflection.
+	ReflectedNames []string
+
+	// Literals counts the obfuscated literals by strategy name.
+	Literals map[string]int
+
+	// LiteralsSkipped maps the functions, or whole files, whose literals
+	// were left alone while the rest of the package's were obfuscated,
+	// to the reason why, such as //go:nosplit or //garble:noliterals.
+	LiteralsSkipped map[string]string `json:",omitempty"`
+
+	// CachedLiterals counts the string literals which are decrypted at most
+	// once, as per -literals-cache, and CachedLiteralBytes is their total
+	// length: the plaintext which stays in memory once they are first used.
+	CachedLiterals     int `json:",omitempty"`
+	CachedLiteralBytes int `json:",omitempty"`
+
+	// NumericLiterals counts the integer and float literals which were
+	// obfuscated, up to a budget per package.
+	NumericLiterals int `json:",omitempty"`
+
+	// HashedComparisons counts the equality checks against string constants
+	// which compare keyed hashes instead, as per -literals-hash.
+	HashedComparisons int `json:",omitempty"`
+
+	// LoweredSwitches counts the switch statements over strings which were
+	// rewritten so that their case expressions could be obfuscated.
+	LoweredSwitches int `json:",omitempty"`
+
+	// EmbeddedFiles counts the files embedded with //go:embed which were
+	// encrypted, and EmbedsSkipped maps the embed.FS variables which were left
+	// in plaintext while literals were obfuscated to the reason why.
+	EmbeddedFiles int               `json:",omitempty"`
+	EmbedsSkipped map[string]string `json:",omitempty"`
+
+	// ControlFlow is nil when control-flow obfuscation was not enabled
+	// for the package.
+	ControlFlow *ctrlflow.Report
+}
+
+func newPackageReport(lpkg *listedPackage) *packageReport {
+	return &packageReport{
+		ImportPath:  lpkg.ImportPath,
+		ToObfuscate: lpkg.ToObfuscate,
+		Literals:    make(map[string]int),
+	}
+}
+
+func (r *packageReport) addLiterals(counts map[string]int) {
+	for name, n := range counts {
+		r.Literals[name] += n
+	}
+}
+
+// recordReflectedNames fills ReflectedNames from the current package cache.
+// Objects are looked up by their obfuscated names, just like reflectInspector does.
+func (tf *transformer) recordReflectedNames() {
+	if tf.report == nil || !tf.curPkg.ToObfuscate {
+		return
+	}
+	reflected := func(obj types.Object, parent *types.Struct) bool {
+		var obfName string
+		if v, ok := obj.(*types.Var); ok && parent != nil {
+			obfName = hashWithStruct(parent, v)
+		} else {
+			obfName = hashWithPackage(tf.curPkg, obj.Name())
+		}
+		_, ok := tf.curPkgCache.ReflectObjectNames[obfName]
+		return ok
+	}
+	names := make(map[string]bool)
+	for _, obj := range tf.info.Defs {
+		if obj == nil || obj.Pkg() != tf.pkg {
+			continue
+		}
+		switch obj := obj.(type) {
+		case *types.TypeName:
+			if reflected(obj, nil) {
+				names[obj.Name()] = true
+			}
+		case *types.Var:
+			if !obj.IsField() {
+				continue
+			}
+			if reflected(obj, tf.fieldToStruct[obj]) || reflected(obj, nil) {
+				names[obj.Name()] = true
+			}
+		}
+	}
+	tf.report.ReflectedNames = slices.Sorted(maps.Keys(names))
+}
+
+// writeReportFragment saves the current package's report into GARBLE_SHARED,
+// for the top-level garble process to collect once the build is done.
+func (tf *transformer) writeReportFragment() error {
+	if tf.report == nil {
+		return nil
+	}
+	dir := filepath.Join(sharedTempDir, reportDirName)
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return err
+	}
+	data, err := json.Marshal(tf.report)
+	if err != nil {
+		return err
+	}
+	// The same package may be compiled more than once, such as for tests,
+	// so the last compilation wins.
+	name := fmt.Sprintf("%x.json", sha256.Sum256([]byte(tf.curPkg.ImportPath)))
+	return os.WriteFile(filepath.Join(dir, name), data, 0o666)
+}
+
+// writeBuildReport merges the package reports written by the toolexec
+// sub-processes into a single JSON file at path.
+func writeBuildReport(path string) error {
+	var flags bytes.Buffer
+	appendFlags(&flags, true)
+	report := buildReport{
+		GoVersion: sharedCache.GoEnv.GOVERSION,
+		GOGARBLE:  sharedCache.GOGARBLE,
+	}
+	for _, flag := range strings.Fields(flags.String()) {
+		if strings.HasPrefix(flag, "-seed=") {
+			continue // the seed is a secret
+		}
+		report.Flags = append(report.Flags, flag)
+	}
+
+	dir := filepath.Join(sharedTempDir, reportDirName)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		var pkg packageReport
+		if err := json.Unmarshal(data, &pkg); err != nil {
+			return fmt.Errorf("cannot decode package report %s: %v", entry.Name(), err)
+		}
+		report.Packages = append(report.Packages, &pkg)
+	}
+	slices.SortFunc(report.Packages, func(a, b *packageReport) int {
+		return strings.Compare(a.ImportPath, b.ImportPath)
+	})
+
+	data, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(path, data, 0o666); err != nil {
+		return fmt.Errorf("cannot write report: %v", err)
+	}
+	return nil
+}
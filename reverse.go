@@ -0,0 +1,336 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AeonDave/garble/internal/typesutil"
+)
+
+// commandReverse implements "garble reverse".
+func commandReverse(args []string) error {
+	flags, args := splitFlagsFromArgs(args)
+	if hasHelpFlag(flags) || len(args) == 0 {
+		_, _ = fmt.Fprint(os.Stderr, `
+usage: garble [garble flags] reverse [-seed=s] [-nonce=n] [-manifest=file] [-key=file] [build flags] package [files]
+
+For example, after building an obfuscated program as follows:
+
+	garble -seed=o9WDTZ4CN4w -literals build -tags=mytag ./cmd/mycmd
+
+One can reverse a captured panic stack trace as follows:
+
+	garble reverse -seed=o9WDTZ4CN4w -nonce=<nonce> -tags=mytag ./cmd/mycmd panic-output.txt
+
+Or, if the build used "garble -manifest=app.manifest -manifest-plaintext build":
+
+	garble reverse -manifest=app.manifest ./cmd/mycmd < panic-output.txt
+
+If the manifest was encrypted with -manifest-key, use -key or GARBLE_MANIFEST_KEY
+to give the file holding the private key from "garble keygen".
+
+If no files are given, the output to reverse is read from standard input.
+`[1:])
+		return errJustExit(2)
+	}
+
+	flags, opts, err := cutReverseFlags(flags)
+	if err != nil {
+		return err
+	}
+	if opts.manifest != "" {
+		m, err := readBuildManifest(opts.manifest, cmp.Or(opts.key, os.Getenv("GARBLE_MANIFEST_KEY")))
+		if err != nil {
+			return err
+		}
+		if err := m.apply(); err != nil {
+			return err
+		}
+		// Build flags given on the command line are added after the recorded ones,
+		// so that they take precedence.
+		flags = append(append([]string(nil), m.BuildFlags...), flags...)
+		defer func() {
+			if sharedCache != nil && m.GoVersion != sharedCache.GoEnv.GOVERSION {
+				_, _ = fmt.Fprintf(os.Stderr, "warning: the build used %s but reverse ran with %s; standard library positions may be wrong\n",
+					m.GoVersion, sharedCache.GoEnv.GOVERSION)
+			}
+		}()
+	}
+	if opts.seed != "" {
+		if err := flagSeed.Set(opts.seed); err != nil {
+			return err
+		}
+	}
+	if opts.nonce != "" {
+		_ = os.Setenv("GARBLE_BUILD_NONCE", opts.nonce)
+	}
+	if !flagSeed.present() {
+		return fmt.Errorf("garble reverse needs the build's seed; use -seed or -manifest")
+	}
+	if os.Getenv("GARBLE_BUILD_NONCE") == "" {
+		return fmt.Errorf("garble reverse needs the build's nonce; use -nonce, -manifest, or GARBLE_BUILD_NONCE")
+	}
+
+	// We don't actually run a main Go command with all flags,
+	// so if the user gave a non-build flag,
+	// we need this check to not silently ignore it.
+	if _, firstUnknown := filterForwardBuildFlags(flags); firstUnknown != "" {
+		// A bit of a hack to get a normal flag.Parse error.
+		return flag.NewFlagSet("", flag.ContinueOnError).Parse([]string{firstUnknown})
+	}
+
+	pkg, args := args[0], args[1:]
+	// We don't actually run `go list -toolexec=garble`; we only use toolexecCmd
+	// to ensure that sharedCache.ListedPackages is filled.
+	_, err = toolexecCmd("list", append(flags, pkg))
+	defer func() {
+		_ = os.RemoveAll(os.Getenv("GARBLE_SHARED"))
+	}()
+	if err != nil {
+		return err
+	}
+
+	repl, err := reverseReplacer()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		modified, err := reverseContent(os.Stdout, os.Stdin, repl)
+		if err != nil {
+			return err
+		}
+		if !modified {
+			return errJustExit(1)
+		}
+		return nil
+	}
+	anyModified := false
+	for _, path := range args {
+		modified, err := reverseFile(os.Stdout, path, repl)
+		if err != nil {
+			return err
+		}
+		anyModified = anyModified || modified
+	}
+	if !anyModified {
+		return errJustExit(1)
+	}
+	return nil
+}
+
+type reverseOptions struct {
+	seed     string
+	nonce    string
+	manifest string
+	key      string
+}
+
+// cutReverseFlags removes the flags specific to "garble reverse" from flags,
+// leaving only the build flags which are forwarded to "go list".
+func cutReverseFlags(flags []string) (rest []string, opts reverseOptions, _ error) {
+	for i := 0; i < len(flags); i++ {
+		arg := flags[i]
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "-"), "=")
+		var dst *string
+		switch name {
+		case "seed":
+			dst = &opts.seed
+		case "nonce":
+			dst = &opts.nonce
+		case "manifest":
+			dst = &opts.manifest
+		case "key":
+			dst = &opts.key
+		default:
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i++; i >= len(flags) {
+				return nil, opts, fmt.Errorf("flag needs an argument: -%s", name)
+			}
+			value = flags[i]
+		}
+		*dst = value
+	}
+	return rest, opts, nil
+}
+
+// reverseReplacer builds a replacer which maps obfuscated names, import paths,
+// and positions back to their originals, for all the obfuscated packages
+// recorded in sharedCache.ListedPackages.
+//
+// A package's names are hashed in the same way that transformGoFile does,
+// and call site positions are hashed in the same way that printFile does.
+// Note that we parse Go files directly to obtain the names, since the
+// export data only exposes exported names. Parsing Go files is cheap,
+// so it's unnecessary to try to avoid this cost.
+func reverseReplacer() (*strings.Replacer, error) {
+	var replaces []string
+
+	for _, lpkg := range sharedCache.ListedPackages {
+		if !lpkg.ToObfuscate {
+			continue
+		}
+		addHashedWithPackage := func(str string) {
+			if str == "_" {
+				return // unnamed remains unnamed
+			}
+			hashed := hashWithPackage(lpkg, str)
+			replaces = append(replaces, hashed, str)
+			if flagForceRenameAuto && token.IsExported(str) {
+				// We don't know which exported names the build unexported.
+				replaces = append(replaces, unexportName(hashed), str)
+			}
+		}
+
+		// parseFiles patches the first main package it sees with reflect code.
+		// That doesn't change any original offsets, but we don't want the
+		// global state to leak between packages.
+		reflectPatchFile = ""
+		files, err := parseFiles(lpkg, lpkg.Dir, lpkg.CompiledGoFiles)
+		if err != nil {
+			return nil, err
+		}
+		reflectPatchFile = ""
+		resaltedNames = resaltNames(lpkg, files)
+
+		// Package paths and names are obfuscated, too.
+		addHashedWithPackage(lpkg.ImportPath)
+		if lpkg.Name != "main" {
+			addHashedWithPackage(lpkg.Name)
+		}
+		_, info, err := typecheck(lpkg.ImportPath, files, importerForPkg(lpkg))
+		if err != nil {
+			return nil, err
+		}
+		fieldToStruct := typesutil.FieldToStruct(info)
+		for i, file := range files {
+			goFile := lpkg.CompiledGoFiles[i]
+			fsetFile := fset.File(file.Pos())
+			filename := filepath.Base(fsetFile.Name())
+			newPrefix := ""
+			if strings.HasPrefix(filename, "_cgo_") {
+				newPrefix = "_cgo_"
+			}
+			for node := range ast.Preorder(file) {
+				switch node := node.(type) {
+
+				// Replace names.
+				case *ast.FuncDecl:
+					name := node.Name.Name
+					switch {
+					case node.Recv == nil:
+						addHashedWithPackage(name)
+					case flagForceRename:
+						// All methods are hashed globally with -force-rename,
+						// including unexported ones; see transformGoFile.
+						replaces = append(replaces, hashMethodGlobal(name), name)
+					case !token.IsExported(name):
+						addHashedWithPackage(name)
+					}
+				case *ast.TypeSpec:
+					addHashedWithPackage(node.Name.Name)
+				case *ast.ValueSpec:
+					for _, name := range node.Names {
+						if obj := info.Defs[name]; obj != nil && obj.Parent() == obj.Pkg().Scope() {
+							addHashedWithPackage(name.Name)
+						}
+					}
+				case *ast.Field:
+					for _, name := range node.Names {
+						obj, _ := info.ObjectOf(name).(*types.Var)
+						if obj == nil || !obj.IsField() {
+							continue
+						}
+						strct := fieldToStruct[obj]
+						if strct == nil {
+							continue
+						}
+						replaces = append(replaces, hashWithStruct(strct, obj), name.Name)
+					}
+
+				case *ast.CallExpr:
+					if flagTiny {
+						continue // positions are removed entirely
+					}
+					// Reverse position information of call sites.
+					pos := fsetFile.Position(node.Pos())
+					origPos := fmt.Sprintf("%s:%d", filename, pos.Offset)
+					newFilename := newPrefix + hashWithPackage(lpkg, origPos) + ".go"
+
+					// Do "obfuscated.go:1", corresponding to the call site's line.
+					// Most common in stack traces.
+					replaces = append(replaces,
+						newFilename+":1",
+						fmt.Sprintf("%s/%s:%d", lpkg.ImportPath, goFile, pos.Line),
+					)
+
+					// Do "obfuscated.go" as a fallback.
+					// Most useful in build errors in obfuscated code,
+					// since those might land on any line.
+					// Any ":N" line number will end up being useless,
+					// but at least the filename will be correct.
+					replaces = append(replaces,
+						newFilename,
+						fmt.Sprintf("%s/%s", lpkg.ImportPath, goFile),
+					)
+				}
+			}
+		}
+	}
+	return strings.NewReplacer(replaces...), nil
+}
+
+func reverseFile(w io.Writer, path string, repl *strings.Replacer) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	return reverseContent(w, f, repl)
+}
+
+func reverseContent(w io.Writer, r io.Reader, repl *strings.Replacer) (bool, error) {
+	// Read line by line.
+	// Reading the entire content at once wouldn't be interactive,
+	// nor would it support large files well.
+	// Reading entire lines ensures we don't cut words in half.
+	// We use bufio.Reader instead of bufio.Scanner,
+	// to also obtain the newline characters themselves.
+	br := bufio.NewReader(r)
+	modified := false
+	for {
+		// Note that ReadString can return a line as well as an error if
+		// we hit EOF without a newline.
+		// In that case, we still want to process the string.
+		line, readErr := br.ReadString('\n')
+
+		newLine := repl.Replace(line)
+		if newLine != line {
+			modified = true
+		}
+		if _, err := io.WriteString(w, newLine); err != nil {
+			return modified, err
+		}
+		if readErr == io.EOF {
+			return modified, nil
+		}
+		if readErr != nil {
+			return modified, readErr
+		}
+	}
+}
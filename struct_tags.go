@@ -0,0 +1,115 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"go/ast"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//go:embed struct_tags_abi_code.go
+var structTagsAbiCode string
+
+// structTagKey returns the key used to encrypt struct tags with -encrypt-tags.
+// Unlike most of our hashing, it does not depend on the package being built,
+// as struct types are identical across packages only if their tags are.
+func structTagKey() (k0, k1 uint64) {
+	h := sha256.New()
+	h.Write([]byte("garble struct tags"))
+	h.Write(seedHashInput())
+	sum := h.Sum(nil)
+	return binary.LittleEndian.Uint64(sum[:8]), binary.LittleEndian.Uint64(sum[8:16])
+}
+
+// encryptStructTag encrypts a struct tag so that the patched internal/abi
+// can decrypt it; see struct_tags_abi_code.go.
+// The nonce is derived from the tag, so equal tags are encrypted equally.
+func encryptStructTag(tag string, k0, k1 uint64) string {
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], k0)
+	binary.LittleEndian.PutUint64(buf[8:], k1)
+	sum := sha256.Sum256(append(buf[:], tag...))
+	nonce := string(sum[:4])
+	return "\xff" + nonce + string(_dx(nonce, tag, k0, k1))
+}
+
+// encryptStructTags replaces the tags of all struct types in a file
+// with their encrypted form.
+func (tf *transformer) encryptStructTags(file *ast.File) {
+	k0, k1 := structTagKey()
+	count := 0
+	for node := range ast.Preorder(file) {
+		strct, ok := node.(*ast.StructType)
+		if !ok {
+			continue
+		}
+		for _, field := range strct.Fields.List {
+			if field.Tag == nil {
+				continue
+			}
+			tag, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				continue
+			}
+			switch {
+			case tag == "":
+				continue
+			case tag[0] == 0xff:
+				continue // would be mistaken for an encrypted tag
+			case tag == `go:"track"`:
+				continue // read by the compiler for field tracking
+			}
+			field.Tag.Value = strconv.Quote(encryptStructTag(tag, k0, k1))
+			count++
+		}
+	}
+	if flagDebug && count > 0 {
+		log.Printf("encrypted %d struct tags in %s", count, fset.Position(file.Package).Filename)
+	}
+}
+
+// abiTagPatch makes internal/abi's Name.Tag decrypt the tags encrypted by
+// encryptStructTags. src is the contents of internal/abi/type.go.
+func abiTagPatch(src string) (string, error) {
+	find := `return unsafe.String(n.DataChecked(1+i+l+i2, "non-empty string"), l2)`
+	replace := `return _dt(unsafe.String(n.DataChecked(1+i+l+i2, "non-empty string"), l2))`
+	if !strings.Contains(src, find) {
+		return "", fmt.Errorf("could not find the struct tag accessor in internal/abi")
+	}
+	src = strings.Replace(src, find, replace, 1)
+
+	_, code, _ := strings.Cut(structTagsAbiCode, "// Injected code below this line.")
+	code = strings.ReplaceAll(code, "//disabledgo:", "//go:")
+	k0, k1 := structTagKey()
+	code = strings.Replace(code, "var _tk0, _tk1 uint64", fmt.Sprintf("const _tk0, _tk1 uint64 = %#x, %#x", k0, k1), 1)
+	return src + code, nil
+}
+
+// reflectTagPatch makes reflect.StructTag.Lookup, and thus Get, decrypt
+// tags which did not go through internal/abi's Name.Tag.
+func reflectTagPatch(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	find := "func (tag StructTag) Lookup(key string) (value string, ok bool) {\n"
+	replace := find + "\ttag = StructTag(_dt(string(tag)))\n"
+	src := string(data)
+	if !strings.Contains(src, find) {
+		return "", fmt.Errorf("could not find reflect.StructTag.Lookup in %s", path)
+	}
+	src = strings.Replace(src, find, replace, 1)
+
+	return src + `
+//go:linkname _dt internal/abi._dt
+func _dt(tag string) string
+`, nil
+}
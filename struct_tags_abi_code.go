@@ -0,0 +1,44 @@
+package main
+
+// The code below is appended to internal/abi when struct tags are encrypted.
+// Name.Tag is patched to call _dt, so that reflect and any other users of
+// type descriptors see the original tags. Tags which were not encrypted,
+// such as those in packages which are not obfuscated, are returned as-is.
+//
+// An encrypted tag is a 0xff byte, a four-byte nonce, and the ciphertext.
+// The key is the same for the entire build, so that identical struct types
+// in different packages still have identical tags.
+//
+// The linkname below is only turned on when the code is injected,
+// so that we can test this code normally.
+
+// Injected code below this line.
+
+var _tk0, _tk1 uint64
+
+//disabledgo:linkname _dt
+func _dt(s string) string {
+	if len(s) < 5 || s[0] != 0xff {
+		return s
+	}
+	return string(_dx(s[1:5], s[5:], _tk0, _tk1))
+}
+
+// _dx XORs s with a keystream derived from the key and nonce.
+func _dx(nonce, s string, k0, k1 uint64) []byte {
+	x := k0 ^ (uint64(nonce[0])|uint64(nonce[1])<<8|uint64(nonce[2])<<16|uint64(nonce[3])<<24)*0x9e3779b97f4a7c15
+	b := make([]byte, len(s))
+	var z uint64
+	for i := 0; i < len(s); i++ {
+		if i%8 == 0 {
+			x += 0x9e3779b97f4a7c15
+			z = x
+			z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+			z = (z ^ z>>27) * 0x94d049bb133111eb
+			z ^= z>>31 ^ k1
+		}
+		b[i] = s[i] ^ byte(z)
+		z >>= 8
+	}
+	return b
+}
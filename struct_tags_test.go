@@ -0,0 +1,79 @@
+package main
+
+import (
+	"go/parser"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestEncryptStructTag(t *testing.T) {
+	origTk0, origTk1 := _tk0, _tk1
+	defer func() { _tk0, _tk1 = origTk0, origTk1 }()
+	_tk0, _tk1 = 0x0123456789abcdef, 0xfedcba9876543210
+
+	for _, tag := range []string{
+		`json:"api_secret"`,
+		`db:"password_hash" validate:"required,min=12"`,
+		"x",
+		strings.Repeat("long tag ", 20),
+	} {
+		enc := encryptStructTag(tag, _tk0, _tk1)
+		if strings.Contains(enc, tag) {
+			t.Errorf("encryptStructTag(%q) contains the plaintext: %q", tag, enc)
+		}
+		if again := encryptStructTag(tag, _tk0, _tk1); again != enc {
+			t.Errorf("encryptStructTag(%q) is not deterministic: %q and %q", tag, enc, again)
+		}
+		if other := encryptStructTag(tag, _tk0+1, _tk1); other == enc {
+			t.Errorf("encryptStructTag(%q) does not depend on the key", tag)
+		}
+		if got := _dt(enc); got != tag {
+			t.Errorf("_dt(encryptStructTag(%q)) = %q", tag, got)
+		}
+	}
+	// Tags which were not encrypted are left alone.
+	for _, tag := range []string{"", `json:"name"`, "\xff"} {
+		if got := _dt(tag); got != tag {
+			t.Errorf("_dt(%q) = %q", tag, got)
+		}
+	}
+}
+
+func TestStructTagPatches(t *testing.T) {
+	goroot := runtime.GOROOT()
+	if goroot == "" {
+		t.Skip("GOROOT is unknown")
+	}
+	abiPath := filepath.Join(goroot, "src", "internal", "abi", "type.go")
+	reflectPath := filepath.Join(goroot, "src", "reflect", "type.go")
+
+	origFlag := flagEncryptTags
+	defer func() { flagEncryptTags = origFlag }()
+	flagEncryptTags = true
+
+	abiSrc, err := abiNamePatch(abiPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"return _dt(unsafe.String(", "//go:linkname _dt\n", "const _tk0, _tk1 uint64 = 0x"} {
+		if !strings.Contains(abiSrc, want) {
+			t.Errorf("patched internal/abi is missing %q", want)
+		}
+	}
+	if _, err := parser.ParseFile(fset, abiPath, abiSrc, 0); err != nil {
+		t.Errorf("patched internal/abi does not parse: %v", err)
+	}
+
+	reflectSrc, err := reflectTagPatch(reflectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(reflectSrc, "tag = StructTag(_dt(string(tag)))") {
+		t.Errorf("patched reflect does not decrypt in StructTag.Lookup")
+	}
+	if _, err := parser.ParseFile(fset, reflectPath, reflectSrc, 0); err != nil {
+		t.Errorf("patched reflect does not parse: %v", err)
+	}
+}
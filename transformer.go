@@ -12,6 +12,7 @@ import (
 	"go/types"
 	"io/fs"
 	"log"
+	"maps"
 	mathrand "math/rand"
 	"os"
 	"path/filepath"
@@ -130,13 +131,32 @@ type transformer struct {
 
 	linkerInitInjected bool
 	constTransforms    map[*types.Const]*consts.Transform
-	skipLiterals       bool
+	// literalsOn is whether the package's literals are obfuscated by default,
+	// and literalsOptIn whether any function or file opts in with a directive.
+	literalsOn    bool
+	literalsOptIn bool
+	// literalsCache is whether the package's string literals are decrypted
+	// at most once by default.
+	literalsCache bool
+	// literalsHash is whether the package's equality checks against string
+	// constants compare keyed hashes by default.
+	literalsHash bool
+	// literalsNumbers is the budget of numeric literals shared by all of the
+	// package's files.
+	literalsNumbers *literals.NumberBudget
 
 	// protectedMethods maps method names to interfaces from non-obfuscated
 	// packages (including predeclared interfaces like "error"). Methods
 	// satisfying these interfaces must not be renamed even with -force-rename,
 	// because the interface method names remain unchanged.
 	protectedMethods map[string][]*types.Interface
+
+	// reflectLookups holds the reflect lookups in the package being compiled,
+	// whose constant names are rewritten by rewriteReflectLookups.
+	reflectLookups []reflectLookup
+
+	// report is filled while compiling a package with -report, and nil otherwise.
+	report *packageReport
 }
 
 type compileContext struct {
@@ -200,6 +220,10 @@ func (tf *transformer) transformAsm(args []string) ([]string, error) {
 		return append(flags, newPaths...), nil
 	}
 
+	if err := tf.loadAsmNames(); err != nil {
+		return nil, err
+	}
+
 	newHeaderPaths := make(map[string]string)
 	var buf, includeBuf bytes.Buffer
 	for _, path := range paths {
@@ -223,6 +247,42 @@ func (tf *transformer) transformAsm(args []string) ([]string, error) {
 	return append(flags, newPaths...), nil
 }
 
+// loadAsmNames sets resaltedNames and the kept names in tf.curPkgCache
+// for the names which assembly files may reference.
+// Since the assembler runs before the package is compiled, we find those
+// in the package itself from its Go files, and load the ones in its
+// dependencies from their cache entries.
+func (tf *transformer) loadAsmNames() error {
+	resaltedNames = make(map[string]string)
+	tf.curPkgCache.KeptNames = make(map[string]bool)
+	if tf.curPkg.ToObfuscate {
+		reflectPatchFile = ""
+		files, err := parseFiles(tf.curPkg, tf.curPkg.Dir, tf.curPkg.CompiledGoFiles)
+		if err != nil {
+			return err
+		}
+		reflectPatchFile = ""
+		resaltedNames = resaltNames(tf.curPkg, files)
+		tf.curPkgCache.KeptNames = keptTopLevelNames(tf.curPkg, files)
+	}
+
+	fsCache, err := openCache()
+	if err != nil {
+		return err
+	}
+	for _, imp := range tf.curPkg.Imports {
+		lpkg, err := listPackage(tf.curPkg, imp)
+		if err != nil || !lpkg.ToObfuscate {
+			continue
+		}
+		if cached, ok := cachedPkgCache(fsCache, lpkg); ok {
+			maps.Copy(resaltedNames, cached.ResaltedNames)
+			maps.Copy(tf.curPkgCache.KeptNames, cached.KeptNames)
+		}
+	}
+	return nil
+}
+
 func (tf *transformer) replaceAsmNames(buf *bytes.Buffer, remaining []byte) {
 	// We need to replace all function references with their obfuscated name
 	// counterparts.
@@ -323,7 +383,8 @@ func (tf *transformer) replaceAsmNames(buf *bytes.Buffer, remaining []byte) {
 		name := string(remaining[:nameEnd])
 		remaining = remaining[nameEnd:]
 
-		if lpkg.ToObfuscate && !compilerIntrinsics[lpkg.ImportPath][name] {
+		if lpkg.ToObfuscate && !compilerIntrinsics[lpkg.ImportPath][name] &&
+			!tf.curPkgCache.KeptNames[lpkg.ImportPath+"."+name] {
 			newName := hashWithPackage(lpkg, name)
 			if flagDebug { // TODO(mvdan): remove once https://go.dev/issue/53465 if fixed
 				log.Printf("asm name %q hashed with %x to %q", name, tf.curPkg.GarbleActionID, newName)
@@ -424,6 +485,9 @@ func (tf *transformer) transformCompile(args []string) ([]string, error) {
 		flags: tf.disableDWARFGeneration(flags),
 		paths: paths,
 	}
+	if flagReport != "" {
+		tf.report = newPackageReport(tf.curPkg)
+	}
 
 	pipe := pipeline.New[*compileContext]()
 	pipe.Add(pipeline.NewFuncStep("parse-go-files", func(ctx *compileContext) error {
@@ -446,9 +510,12 @@ func (tf *transformer) transformCompile(args []string) ([]string, error) {
 			return err
 		}
 		ctx.ssaPkg = ssaPkg
-		ctx.requiredPkgs = requiredPkgs
+		ctx.requiredPkgs = append(ctx.requiredPkgs, requiredPkgs...)
 		return nil
 	}))
+	pipe.Add(pipeline.NewFuncStep("encrypt-embeds", func(ctx *compileContext) error {
+		return ctx.tf.encryptEmbeds(ctx)
+	}))
 	pipe.Add(pipeline.NewFuncStep("prepare-obfuscation", func(ctx *compileContext) error {
 		return ctx.tf.prepareObfuscationState(ctx.files, ctx.ssaPkg)
 	}))
@@ -476,6 +543,9 @@ func (tf *transformer) transformCompile(args []string) ([]string, error) {
 		ctx.emittedPaths = newPaths
 		return nil
 	}))
+	pipe.Add(pipeline.NewFuncStep("write-report", func(ctx *compileContext) error {
+		return ctx.tf.writeReportFragment()
+	}))
 
 	if err := pipe.Execute(ctx); err != nil {
 		return nil, err
@@ -520,12 +590,7 @@ func (tf *transformer) applyControlFlowTransforms(files *[]*ast.File, paths *[]s
 
 	origPaths := append([]string(nil), (*paths)...)
 
-	mode := flagControlFlowMode
-	if tf.curPkg.Standard && mode != ctrlflow.ModeAnnotated {
-		// The standard library contains compiler intrinsics and patterns
-		// that the current control-flow pipeline cannot rewrite safely.
-		mode = ctrlflow.ModeAnnotated
-	}
+	mode := controlFlowModeFor(tf.curPkg)
 
 	// Collect required packages (from control-flow only)
 	// Pack-required packages are added later in finalize-pack step,
@@ -537,7 +602,12 @@ func (tf *transformer) applyControlFlowTransforms(files *[]*ast.File, paths *[]s
 	}
 	ssaPkg := ssaBuildPkg(tf.pkg, *files, tf.info)
 
-	newFileName, newFile, affectedFiles, err := ctrlflow.Obfuscate(fset, ssaPkg, *files, tf.obfRand, mode, sharedTempDir)
+	var cfReport *ctrlflow.Report
+	if tf.report != nil {
+		cfReport = &ctrlflow.Report{Mode: mode.String()}
+		tf.report.ControlFlow = cfReport
+	}
+	newFileName, newFile, affectedFiles, err := ctrlflow.Obfuscate(fset, ssaPkg, *files, tf.obfRand, mode, sharedTempDir, tf.controlFlowOverride(), cfReport)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -573,6 +643,10 @@ func (tf *transformer) applyControlFlowTransforms(files *[]*ast.File, paths *[]s
 				}
 			}
 			log.Printf("garble: control-flow disabled for %s after typecheck failure: %v", tf.curPkg.ImportPath, typecheckErr)
+			if cfReport != nil {
+				cfReport.SkippedPackage = fmt.Sprintf("typecheck failure: %v", typecheckErr)
+				cfReport.Flattened = nil
+			}
 			if tf.curPkg.Name == "main" && reflectPatchFile != "" {
 				reflectPatchFile = ""
 			}
@@ -600,6 +674,17 @@ func (tf *transformer) applyControlFlowTransforms(files *[]*ast.File, paths *[]s
 	return ssaPkg, requiredPkgs, nil
 }
 
+// controlFlowModeFor returns the control-flow mode which applies to a package.
+func controlFlowModeFor(lpkg *listedPackage) ctrlflow.Mode {
+	mode := sharedCache.Config.ControlFlowFor(lpkg.ImportPath, flagControlFlowMode)
+	if lpkg.Standard && mode != ctrlflow.ModeAnnotated {
+		// The standard library contains compiler intrinsics and patterns
+		// that the current control-flow pipeline cannot rewrite safely.
+		mode = ctrlflow.ModeAnnotated
+	}
+	return mode
+}
+
 func (tf *transformer) prepareObfuscationState(files []*ast.File, ssaPkg *ssa.Package) error {
 	var err error
 	if tf.linkerVariableStrings, err = ldflags.ResolveInjectedStrings(tf.pkg, sharedCache.LinkerInjectedStrings); err != nil {
@@ -608,27 +693,68 @@ func (tf *transformer) prepareObfuscationState(files []*ast.File, ssaPkg *ssa.Pa
 	if tf.curPkgCache, err = loadPkgCache(tf.curPkg, tf.pkg, files, tf.info, ssaPkg); err != nil {
 		return err
 	}
+	resaltedNames = tf.curPkgCache.ResaltedNames
 	tf.fieldToStruct = typesutil.FieldToStruct(tf.info)
-	directive, directivePos := findDangerousDirective(files)
-	tf.skipLiterals = flagLiterals && tf.curPkg.ToObfuscate && directive != ""
-	if tf.skipLiterals {
-		posStr := directivePos.String()
-		if posStr == "-" || posStr == "" {
-			posStr = "unknown position"
+	tf.literalsOn, tf.literalsOptIn = literalsSettingFor(tf.curPkg, files)
+	tf.literalsCache = literalsCacheFor(files)
+	tf.literalsHash = literalsHashFor(files)
+	tf.literalsNumbers = literals.NewNumberBudget(literals.DefaultNumberBudget)
+	// Find the reflect lookups before any constants become variables,
+	// so that we see the same lookups as computePkgCache did.
+	tf.reflectLookups, _ = reflectLookups(tf.pkg, files, tf.info)
+	if tf.literalsOn || tf.literalsOptIn {
+		skipped := literalsSkipped(tf.curPkg, files, tf.literalsOn)
+		for _, name := range slices.Sorted(maps.Keys(skipped)) {
+			log.Printf("garble: literals skipped in %s.%s: %s", tf.curPkg.ImportPath, name, skipped[name])
+		}
+		if tf.report != nil && len(skipped) > 0 {
+			tf.report.LiteralsSkipped = skipped
+		}
+	}
+	if tf.literalsOn || tf.literalsOptIn {
+		// Lowering switches over strings first lets their case expressions be
+		// obfuscated, and lets constants only used there become variables.
+		lowered := 0
+		cfg := tf.literalsBuilderConfig()
+		for _, file := range files {
+			for _, decl := range file.Decls {
+				fn, _ := decl.(*ast.FuncDecl)
+				if literals.Enabled(file, fn, cfg) {
+					lowered += consts.LowerStringSwitches(decl, tf.info, tf.pkg)
+				}
+			}
+		}
+		if lowered > 0 {
+			log.Printf("garble: lowered %d switch statements over strings in %s", lowered, tf.curPkg.ImportPath)
+		}
+		if tf.report != nil {
+			tf.report.LoweredSwitches = lowered
 		}
-		log.Printf("garble: literals disabled for %s; found %s at %s", tf.curPkg.ImportPath, directive, posStr)
 	}
-	if flagLiterals && tf.curPkg.ToObfuscate && !tf.skipLiterals {
-		tf.constTransforms = consts.ComputeTransforms(files, tf.info, tf.pkg)
+	if tf.literalsOn {
+		tf.constTransforms = consts.ComputeTransforms(files, tf.info, tf.pkg, tf.exportedConstConverted)
+		// Constants declared where literals are left alone stay constants.
+		cfg := tf.literalsBuilderConfig()
+		for _, file := range files {
+			if literals.TopLevelEnabled(file, cfg) {
+				continue
+			}
+			for obj := range tf.constTransforms {
+				if file.FileStart <= obj.Pos() && obj.Pos() < file.FileEnd {
+					delete(tf.constTransforms, obj)
+				}
+			}
+		}
 		if len(tf.constTransforms) > 0 {
 			for _, file := range files {
 				consts.RewriteDecls(file, tf.info, tf.constTransforms)
 			}
 		}
 	}
-	if flagForceRename {
+	if flagForceRename && !flagForceRenameAuto {
 		tf.protectedMethods = tf.collectProtectedMethods()
 	}
+	tf.recordReflectedNames()
 	return nil
 }
 
@@ -729,7 +855,8 @@ func (tf *transformer) transformDirectives(comments []*ast.CommentGroup) error {
 
 func (tf *transformer) transformLinkname(localName, newName string) (string, string) {
 	// obfuscate the local name, if the current package is obfuscated
-	if tf.curPkg.ToObfuscate && !compilerIntrinsics[tf.curPkg.ImportPath][localName] {
+	if tf.curPkg.ToObfuscate && !compilerIntrinsics[tf.curPkg.ImportPath][localName] &&
+		!tf.curPkgCache.KeptNames[tf.curPkg.ImportPath+"."+localName] {
 		localName = hashWithPackage(tf.curPkg, localName)
 	}
 	if newName == "" {
@@ -796,27 +923,34 @@ func (tf *transformer) transformLinkname(localName, newName string) (string, str
 		return localName, newName
 	}
 
+	// Names kept via //garble:keep or garble.toml are not obfuscated.
+	hashUnlessKept := func(name, key string) string {
+		if tf.curPkgCache.KeptNames[lpkg.ImportPath+"."+key] {
+			return name
+		}
+		return hashWithPackage(lpkg, name)
+	}
 	var newForeignName string
 	if receiver, name, ok := strings.Cut(foreignName, "."); ok {
 		if receiver, ok = strings.CutPrefix(receiver, "(*"); ok {
 			// pkg/path.(*Receiver).method
 			receiver, _ = strings.CutSuffix(receiver, ")")
-			receiver = "(*" + hashWithPackage(lpkg, receiver) + ")"
+			receiver = "(*" + hashUnlessKept(receiver, receiver) + ")"
 		} else {
 			// pkg/path.Receiver.method
-			receiver = hashWithPackage(lpkg, receiver)
+			receiver = hashUnlessKept(receiver, receiver)
 		}
 		// Exported methods are never obfuscated.
 		//
 		// TODO(mvdan): We're duplicating the logic behind these decisions.
 		// Reuse the logic with transformCompile.
 		if !token.IsExported(name) {
-			name = hashWithPackage(lpkg, name)
+			name = hashUnlessKept(name, "*."+name)
 		}
 		newForeignName = receiver + "." + name
 	} else {
 		// pkg/path.function
-		newForeignName = hashWithPackage(lpkg, foreignName)
+		newForeignName = hashUnlessKept(foreignName, foreignName)
 	}
 
 	newName = lpkg.obfuscatedImportPath() + "." + newForeignName
@@ -1119,30 +1253,27 @@ func usesImportName(file *ast.File, name string) bool {
 	return used
 }
 
-func findDangerousDirective(files []*ast.File) (string, token.Position) {
-	dangerousDirectives := []string{
-		"//go:noescape",
-		"//go:uintptrescapes",
-		"//go:nosplit",
-		"//go:norace",
-		"//go:cgo_",
-	}
-	for _, f := range files {
-		for _, cg := range f.Comments {
-			for _, c := range cg.List {
-				for _, dangerous := range dangerousDirectives {
-					if strings.HasPrefix(c.Text, dangerous) {
-						return dangerous, fset.Position(c.Slash)
-					}
-				}
-			}
-		}
+// recordRenamed counts a renamed identifier for the report,
+// as long as it is the identifier's declaration rather than a use.
+func (tf *transformer) recordRenamed(node *ast.Ident) {
+	if tf.report == nil {
+		return
+	}
+	if _, isDef := tf.info.Defs[node]; isDef {
+		tf.report.RenamedIdentifiers++
 	}
-	return "", token.Position{}
 }
 
 // transformGoFile obfuscates the provided Go syntax file.
 func (tf *transformer) transformGoFile(file *ast.File, filePath string) *ast.File {
+	tf.rewriteReflectLookups(file)
+	if flagWireTags && tf.curPkg.ToObfuscate {
+		tf.addWireTags(file)
+	}
+	if flagEncryptTags && tf.curPkg.ToObfuscate {
+		tf.encryptStructTags(file)
+	}
+
 	// Only obfuscate the literals here if the flag is on
 	// and if the package in question is to be obfuscated.
 	//
@@ -1150,8 +1281,8 @@ func (tf *transformer) transformGoFile(file *ast.File, filePath string) *ast.Fil
 	// because obfuscated literals sometimes escape to heap,
 	// and that's not allowed in the runtime itself.
 	var litBuilder *literals.Builder
-	if flagLiterals && tf.curPkg.ToObfuscate && !tf.skipLiterals {
-		litBuilder = literals.NewBuilder(tf.obfRand, file, randomName, literals.BuilderConfig{})
+	if tf.literalsOn || tf.literalsOptIn {
+		litBuilder = literals.NewBuilder(tf.obfRand, file, randomName, tf.literalsBuilderConfig())
 		file = litBuilder.ObfuscateFile(file, tf.info, tf.linkerVariableStrings)
 
 		// some imported constants might not be needed anymore, remove unnecessary imports
@@ -1163,6 +1294,21 @@ func (tf *transformer) transformGoFile(file *ast.File, filePath string) *ast.Fil
 	if litBuilder != nil {
 		tf.injectLinkerVariableInit(litBuilder, file)
 		litBuilder.Finalize(file)
+		count, size := litBuilder.CachedLiterals()
+		if count > 0 {
+			log.Printf("garble: cached %d string literals in %s, keeping up to %d bytes of plaintext in memory",
+				count, filepath.Base(filePath), size)
+		}
+		if hashed := litBuilder.HashedComparisons(); hashed > 0 {
+			log.Printf("garble: hashed %d string comparisons in %s", hashed, filepath.Base(filePath))
+		}
+		if tf.report != nil {
+			tf.report.addLiterals(litBuilder.StrategyCounts())
+			tf.report.CachedLiterals += count
+			tf.report.CachedLiteralBytes += size
+			tf.report.NumericLiterals += litBuilder.NumberCount()
+			tf.report.HashedComparisons += litBuilder.HashedComparisons()
+		}
 	}
 
 	pre := func(cursor *astutil.Cursor) bool {
@@ -1279,6 +1425,9 @@ func (tf *transformer) transformGoFile(file *ast.File, filePath string) *ast.Fil
 		if !lpkg.ToObfuscate {
 			return true // we're not obfuscating this package
 		}
+		if tf.isKept(obj) {
+			return true // kept via //garble:keep or garble.toml
+		}
 		hashToUse := lpkg.GarbleActionID
 		debugName := "variable"
 
@@ -1309,6 +1458,7 @@ func (tf *transformer) transformGoFile(file *ast.File, filePath string) *ast.Fil
 				panic("could not find struct for field " + name)
 			}
 			node.Name = hashWithStruct(strct, obj)
+			tf.recordRenamed(node)
 			if flagDebug { // TODO(mvdan): remove once https://go.dev/issue/53465 if fixed
 				log.Printf("%s %q hashed with struct fields to %q", debugName, name, node.Name)
 			}
@@ -1327,18 +1477,8 @@ func (tf *transformer) transformGoFile(file *ast.File, filePath string) *ast.Fil
 			} else {
 				debugName = "method"
 			}
-			if obj.Exported() && sign.Recv() != nil {
-				if !flagForceRename {
-					return true // might implement an interface
-				}
-				// With -force-rename, still protect methods that satisfy
-				// interfaces from non-obfuscated packages (e.g., error),
-				// and methods whose names must be kept because they originate
-				// from non-obfuscated embedded types or satisfy interfaces
-				// whose implementations include such methods.
-				if tf.methodSatisfiesExternalInterface(obj) || tf.isMethodFrozenDynamic(obj) {
-					return true
-				}
+			if obj.Exported() && sign.Recv() != nil && !tf.renamesExportedMethod(obj) {
+				return true
 			}
 			switch name {
 			case "main", "init", "TestMain":
@@ -1351,6 +1491,7 @@ func (tf *transformer) transformGoFile(file *ast.File, filePath string) *ast.Fil
 			// hash so that interface satisfaction works across packages.
 			if flagForceRename && sign.Recv() != nil {
 				node.Name = hashMethodGlobal(name)
+				tf.recordRenamed(node)
 				if flagDebug { // TODO(mvdan): remove once https://go.dev/issue/53465 if fixed
 					log.Printf("%s %q hashed globally to %q", debugName, name, node.Name)
 				}
@@ -1361,6 +1502,7 @@ func (tf *transformer) transformGoFile(file *ast.File, filePath string) *ast.Fil
 		}
 
 		node.Name = hashWithPackage(lpkg, name)
+		tf.recordRenamed(node)
 		// TODO: probably move the debugf lines inside the hash funcs
 		if flagDebug { // TODO(mvdan): remove once https://go.dev/issue/53465 if fixed
 			log.Printf("%s %q hashed with %x… to %q", debugName, name, hashToUse[:4], node.Name)
@@ -1498,6 +1640,16 @@ func (tf *transformer) transformLink(args []string) ([]string, error) {
 		return nil, err
 	}
 
+	// The main package's cache entry includes the re-salted names
+	// from all of its dependencies, which -X may refer to.
+	fsCache, err := openCache()
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := cachedPkgCache(fsCache, tf.curPkg); ok {
+		resaltedNames = cached.ResaltedNames
+	}
+
 	// TODO: unify this logic with the -X handling when using -literals.
 	// We should be able to handle both cases via the syntax tree.
 	//
@@ -1546,6 +1698,23 @@ func (tf *transformer) transformLink(args []string) ([]string, error) {
 	return append(flags, args...), nil
 }
 
+// renamesExportedMethod reports whether an exported method is obfuscated,
+// which only happens with -force-rename.
+func (tf *transformer) renamesExportedMethod(obj *types.Func) bool {
+	switch {
+	case flagForceRenameAuto:
+		return sharedCache.RenamedMethods[methodKey(obj)] // see analyzeProgram
+	case !flagForceRename:
+		return false // might implement an interface
+	}
+	// With -force-rename, still protect methods that satisfy
+	// interfaces from non-obfuscated packages (e.g., error),
+	// and methods whose names must be kept because they originate
+	// from non-obfuscated embedded types or satisfy interfaces
+	// whose implementations include such methods.
+	return !tf.methodSatisfiesExternalInterface(obj) && !tf.isMethodFrozenDynamic(obj)
+}
+
 // collectProtectedMethods builds a set of method names mapped to interfaces
 // from non-obfuscated packages (and predeclared interfaces like "error").
 // Any concrete method whose name appears here and whose receiver type satisfies
@@ -3,42 +3,91 @@ package main
 import (
 	"go/ast"
 	"go/parser"
-	"go/token"
+	"maps"
 	"testing"
 )
 
-func TestFindDangerousDirective(t *testing.T) {
+func TestLiteralsSkipped(t *testing.T) {
 	src := `package p
 
 //go:nosplit
-func f() {}
+func fast() string { return "fast" }
+
+//garble:noliterals
+func hot() string { return "hot" }
+
+func normal() string { return "normal" }
+
+//go:noescape
+func asm()
 `
-	file, err := parser.ParseFile(fset, "test.go", src, parser.ParseComments)
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
 	if err != nil {
 		t.Fatalf("parse file: %v", err)
 	}
+	cgoSrc := `package p
 
-	directive, pos := findDangerousDirective([]*ast.File{file})
-	if directive != "//go:nosplit" {
-		t.Fatalf("expected //go:nosplit, got %q", directive)
-	}
-	if pos == (token.Position{}) {
-		t.Fatalf("expected non-zero position for directive")
-	}
-}
-
-func TestFindDangerousDirectiveNone(t *testing.T) {
-	src := `package p
+//go:cgo_import_dynamic foo foo "libfoo.so"
 
-func f() {}
+func cgoHelper() string { return "cgo" }
 `
-	file, err := parser.ParseFile(fset, "test.go", src, parser.ParseComments)
+	cgoFile, err := parser.ParseFile(fset, "_cgo_gotypes.go", cgoSrc, parser.ParseComments)
 	if err != nil {
 		t.Fatalf("parse file: %v", err)
 	}
 
-	directive, pos := findDangerousDirective([]*ast.File{file})
-	if directive != "" || pos != (token.Position{}) {
-		t.Fatalf("expected no directive, got %q at %v", directive, pos)
+	origShared, origLiterals := sharedCache, flagLiterals
+	defer func() { sharedCache, flagLiterals = origShared, origLiterals }()
+	sharedCache = &sharedCacheType{}
+	flagLiterals = true
+
+	lpkg := &listedPackage{ImportPath: "test/p", ToObfuscate: true}
+	files := []*ast.File{file, cgoFile}
+	on, optIn := literalsSettingFor(lpkg, files)
+	if !on || optIn {
+		t.Fatalf("literalsSettingFor = %v, %v; want true, false", on, optIn)
+	}
+	got := literalsSkipped(lpkg, files, on)
+	want := map[string]string{
+		"fast":            "//go:nosplit",
+		"hot":             "//garble:noliterals",
+		"_cgo_gotypes.go": "//go:cgo_import_dynamic",
+	}
+	if !maps.Equal(got, want) {
+		t.Fatalf("literalsSkipped:\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestLiteralsSettingDirectives(t *testing.T) {
+	origShared, origLiterals := sharedCache, flagLiterals
+	defer func() { sharedCache, flagLiterals = origShared, origLiterals }()
+	sharedCache = &sharedCacheType{}
+
+	tests := []struct {
+		src           string
+		flag          bool
+		on, optIn     bool
+		notObfuscated bool
+	}{
+		{src: "package p\n", flag: true, on: true},
+		{src: "package p\n", flag: false},
+		{src: "//garble:noliterals\npackage p\n", flag: true},
+		{src: "//garble:literals\npackage p\n", flag: false, on: true},
+		{src: "package p\n\n//garble:literals\nfunc f() {}\n", flag: false, optIn: true},
+		{src: "package p\n\n//garble:literals\n\nfunc f() {}\n", flag: false, optIn: true},
+		{src: "//garble:literals\npackage p\n", flag: true, notObfuscated: true},
+	}
+	for _, test := range tests {
+		file, err := parser.ParseFile(fset, "p.go", test.src, parser.ParseComments)
+		if err != nil {
+			t.Fatalf("parse file: %v", err)
+		}
+		flagLiterals = test.flag
+		lpkg := &listedPackage{ImportPath: "test/p", ToObfuscate: !test.notObfuscated}
+		on, optIn := literalsSettingFor(lpkg, []*ast.File{file})
+		if on != test.on || optIn != test.optIn {
+			t.Errorf("literalsSettingFor(%q) with -literals=%v = %v, %v; want %v, %v",
+				test.src, test.flag, on, optIn, test.on, test.optIn)
+		}
 	}
 }
@@ -0,0 +1,241 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// wireEncoding describes an encoding package which names struct fields
+// after their Go identifiers unless a struct tag says otherwise.
+type wireEncoding struct {
+	key string // struct tag key, like "json"
+
+	// options lists the tag options we may keep when adding a name to a
+	// tag with an empty name, like `xml:",omitempty"`; nil allows any.
+	// Other options, like xml's ",chardata", do not use the field name.
+	options []string
+
+	lower bool // whether the default name is the lowercased field name
+
+	listed func(path string) bool
+}
+
+var wireEncodings = []wireEncoding{
+	{
+		key:    "json",
+		listed: func(path string) bool { return path == "encoding/json" },
+	},
+	{
+		key:     "xml",
+		options: []string{"attr", "omitempty"},
+		listed:  func(path string) bool { return path == "encoding/xml" },
+	},
+	{
+		key:     "yaml",
+		options: []string{"omitempty", "flow"},
+		lower:   true,
+		listed: func(path string) bool {
+			return strings.HasPrefix(path, "gopkg.in/yaml.") || strings.HasPrefix(path, "go.yaml.in/yaml/")
+		},
+	},
+}
+
+// linkedWireEncodings returns the wire encodings which are part of the build.
+// Adding tags for the others would only add more plaintext to the binary.
+func linkedWireEncodings() []wireEncoding {
+	var linked []wireEncoding
+	for _, enc := range wireEncodings {
+		for path := range sharedCache.ListedPackages {
+			if enc.listed(path) {
+				linked = append(linked, enc)
+				break
+			}
+		}
+	}
+	return linked
+}
+
+// addWireTags adds struct tags with the original names to the exported fields
+// which are reflected, so that encodings like encoding/json keep producing
+// the same output once the field names are obfuscated.
+//
+// We only do this for the fields of declared types. Tags are part of a
+// struct type's identity, so adding them to struct type literals could break
+// assignments between them. Fields which are embedded or kept are left alone,
+// as their names are not obfuscated or not used by the encodings.
+func (tf *transformer) addWireTags(file *ast.File) {
+	encodings := linkedWireEncodings()
+	if len(encodings) == 0 {
+		return
+	}
+	for node := range ast.Preorder(file) {
+		spec, ok := node.(*ast.TypeSpec)
+		if !ok {
+			continue
+		}
+		structType, ok := spec.Type.(*ast.StructType)
+		if !ok {
+			continue
+		}
+		strct, ok := tf.info.TypeOf(structType).(*types.Struct)
+		if !ok {
+			continue
+		}
+		var list []*ast.Field
+		for _, field := range structType.Fields.List {
+			if len(field.Names) == 0 {
+				list = append(list, field)
+				continue
+			}
+			// Each name may need a different tag, so split "A, B int".
+			for i, name := range field.Names {
+				newField := field
+				if len(field.Names) > 1 {
+					newField = &ast.Field{Names: []*ast.Ident{name}, Type: field.Type, Tag: field.Tag}
+					if i == 0 {
+						newField.Doc = field.Doc
+					}
+					if i == len(field.Names)-1 {
+						newField.Comment = field.Comment
+					}
+				}
+				tf.addWireTag(strct, newField, encodings)
+				list = append(list, newField)
+			}
+		}
+		structType.Fields.List = list
+	}
+}
+
+func (tf *transformer) addWireTag(strct *types.Struct, field *ast.Field, encodings []wireEncoding) {
+	name := field.Names[0]
+	obj, ok := tf.info.Defs[name].(*types.Var)
+	if !ok || !obj.Exported() {
+		return
+	}
+	if _, ok := tf.curPkgCache.ReflectObjectNames[hashWithStruct(strct, obj)]; !ok {
+		return
+	}
+	if tf.isKept(obj) {
+		return
+	}
+	tag := ""
+	if field.Tag != nil {
+		var err error
+		if tag, err = strconv.Unquote(field.Tag.Value); err != nil {
+			return
+		}
+	}
+	newTag, ok := addWireNames(tag, obj.Name(), encodings)
+	if !ok || newTag == tag {
+		return
+	}
+	field.Tag = &ast.BasicLit{
+		ValuePos: field.Type.End(),
+		Kind:     token.STRING,
+		Value:    strconv.Quote(newTag),
+	}
+	if flagDebug {
+		log.Printf("field %q given wire tag %q", obj.Name(), newTag)
+	}
+}
+
+// addWireNames adds the field name to a struct tag for each of the encodings.
+// Keys which are missing are added, and keys with an empty name like
+// `json:",omitempty"` get the name inserted. A malformed tag is not modified,
+// and false is returned.
+func addWireNames(tag, name string, encodings []wireEncoding) (string, bool) {
+	pairs, ok := parseStructTag(tag)
+	if !ok {
+		return tag, false
+	}
+	for _, enc := range encodings {
+		wireName := name
+		if enc.lower {
+			wireName = strings.ToLower(name)
+		}
+		i := slices.IndexFunc(pairs, func(p tagPair) bool { return p.key == enc.key })
+		if i < 0 {
+			pairs = append(pairs, tagPair{enc.key, wireName})
+			continue
+		}
+		value := pairs[i].value
+		if value == "-" || value != "" && value[0] != ',' {
+			continue // ignored or already named
+		}
+		if enc.options != nil && !allWireOptions(value, enc.options) {
+			continue
+		}
+		pairs[i].value = wireName + value
+	}
+	var sb strings.Builder
+	for i, p := range pairs {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(p.key)
+		sb.WriteByte(':')
+		sb.WriteString(strconv.Quote(p.value))
+	}
+	return sb.String(), true
+}
+
+func allWireOptions(value string, allowed []string) bool {
+	if value == "" {
+		return true
+	}
+	for opt := range strings.SplitSeq(value[1:], ",") {
+		if !slices.Contains(allowed, opt) {
+			return false
+		}
+	}
+	return true
+}
+
+type tagPair struct{ key, value string }
+
+// parseStructTag splits a struct tag into its key-value pairs,
+// following the conventional format documented in reflect.StructTag.
+func parseStructTag(tag string) ([]tagPair, bool) {
+	var pairs []tagPair
+	for {
+		tag = strings.TrimLeft(tag, " ")
+		if tag == "" {
+			return pairs, true
+		}
+		i := 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			return nil, false
+		}
+		key := tag[:i]
+		tag = tag[i+1:]
+
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			return nil, false
+		}
+		value, err := strconv.Unquote(tag[:i+1])
+		if err != nil {
+			return nil, false
+		}
+		tag = tag[i+1:]
+		pairs = append(pairs, tagPair{key, value})
+	}
+}
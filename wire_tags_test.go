@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestAddWireNames(t *testing.T) {
+	tests := []struct {
+		tag, want string
+		ok        bool
+	}{
+		{``, `json:"FieldName" xml:"FieldName" yaml:"fieldname"`, true},
+		{`db:"x"`, `db:"x" json:"FieldName" xml:"FieldName" yaml:"fieldname"`, true},
+		{`json:",omitempty" xml:",attr"`, `json:"FieldName,omitempty" xml:"FieldName,attr" yaml:"fieldname"`, true},
+		{`json:"name" xml:"-" yaml:"-"`, `json:"name" xml:"-" yaml:"-"`, true},
+		{`json:"-," xml:",chardata" yaml:",inline"`, `json:"-," xml:",chardata" yaml:",inline"`, true},
+		{`json:",string" yaml:",omitempty,flow"`, `json:"FieldName,string" yaml:"fieldname,omitempty,flow" xml:"FieldName"`, true},
+		{`json:"a\"b"`, `json:"a\"b" xml:"FieldName" yaml:"fieldname"`, true},
+		{`json:name`, `json:name`, false},
+		{`json:"unterminated`, `json:"unterminated`, false},
+	}
+	for _, test := range tests {
+		got, ok := addWireNames(test.tag, "FieldName", wireEncodings)
+		if got != test.want || ok != test.ok {
+			t.Errorf("addWireNames(%q) = %q, %v; want %q, %v", test.tag, got, ok, test.want, test.ok)
+		}
+	}
+}